@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/MistyPigeon/lingo/pkg/codegen"
 	"github.com/MistyPigeon/lingo/pkg/lexer"
@@ -39,13 +40,20 @@ func main() {
 	if outFile == "" {
 		outFile = filepath.Join(
 			filepath.Dir(*inputFile),
-			filepath.Base(*inputFile[:len(*inputFile)-len(filepath. Ext(*inputFile))])+".go",
+			strings.TrimSuffix(filepath.Base(*inputFile), filepath.Ext(*inputFile))+".go",
 		)
 	}
 
 	// Lexing
 	lex := lexer.New(string(source))
+	lex.Mode = lexer.ScanComments // keep doc comments for the generated code
 	tokens := lex.Tokenize()
+	if errs := lex.Errors(); len(errs) > 0 {
+		for _, e := range errs {
+			fmt.Fprintf(os.Stderr, "%s:%v\n", *inputFile, e)
+		}
+		os.Exit(1)
+	}
 
 	if *verbose {
 		fmt.Println("=== TOKENS ===")
@@ -57,9 +65,10 @@ func main() {
 
 	// Parsing
 	p := parser.New(tokens)
+	p.Filename = *inputFile
 	ast, err := p.Parse()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Parse error: %v\n", err)
+		parser.PrintError(os.Stderr, err)
 		os.Exit(1)
 	}
 
@@ -84,6 +93,7 @@ func main() {
 
 	// Code generation
 	gen := codegen.New()
+	gen.Info = tc.Info()
 	goCode, err := gen.Generate(ast)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Codegen error: %v\n", err)
@@ -115,10 +125,14 @@ func printAST(node interface{}, depth int) {
 	case *parser.FuncDecl:
 		fmt.Printf("%sFunction: %s\n", indent, n.Name)
 		if n.Receiver != nil {
-			fmt.Printf("%s  Receiver: %s\n", indent, n.Receiver)
+			fmt.Printf("%s  Receiver: %s: %s\n", indent, n.Receiver.Name, n.Receiver.Type)
 		}
 		fmt.Printf("%s  Params:\n", indent)
 		for _, p := range n.Params {
+			if p.Variadic {
+				fmt.Printf("%s    %s: ...%s\n", indent, p.Name, p.Type)
+				continue
+			}
 			fmt.Printf("%s    %s: %s\n", indent, p.Name, p.Type)
 		}
 		fmt.Printf("%s  Returns:\n", indent)
@@ -130,7 +144,7 @@ func printAST(node interface{}, depth int) {
 			printAST(stmt, depth+2)
 		}
 	case *parser.VarDecl:
-		fmt. Printf("%sVar: %s: %s\n", indent, n.Name, n.Type)
+		fmt. Printf("%sVar: %s: %v\n", indent, n.Name, n.Type)
 	case *parser. StructDecl:
 		fmt.Printf("%sStruct: %s\n", indent, n.Name)
 		for _, f := range n.Fields {
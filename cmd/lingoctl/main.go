@@ -1,10 +1,10 @@
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
 	"os"
-	"path/filepath"
 
 	"github.com/MistyPigeon/lingo/pkg/lexer"
 	"github.com/MistyPigeon/lingo/pkg/parser"
@@ -23,27 +23,38 @@ func main() {
 		os.Exit(1)
 	}
 
-	source, err := os.ReadFile(*file)
+	source, err := os.Open(*file)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
 		os.Exit(1)
 	}
+	defer source.Close()
+
+	// Both commands stream the file rather than loading it whole.
+	lex := lexer.NewReader(bufio.NewReader(source))
 
 	switch *command {
 	case "lex":
-		lex := lexer.New(string(source))
-		tokens := lex.Tokenize()
-		for _, tok := range tokens {
-			fmt. Printf("%v: %q\n", tok.Type, tok.Value)
+		for tok := lex.NextToken(); ; tok = lex.NextToken() {
+			fmt.Printf("%v: %q\n", tok.Type, tok.Value)
+			if tok.Type == lexer.TOKEN_EOF {
+				break
+			}
+		}
+		if reportLexErrors(*file, lex) {
+			os.Exit(1)
 		}
 
 	case "parse":
-		lex := lexer.New(string(source))
-		tokens := lex.Tokenize()
-		p := parser.New(tokens)
+		p := parser.NewFromSource(lex)
+		p.Filename = *file
 		ast, err := p.Parse()
+		// Lexical errors explain any parse errors they caused.
+		if reportLexErrors(*file, lex) {
+			os.Exit(1)
+		}
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Parse error: %v\n", err)
+			parser.PrintError(os.Stderr, err)
 			os. Exit(1)
 		}
 		fmt.Printf("AST parsed successfully.  Items: %d\n", len(ast.Items))
@@ -53,3 +64,12 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// reportLexErrors prints any lexical errors to stderr and reports whether
+// there were some.
+func reportLexErrors(file string, lex *lexer.Lexer) bool {
+	for _, e := range lex.Errors() {
+		fmt.Fprintf(os.Stderr, "%s:%v\n", file, e)
+	}
+	return len(lex.Errors()) > 0
+}
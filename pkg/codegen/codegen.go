@@ -2,37 +2,50 @@ package codegen
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/MistyPigeon/lingo/pkg/parser"
+	"github.com/MistyPigeon/lingo/pkg/typechecker"
 )
 
 type CodeGen struct {
 	output    strings.Builder
 	indent    int
-	imports   map[string]bool
+	imports   map[string]string             // import path to name, "" for none
+	importDoc map[string]*parser.ImportDecl // import path to its declaration
 	nullSafe  bool
+	err       error // first statement that could not be generated
+
+	// Info is what the type checker learnt about the program. Without
+	// it nullable types are emitted as their element types and arrow
+	// lambdas return interface{}.
+	Info *typechecker.Info
 }
 
 func New() *CodeGen {
 	return &CodeGen{
-		imports: make(map[string]bool),
+		imports:   make(map[string]string),
+		importDoc: make(map[string]*parser.ImportDecl),
 	}
 }
 
 func (cg *CodeGen) Generate(program *parser.Program) (string, error) {
 	cg.output.Reset()
-	cg.imports["fmt"] = false
+	cg.err = nil
 
-	cg.emitln("package main")
-	cg.emitln("")
+	header := cg.generatePackage(program)
 
 	for _, item := range program.Items {
+		if cg.output.Len() > 0 && emitsCode(item) {
+			cg.emitln("")
+		}
 		switch node := item.(type) {
 		case *parser.PackageDecl:
-			// Skip - already emitted
+			// Skip - already in header
 		case *parser.ImportDecl:
-			cg.imports[node.Path] = true
+			cg.addImport(node)
 		case *parser.FuncDecl:
 			cg. generateFunc(node)
 		case *parser.VarDecl:
@@ -41,16 +54,49 @@ func (cg *CodeGen) Generate(program *parser.Program) (string, error) {
 			cg. generateConst(node)
 		case *parser.TypeDecl:
 			cg. generateType(node)
+		case *parser.StructDecl:
+			cg.generateStruct(node)
+		case *parser.InterfaceDecl:
+			cg.generateInterface(node)
+		case *parser.GenDecl:
+			cg.generateGenDecl(node)
 		}
 	}
 
+	if cg.err != nil {
+		return "", cg.err
+	}
+
 	// Emit imports
 	if len(cg.imports) > 0 {
 		importStr := cg.generateImports()
-		return importStr + cg.output.String(), nil
+		return header + importStr + cg.output.String(), nil
 	}
 
-	return cg. output.String(), nil
+	return header + cg.output.String(), nil
+}
+
+// emitsCode reports whether a top-level item is emitted in place, rather
+// than in the header or the import block.
+func emitsCode(item parser.ASTNode) bool {
+	switch node := item.(type) {
+	case *parser.PackageDecl, *parser.ImportDecl:
+		return false
+	case *parser.GenDecl:
+		return node.Tok != "import"
+	}
+	return true
+}
+
+// generatePackage returns the package clause, preceded by the package
+// documentation if the source had any.
+func (cg *CodeGen) generatePackage(program *parser.Program) string {
+	for _, item := range program.Items {
+		if pkg, ok := item.(*parser.PackageDecl); ok {
+			return commentText(pkg.Doc, "") + "package " + pkg.Name + trailingComment(pkg.Comment) + "\n\n"
+		}
+	}
+	return "package main\n\n"
 }
 
 func (cg *CodeGen) generateImports() string {
@@ -58,50 +104,71 @@ func (cg *CodeGen) generateImports() string {
 		return ""
 	}
 
+	paths := make([]string, 0, len(cg.imports))
+	for path := range cg.imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
 	var imports strings.Builder
 	imports.WriteString("import (\n")
-	for path := range cg.imports {
-		if path != "" {
-			imports.WriteString(fmt.Sprintf(`	"%s"` + "\n", path))
+	for _, path := range paths {
+		if path == "" {
+			continue
 		}
+		imp := cg.importDoc[path]
+		if imp != nil {
+			imports.WriteString(commentText(imp.Doc, "\t"))
+		}
+		imports.WriteString("\t")
+		if alias := cg.imports[path]; alias != "" {
+			imports.WriteString(alias + " ")
+		}
+		imports.WriteString(strconv.Quote(path))
+		if imp != nil {
+			imports.WriteString(trailingComment(imp.Comment))
+		}
+		imports.WriteString("\n")
 	}
 	imports. WriteString(")\n\n")
 	return imports.String()
 }
 
-func (cg *CodeGen) generateFunc(fn *parser.FuncDecl) {
-	cg.emit("func ")
+// addImport adds an import declared in the source, keeping its comments.
+func (cg *CodeGen) addImport(imp *parser.ImportDecl) {
+	cg.imports[imp.Path] = imp.Alias
+	cg.importDoc[imp.Path] = imp
+}
 
-	if fn. Receiver != nil {
-		cg.emit("(r " + fn.Receiver. Type + ") ")
+// useFmt imports fmt when x refers to it. Lingo programs may use fmt
+// without importing it.
+func (cg *CodeGen) useFmt(x parser.ASTNode) {
+	ident, ok := x.(*parser.Identifier)
+	if !ok || ident.Name != "fmt" {
+		return
 	}
-
-	cg.emit(fn.Name + "(")
-
-	for i, param := range fn.Params {
-		if i > 0 {
-			cg.emit(", ")
-		}
-		cg.emit(param.Name + " " + param.Type)
+	if cg.Info != nil && cg.Info.Types[ident] != "" {
+		return // a variable named fmt
+	}
+	if _, ok := cg.imports["fmt"]; !ok {
+		cg.imports["fmt"] = ""
 	}
+}
 
-	cg.emit(")")
+func (cg *CodeGen) generateFunc(fn *parser.FuncDecl) {
+	cg.emitDoc(fn.Doc)
+	cg.emit("func ")
 
-	if len(fn.Returns) > 0 {
-		if len(fn.Returns) == 1 {
-			cg.emit(" " + fn.Returns[0])
-		} else {
-			cg.emit(" (")
-			for i, ret := range fn.Returns {
-				if i > 0 {
-					cg.emit(", ")
-				}
-				cg.emit(ret)
-			}
-			cg.emit(")")
-		}
+	if fn. Receiver != nil {
+		cg.generateParams([]*parser.Param{fn.Receiver})
+		cg.emit(" ")
 	}
 
+	cg.emit(fn.Name)
+	cg.generateTypeParams(fn.TypeParams)
+	cg.generateParams(fn.Params)
+	cg.generateResults(fn.Returns)
+
 	cg.emitln(" {")
 	cg.indent++
 
@@ -110,40 +177,376 @@ func (cg *CodeGen) generateFunc(fn *parser.FuncDecl) {
 	}
 
 	cg.indent--
-	cg. emitln("}")
-	cg.emitln("")
+	cg.emitln("}" + trailingComment(fn.Comment))
 }
 
 func (cg *CodeGen) generateVar(v *parser.VarDecl) {
-	cg.emit("var " + v.Name)
+	cg.emitDoc(v.Doc)
+	cg.emit(cg.getIndent() + "var ")
+	cg.generateVarSpec(v)
+	cg.emitln(trailingComment(v.Comment))
+}
 
-	if v.Type != "" {
-		cg. emit(" " + v.Type)
+func (cg *CodeGen) generateVarSpec(v *parser.VarDecl) {
+	cg.emit(v.Name)
+
+	if v.Type != nil {
+		cg. emit(" ")
+		if v.IsNullable {
+			cg.generateNullableType(v.Type)
+		} else {
+			cg.generateTypeExpr(v.Type)
+		}
 	}
 
 	if v. Value != nil {
 		cg. emit(" = ")
 		cg.generateExpr(v.Value)
 	}
-
-	cg.emitln("")
 }
 
 func (cg *CodeGen) generateConst(c *parser.ConstDecl) {
-	cg.emit("const " + c.Name)
+	cg.emitDoc(c.Doc)
+	cg.emit(cg.getIndent() + "const ")
+	cg.generateConstSpec(c)
+	cg.emitln(trailingComment(c.Comment))
+}
 
-	if c.Type != "" {
-		cg. emit(" " + c.Type)
+// generateConstSpec emits a constant. One without a value repeats the
+// previous constant of its group, as it does in Go.
+func (cg *CodeGen) generateConstSpec(c *parser.ConstDecl) {
+	cg.emit(c.Name)
+	if c.Value == nil {
+		return
+	}
+
+	if c.Type != nil {
+		cg. emit(" ")
+		cg.generateTypeExpr(c.Type)
 	}
 
 	cg.emit(" = ")
 	cg.generateExpr(c.Value)
-	cg.emitln("")
 }
 
 func (cg *CodeGen) generateType(t *parser.TypeDecl) {
-	cg.emit("type " + t.Name + " " + t.Type)
-	cg.emitln("")
+	cg.emitDoc(t.Doc)
+	cg.emit("type ")
+	cg.generateTypeSpec(t)
+	cg.emitln(trailingComment(t.Comment))
+}
+
+func (cg *CodeGen) generateTypeSpec(t *parser.TypeDecl) {
+	cg.emit(t.Name)
+	cg.generateTypeParams(t.TypeParams)
+	cg.emit(" ")
+	cg.generateTypeExpr(t.Type)
+}
+
+// generateTypeParams emits a type parameter list, keeping together the
+// parameters that were declared with one constraint.
+func (cg *CodeGen) generateTypeParams(params []*parser.TypeParam) {
+	if len(params) == 0 {
+		return
+	}
+	cg.emit("[")
+	for i, param := range params {
+		if i > 0 {
+			cg.emit(", ")
+		}
+		cg.emit(param.Name)
+		if i+1 < len(params) && params[i+1].Constraint == param.Constraint {
+			continue
+		}
+		cg.emit(" ")
+		cg.generateTypeExpr(param.Constraint)
+	}
+	cg.emit("]")
+}
+
+func (cg *CodeGen) generateStruct(s *parser.StructDecl) {
+	cg.emitDoc(s.Doc)
+	cg.emit("type ")
+	cg.generateStructSpec(s)
+	cg.emitln(trailingComment(s.Comment))
+}
+
+func (cg *CodeGen) generateStructSpec(s *parser.StructDecl) {
+	cg.emit(s.Name)
+	cg.generateTypeParams(s.TypeParams)
+	if len(s.Fields) == 0 {
+		cg.emit(" struct{}")
+		return
+	}
+
+	cg.emitln(" struct {")
+	cg.indent++
+	for _, f := range s.Fields {
+		cg.emitDoc(f.Doc)
+		cg.emit(cg.getIndent())
+		if f.Name != "" {
+			cg.emit(f.Name + " ")
+		}
+		cg.generateFieldType(f)
+		if f.Tag != "" {
+			cg.emit(" " + tagLiteral(f.Tag))
+		}
+		cg.emitln(trailingComment(f.Comment))
+	}
+	cg.indent--
+	cg.emit(cg.getIndent() + "}")
+}
+
+func (cg *CodeGen) generateInterface(i *parser.InterfaceDecl) {
+	cg.emitDoc(i.Doc)
+	cg.emit("type ")
+	cg.generateInterfaceSpec(i)
+	cg.emitln(trailingComment(i.Comment))
+}
+
+func (cg *CodeGen) generateInterfaceSpec(i *parser.InterfaceDecl) {
+	cg.emit(i.Name)
+	cg.generateTypeParams(i.TypeParams)
+	if len(i.Methods) == 0 && len(i.Embeds) == 0 {
+		cg.emit(" interface{}")
+		return
+	}
+
+	cg.emitln(" interface {")
+	cg.indent++
+	for _, e := range i.Embeds {
+		cg.emit(cg.getIndent())
+		cg.generateTypeExpr(e)
+		cg.emitln("")
+	}
+	for _, m := range i.Methods {
+		cg.emitDoc(m.Doc)
+		cg.emit(cg.getIndent() + m.Name)
+		cg.generateParams(m.Type.Params)
+		cg.generateResults(m.Type.Results)
+		cg.emitln(trailingComment(m.Comment))
+	}
+	cg.indent--
+	cg.emit(cg.getIndent() + "}")
+}
+
+// generateGenDecl emits a grouped declaration. Grouped imports are added
+// to the import block instead.
+func (cg *CodeGen) generateGenDecl(d *parser.GenDecl) {
+	if d.Tok == "import" {
+		for _, spec := range d.Specs {
+			cg.addImport(spec.(*parser.ImportDecl))
+		}
+		return
+	}
+
+	cg.emitDoc(d.Doc)
+	cg.emitln(cg.getIndent() + d.Tok + " (")
+	cg.indent++
+	for _, spec := range d.Specs {
+		var comment *parser.CommentGroup
+		switch s := spec.(type) {
+		case *parser.VarDecl:
+			cg.emitDoc(s.Doc)
+			cg.emit(cg.getIndent())
+			cg.generateVarSpec(s)
+			comment = s.Comment
+		case *parser.ConstDecl:
+			cg.emitDoc(s.Doc)
+			cg.emit(cg.getIndent())
+			cg.generateConstSpec(s)
+			comment = s.Comment
+		case *parser.TypeDecl:
+			cg.emitDoc(s.Doc)
+			cg.emit(cg.getIndent())
+			cg.generateTypeSpec(s)
+			comment = s.Comment
+		case *parser.StructDecl:
+			cg.emitDoc(s.Doc)
+			cg.emit(cg.getIndent())
+			cg.generateStructSpec(s)
+			comment = s.Comment
+		case *parser.InterfaceDecl:
+			cg.emitDoc(s.Doc)
+			cg.emit(cg.getIndent())
+			cg.generateInterfaceSpec(s)
+			comment = s.Comment
+		}
+		cg.emitln(trailingComment(comment))
+	}
+	cg.indent--
+	cg.emitln(cg.getIndent() + ")" + trailingComment(d.Comment))
+}
+
+// generateTypeExpr emits the Go spelling of a type.
+func (cg *CodeGen) generateTypeExpr(t parser.TypeExpr) {
+	switch t := t.(type) {
+	case *parser.IdentType:
+		cg.emit(t.Name)
+	case *parser.QualifiedType:
+		cg.emit(t.Package + "." + t.Name)
+	case *parser.PointerType:
+		cg.emit("*")
+		cg.generateTypeExpr(t.Elem)
+	case *parser.SliceType:
+		cg.emit("[]")
+		cg.generateTypeExpr(t.Elem)
+	case *parser.ArrayType:
+		cg.emit("[")
+		cg.generateExpr(t.Len)
+		cg.emit("]")
+		cg.generateTypeExpr(t.Elem)
+	case *parser.MapType:
+		cg.emit("map[")
+		cg.generateTypeExpr(t.Key)
+		cg.emit("]")
+		cg.generateTypeExpr(t.Value)
+	case *parser.ChanType:
+		switch t.Dir {
+		case parser.ChanSend:
+			cg.emit("chan<- ")
+		case parser.ChanRecv:
+			cg.emit("<-chan ")
+		default:
+			cg.emit("chan ")
+		}
+		if t.RecvElem() {
+			cg.emit("(")
+			cg.generateTypeExpr(t.Elem)
+			cg.emit(")")
+			return
+		}
+		cg.generateTypeExpr(t.Elem)
+	case *parser.FuncType:
+		cg.emit("func")
+		cg.generateParams(t.Params)
+		cg.generateResults(t.Results)
+	case *parser.StructType:
+		if len(t.Fields) == 0 {
+			cg.emit("struct{}")
+			return
+		}
+		cg.emit("struct {")
+		for i, f := range t.Fields {
+			if i > 0 {
+				cg.emit(";")
+			}
+			cg.emit(" ")
+			if f.Name != "" {
+				cg.emit(f.Name + " ")
+			}
+			cg.generateFieldType(f)
+			if f.Tag != "" {
+				cg.emit(" " + tagLiteral(f.Tag))
+			}
+		}
+		cg.emit(" }")
+	case *parser.InterfaceType:
+		if len(t.Methods) == 0 && len(t.Embeds) == 0 {
+			cg.emit("interface{}")
+			return
+		}
+		cg.emit("interface {")
+		for i, e := range t.Embeds {
+			if i > 0 {
+				cg.emit(";")
+			}
+			cg.emit(" ")
+			cg.generateTypeExpr(e)
+		}
+		for i, m := range t.Methods {
+			if i > 0 || len(t.Embeds) > 0 {
+				cg.emit(";")
+			}
+			cg.emit(" " + m.Name)
+			cg.generateParams(m.Type.Params)
+			cg.generateResults(m.Type.Results)
+		}
+		cg.emit(" }")
+	case *parser.NullableType:
+		cg.generateNullableType(t.Elem)
+	case *parser.TildeType:
+		cg.emit("~")
+		cg.generateTypeExpr(t.Elem)
+	case *parser.UnionType:
+		for i, term := range t.Terms {
+			if i > 0 {
+				cg.emit(" | ")
+			}
+			cg.generateTypeExpr(term)
+		}
+	case *parser.GenericType:
+		cg.generateTypeExpr(t.Base)
+		cg.emit("[")
+		for i, arg := range t.Args {
+			if i > 0 {
+				cg.emit(", ")
+			}
+			cg.generateTypeExpr(arg)
+		}
+		cg.emit("]")
+	}
+}
+
+// generateNullableType emits the nullable type ?elem, which is a pointer
+// unless values of elem may already be nil in Go.
+func (cg *CodeGen) generateNullableType(elem parser.TypeExpr) {
+	if cg.Info != nil && cg.Info.PointerNullable(elem.String()) {
+		cg.emit("*")
+	}
+	cg.generateTypeExpr(elem)
+}
+
+func (cg *CodeGen) generateFieldType(f *parser.StructField) {
+	if f.IsNullable {
+		cg.generateNullableType(f.Type)
+		return
+	}
+	cg.generateTypeExpr(f.Type)
+}
+
+// generateParams emits a parenthesised parameter list. Go does not allow
+// named and unnamed parameters to be mixed, so names are dropped unless
+// every parameter has one.
+func (cg *CodeGen) generateParams(params []*parser.Param) {
+	named := true
+	for _, param := range params {
+		named = named && param.Name != ""
+	}
+
+	cg.emit("(")
+	for i, param := range params {
+		if i > 0 {
+			cg.emit(", ")
+		}
+		if named {
+			cg.emit(param.Name + " ")
+		}
+		if param.Variadic {
+			cg.emit("...")
+		}
+		cg.generateTypeExpr(param.Type)
+	}
+	cg.emit(")")
+}
+
+func (cg *CodeGen) generateResults(results []parser.TypeExpr) {
+	switch len(results) {
+	case 0:
+		return
+	case 1:
+		cg.emit(" ")
+		cg.generateTypeExpr(results[0])
+		return
+	}
+	cg.emit(" (")
+	for i, ret := range results {
+		if i > 0 {
+			cg.emit(", ")
+		}
+		cg.generateTypeExpr(ret)
+	}
+	cg.emit(")")
 }
 
 func (cg *CodeGen) generateStatement(stmt interface{}) {
@@ -152,23 +555,38 @@ func (cg *CodeGen) generateStatement(stmt interface{}) {
 		cg.generateVar(s)
 	case *parser. ConstDecl:
 		cg.generateConst(s)
+	case *parser.GenDecl:
+		cg.generateGenDecl(s)
 	case *parser.ReturnStmt:
 		cg.generateReturn(s)
 	case *parser. IfStmt:
 		cg.generateIf(s)
 	case *parser.ForStmt:
 		cg. generateFor(s)
-	case *parser.AssignStmt:
-		cg.generateAssign(s)
-	case *parser.ShortAssignStmt:
-		cg.generateShortAssign(s)
-	case *parser.CallExpr:
-		cg. emit(cg.getIndent())
-		cg.generateExpr(s)
-		cg.emitln("")
-	case *parser.MethodCall:
+	case *parser.ForRangeStmt:
+		cg.generateForRange(s)
+	case *parser.SwitchStmt:
+		cg.generateSwitch(s)
+	case *parser.TypeSwitchStmt:
+		cg.generateTypeSwitch(s)
+	case *parser.SelectStmt:
+		cg.generateSelect(s)
+	case *parser.BranchStmt:
+		if s.Label != "" {
+			cg.emitln(cg.getIndent() + s.Tok + " " + s.Label)
+		} else {
+			cg.emitln(cg.getIndent() + s.Tok)
+		}
+	case *parser.LabeledStmt:
+		// As gofmt does, labels are outdented by one level.
+		cg.indent--
+		cg.emitln(cg.getIndent() + s.Label + ":")
+		cg.indent++
+		cg.generateStatement(s.Stmt)
+	case *parser.AssignStmt, *parser.ShortAssignStmt, *parser.IncDecStmt,
+		*parser.ChanOp, *parser.CallExpr, *parser.RecoverExpr:
 		cg.emit(cg.getIndent())
-		cg.generateExpr(s)
+		cg.generateSimpleStmt(s)
 		cg.emitln("")
 	case *parser.DeferStmt:
 		cg. emit(cg.getIndent() + "defer ")
@@ -182,6 +600,15 @@ func (cg *CodeGen) generateStatement(stmt interface{}) {
 		cg.emit(cg.getIndent() + "panic(")
 		cg.generateExpr(s. Expr)
 		cg.emitln(")")
+	case nil:
+		// The empty statement after a label at the end of a block.
+	default:
+		// Dropping a statement would silently change what the program
+		// does, so it is an error instead.
+		if cg.err == nil {
+			node := s.(parser.ASTNode)
+			cg.err = fmt.Errorf("%s: cannot generate %T statement", node.Pos(), node)
+		}
 	}
 }
 
@@ -228,38 +655,249 @@ func (cg *CodeGen) generateIf(ifStmt *parser.IfStmt) {
 	}
 }
 
+// generateSimpleStmt emits a simple statement inline, as it appears in a
+// statement list or a for clause.
+func (cg *CodeGen) generateSimpleStmt(stmt interface{}) {
+	switch s := stmt.(type) {
+	case *parser.AssignStmt:
+		cg.generateAssign(s)
+	case *parser.ShortAssignStmt:
+		cg.generateShortAssign(s)
+	case *parser.IncDecStmt:
+		cg.generateExpr(s.X)
+		cg.emit(s.Op)
+	default:
+		cg.generateExpr(s)
+	}
+}
+
 func (cg *CodeGen) generateFor(forStmt *parser.ForStmt) {
-	cg.emitln(cg.getIndent() + "for {")
-	cg.indent++
+	cg.emit(cg.getIndent() + "for ")
+	if forStmt.Init != nil || forStmt.Post != nil {
+		if forStmt.Init != nil {
+			cg.generateSimpleStmt(forStmt.Init)
+		}
+		cg.emit("; ")
+		if forStmt.Condition != nil {
+			cg.generateExpr(forStmt.Condition)
+		}
+		cg.emit("; ")
+		if forStmt.Post != nil {
+			cg.generateSimpleStmt(forStmt.Post)
+		}
+		cg.emit(" ")
+	} else if forStmt.Condition != nil {
+		cg.generateExpr(forStmt.Condition)
+		cg.emit(" ")
+	}
+	cg.generateBlock(forStmt.Body)
+	cg.emitln("")
+}
 
-	for _, stmt := range forStmt.Body {
-		cg.generateStatement(stmt)
+func (cg *CodeGen) generateForRange(loop *parser.ForRangeStmt) {
+	cg.emit(cg.getIndent() + "for ")
+	if loop.Key != "" {
+		cg.emit(loop.Key)
+		if loop.Value != "" {
+			cg.emit(", " + loop.Value)
+		}
+		if loop.Define {
+			cg.emit(" := ")
+		} else {
+			cg.emit(" = ")
+		}
+	}
+	cg.emit("range ")
+	cg.generateExpr(loop.Expr)
+	cg.emit(" ")
+	cg.generateBlock(loop.Body)
+	cg.emitln("")
+}
+
+func (cg *CodeGen) generateSwitch(sw *parser.SwitchStmt) {
+	cg.emit(cg.getIndent() + "switch ")
+	if sw.Init != nil {
+		cg.generateSimpleStmt(sw.Init)
+		cg.emit("; ")
+	}
+	if cg.isNullSwitch(sw) {
+		cg.emitln("{")
+		for _, clause := range sw.Body {
+			cg.generateCaseClause(clause, func(item interface{}) {
+				cg.generateExpr(sw.Tag)
+				if _, ok := item.(*parser.LiteralNull); ok {
+					cg.emit(" == nil")
+					return
+				}
+				cg.emit(" != nil && *")
+				cg.generateExpr(sw.Tag)
+				cg.emit(" == ")
+				cg.generateExpr(item)
+			})
+		}
+		cg.emitln(cg.getIndent() + "}")
+		return
+	}
+	if sw.Tag != nil {
+		cg.generateExpr(sw.Tag)
+		cg.emit(" ")
+	}
+	cg.emitln("{")
+	for _, clause := range sw.Body {
+		cg.generateCaseClause(clause, cg.generateExpr)
+	}
+	cg.emitln(cg.getIndent() + "}")
+}
+
+// isNullSwitch reports whether sw has a null case and switches on a
+// nullable value represented by a pointer. Its cases are then emitted as
+// conditions: the pointer is compared with nil and its target with the
+// other cases.
+func (cg *CodeGen) isNullSwitch(sw *parser.SwitchStmt) bool {
+	return sw.Tag != nil && cg.Info != nil && cg.Info.Pointers[sw.Tag] && !cg.Info.Deref[sw.Tag]
+}
+
+func (cg *CodeGen) generateTypeSwitch(sw *parser.TypeSwitchStmt) {
+	cg.emit(cg.getIndent() + "switch ")
+	if sw.Init != nil {
+		cg.generateSimpleStmt(sw.Init)
+		cg.emit("; ")
+	}
+	if sw.Binding != "" {
+		cg.emit(sw.Binding + " := ")
+	}
+	cg.generateExpr(sw.X)
+	cg.emitln(".(type) {")
+	for _, clause := range sw.Body {
+		cg.generateCaseClause(clause, func(item interface{}) {
+			if t, ok := item.(parser.TypeExpr); ok {
+				cg.generateTypeExpr(t)
+			} else {
+				cg.generateExpr(item)
+			}
+		})
+	}
+	cg.emitln(cg.getIndent() + "}")
+}
+
+// generateCaseClause emits a clause of a switch, using item to emit each
+// case in its list.
+func (cg *CodeGen) generateCaseClause(clause *parser.CaseClause, item func(interface{})) {
+	if clause.List == nil {
+		cg.emitln(cg.getIndent() + "default:")
+	} else {
+		cg.emit(cg.getIndent() + "case ")
+		for i, x := range clause.List {
+			if i > 0 {
+				cg.emit(", ")
+			}
+			item(x)
+		}
+		cg.emitln(":")
 	}
 
+	cg.indent++
+	for _, stmt := range clause.Body {
+		cg.generateStatement(stmt)
+	}
 	cg.indent--
+}
+
+func (cg *CodeGen) generateSelect(sel *parser.SelectStmt) {
+	cg.emitln(cg.getIndent() + "select {")
+	for _, c := range sel.Cases {
+		if c.Comm == nil {
+			cg.emitln(cg.getIndent() + "default:")
+		} else {
+			cg.emit(cg.getIndent() + "case ")
+			cg.generateSimpleStmt(c.Comm)
+			cg.emitln(":")
+		}
+
+		cg.indent++
+		for _, stmt := range c.Body {
+			cg.generateStatement(stmt)
+		}
+		cg.indent--
+	}
 	cg.emitln(cg.getIndent() + "}")
 }
 
+// generateBlock emits a braced block whose opening brace ends the current
+// line. The closing brace is left unterminated so that blocks can also
+// end function literals.
+func (cg *CodeGen) generateBlock(body []parser.ASTNode) {
+	cg.emitln("{")
+	cg.indent++
+	for _, stmt := range body {
+		cg.generateStatement(stmt)
+	}
+	cg.indent--
+	cg.emit(cg.getIndent() + "}")
+}
+
 func (cg *CodeGen) generateAssign(assign *parser.AssignStmt) {
-	cg.emit(cg.getIndent() + assign.Name + " = ")
-	cg.generateExpr(assign.Value)
-	cg.emitln("")
+	op := assign.Op
+	if op == "" {
+		op = "="
+	}
+	cg.generateExprList(assign.Lhs)
+	cg.emit(" " + op + " ")
+	cg.generateExprList(assign.Rhs)
 }
 
 func (cg *CodeGen) generateShortAssign(assign *parser.ShortAssignStmt) {
-	cg.emit(cg.getIndent() + assign.Name + " := ")
-	cg.generateExpr(assign.Value)
-	cg.emitln("")
+	for i, ident := range assign.Lhs {
+		if i > 0 {
+			cg.emit(", ")
+		}
+		cg.emit(ident.Name)
+	}
+	cg.emit(" := ")
+	cg.generateExprList(assign.Rhs)
 }
 
+func (cg *CodeGen) generateExprList(list []parser.ASTNode) {
+	for i, expr := range list {
+		if i > 0 {
+			cg.emit(", ")
+		}
+		cg.generateExpr(expr)
+	}
+}
+
+// generateExpr emits an expression, converted as the type checker found
+// it must be to move between nullable and non-nullable types.
 func (cg *CodeGen) generateExpr(expr interface{}) {
+	if node, ok := expr.(parser.ASTNode); ok && cg.Info != nil {
+		if elem, ok := cg.Info.Boxed[node]; ok {
+			cg.emit("func() *" + elem + " { var v " + elem + " = ")
+			cg.generateValue(node)
+			cg.emit("; return &v }()")
+			return
+		}
+		if cg.Info.Deref[node] {
+			cg.emit("(*")
+			cg.generateValue(node)
+			cg.emit(")")
+			return
+		}
+	}
+	cg.generateValue(expr)
+}
+
+func (cg *CodeGen) generateValue(expr interface{}) {
 	switch e := expr.(type) {
 	case *parser.LiteralInt:
 		cg.emit(e.Value)
 	case *parser.LiteralFloat:
-		cg.emit(e. Value)
+		cg.emit(e.Value)
+	case *parser.LiteralImag:
+		cg.emit(e.Value)
 	case *parser. LiteralString:
-		cg.emit(`"` + e.Value + `"`)
+		cg.emit(strconv.Quote(e.Value))
+	case *parser.LiteralChar:
+		cg.emit(strconv.QuoteRune(e.Value))
 	case *parser. LiteralBool:
 		if e.Value {
 			cg.emit("true")
@@ -275,51 +913,161 @@ func (cg *CodeGen) generateExpr(expr interface{}) {
 	case *parser.UnaryOp:
 		cg.generateUnaryOp(e)
 	case *parser.CallExpr:
-		cg. emit(e. Func + "(")
-		for i, arg := range e.Args {
-			if i > 0 {
-				cg.emit(", ")
-			}
-			cg.generateExpr(arg)
+		cg.generateOperand(e.Fun)
+		cg.generateArgs(e.Args, e.Ellipsis)
+	case *parser.SelectorExpr:
+		cg.useFmt(e.X)
+		cg.generateOperand(e.X)
+		cg.emit("." + e.Sel.Name)
+	case *parser.FuncLit:
+		cg.emit("func")
+		cg.generateParams(e.Type.Params)
+		if e.Arrow && len(e.Type.Results) == 0 {
+			cg.emit(" " + cg.arrowResult(e))
+		} else {
+			cg.generateResults(e.Type.Results)
 		}
-		cg.emit(")")
-	case *parser.MethodCall:
-		cg.emit(e.Receiver + "." + e.Method + "(")
-		for i, arg := range e.Args {
-			if i > 0 {
-				cg.emit(", ")
-			}
-			cg.generateExpr(arg)
+		cg.emit(" ")
+		cg.generateBlock(e.Body)
+	case *parser.RecoverExpr:
+		cg.emit("recover()")
+	case *parser.ChanOp:
+		if e.Value != nil {
+			cg.generateExpr(e.Expr)
+			cg.emit(" <- ")
+			cg.generateExpr(e.Value)
+		} else {
+			cg.emit("<-")
+			cg.generateExpr(e.Expr)
 		}
-		cg.emit(")")
 	case *parser.IndexExpr:
 		cg. generateExpr(e. Expr)
 		cg.emit("[")
 		cg.generateExpr(e.Index)
 		cg.emit("]")
-	case *parser.NullCheckExpr:
-		cg. generateNullCheck(e)
-	case *parser.ArrayLiteral:
-		cg.emit("[]" + e.Type + "{")
-		for i, elem := range e.Elements {
+	case *parser.SliceExpr:
+		cg.generateOperand(e.Expr)
+		cg.emit("[")
+		if e.Low != nil {
+			cg.generateExpr(e.Low)
+		}
+		cg.emit(":")
+		if e.High != nil {
+			cg.generateExpr(e.High)
+		}
+		if e.Slice3 {
+			cg.emit(":")
+			cg.generateExpr(e.Max)
+		}
+		cg.emit("]")
+	case *parser.InstanceExpr:
+		cg.generateExpr(e.Expr)
+		cg.emit("[")
+		for i, arg := range e.TypeArgs {
 			if i > 0 {
 				cg.emit(", ")
 			}
-			cg.generateExpr(elem)
+			cg.generateTypeExpr(arg)
 		}
-		cg.emit("}")
+		cg.emit("]")
+	case *parser.NullCheckExpr:
+		cg. generateNullCheck(e)
+	case *parser.SafeNavExpr:
+		cg.generateSafeNav(e)
+	case *parser.NullableExpr:
+		cg.generateExpr(e.Expr)
+	case *parser.TypeAssertExpr:
+		cg.generateExpr(e.Expr)
+		cg.emit(".(")
+		if e.Type != nil {
+			cg.generateTypeExpr(e.Type)
+		} else {
+			cg.emit("type")
+		}
+		cg.emit(")")
+	case *parser.ArrayLiteral:
+		if e.Len != nil {
+			cg.emit("[")
+			cg.generateExpr(e.Len)
+			cg.emit("]")
+		} else if e.Type != nil {
+			cg.emit("[]")
+		}
+		if e.Type != nil {
+			cg.generateTypeExpr(e.Type)
+		} else {
+			cg.emit(cg.untypedArray(e))
+		}
+		cg.generateElements(e.Elements)
 	case *parser.MapLiteral:
-		cg.emit("map[string]interface{}{")
-		first := true
-		for key, val := range e.Pairs {
-			if !first {
-				cg.emit(", ")
-			}
-			cg.emit(`"` + key + `": `)
-			cg.generateExpr(val)
-			first = false
+		if e.KeyType != nil {
+			cg.emit("map[")
+			cg.generateTypeExpr(e.KeyType)
+			cg.emit("]")
+			cg.generateTypeExpr(e.ValueType)
+		} else {
+			cg.emit("map[string]interface{}")
+		}
+		elems := make([]parser.ASTNode, len(e.Entries))
+		for i, entry := range e.Entries {
+			elems[i] = entry
+		}
+		cg.generateElements(elems)
+	case *parser.StructLiteral:
+		cg.generateTypeExpr(e.Type)
+		elems := make([]parser.ASTNode, len(e.Fields))
+		for i, field := range e.Fields {
+			elems[i] = field
 		}
-		cg.emit("}")
+		cg.generateElements(elems)
+	case *parser.KeyValueExpr:
+		if e.Key != nil {
+			cg.generateExpr(e.Key)
+			cg.emit(": ")
+		}
+		cg.generateExpr(e.Value)
+	case parser.TypeExpr:
+		// The type argument of make or new.
+		cg.generateTypeExpr(e)
+	}
+}
+
+// generateElements emits the braced elements of a composite literal.
+func (cg *CodeGen) generateElements(elems []parser.ASTNode) {
+	cg.emit("{")
+	for i, elem := range elems {
+		if i > 0 {
+			cg.emit(", ")
+		}
+		cg.generateExpr(elem)
+	}
+	cg.emit("}")
+}
+
+func (cg *CodeGen) generateArgs(args []parser.ASTNode, ellipsis bool) {
+	cg.emit("(")
+	for i, arg := range args {
+		if i > 0 {
+			cg.emit(", ")
+		}
+		cg.generateExpr(arg)
+	}
+	if ellipsis {
+		cg.emit("...")
+	}
+	cg.emit(")")
+}
+
+// generateOperand emits the operand of a call or selector, which needs
+// parentheses if it is a unary expression, as in (*p).x.
+func (cg *CodeGen) generateOperand(x parser.ASTNode) {
+	switch x.(type) {
+	case *parser.UnaryOp, *parser.ChanOp:
+		cg.emit("(")
+		cg.generateExpr(x)
+		cg.emit(")")
+	default:
+		cg.generateExpr(x)
 	}
 }
 
@@ -331,22 +1079,101 @@ func (cg *CodeGen) generateBinaryOp(expr *parser.BinaryOp) {
 	cg.emit(")")
 }
 
+// tagLiteral spells a struct tag as a raw string where possible, since
+// that is how tags are conventionally written.
+func tagLiteral(tag string) string {
+	if strings.Contains(tag, "`") {
+		return strconv.Quote(tag)
+	}
+	return "`" + tag + "`"
+}
+
 func (cg *CodeGen) generateUnaryOp(expr *parser.UnaryOp) {
 	cg.emit(expr.Op)
 	cg.generateExpr(expr.Right)
 }
 
+// untypedArray returns the slice type of an untyped [a, b] literal, which
+// the checker infers from its elements.
+func (cg *CodeGen) untypedArray(lit *parser.ArrayLiteral) string {
+	if cg.Info != nil {
+		if t := cg.Info.Types[lit]; strings.HasPrefix(t, "[]") {
+			return t
+		}
+	}
+	return "[]interface{}"
+}
+
+// arrowResult returns the result type of an arrow lambda written without
+// one, which is the type the checker inferred for its expression.
+func (cg *CodeGen) arrowResult(lit *parser.FuncLit) string {
+	if cg.Info != nil {
+		expr := lit.Body[0].(*parser.ReturnStmt).Values[0]
+		if t := cg.Info.Types[expr]; t != "" && t != "nil" {
+			return t
+		}
+	}
+	return "interface{}"
+}
+
+// generateNullCheck emits x ?: d as a function literal that evaluates x
+// once and yields its value, dereferenced if it is a pointer, unless it
+// is nil.
 func (cg *CodeGen) generateNullCheck(expr *parser.NullCheckExpr) {
-	// Generate a nil check with default value
-	cg.emit("func() interface{} { if ")
+	typ, value := "interface{}", "v"
+	if cg.Info != nil {
+		if t := cg.Info.Types[expr]; t != "" && t != "nil" {
+			typ = t
+		}
+		if cg.Info.Pointers[expr.Expr] {
+			value = "*v"
+		}
+	}
+	cg.emit("func() " + typ + " { if v := ")
 	cg.generateExpr(expr.Expr)
-	cg.emit(" == nil { return ")
+	cg.emit("; v != nil { return " + value + " }; return ")
 	cg.generateExpr(expr.DefaultExpr)
-	cg.emit(" }; return ")
-	cg.generateExpr(expr.Expr)
 	cg.emit(" }()")
 }
 
+func (cg *CodeGen) generateSafeNav(expr *parser.SafeNavExpr) {
+	// Yield nil instead of dereferencing a nil receiver
+	cg.emit("func() interface{} { if ")
+	cg.generateExpr(expr.Expr)
+	cg.emit(" == nil { return nil }; return ")
+	cg.generateExpr(expr.Expr)
+	cg.emit("." + expr.Field + " }()")
+}
+
+// emitDoc writes a declaration's doc comment, one source comment per line,
+// at the current indentation.
+func (cg *CodeGen) emitDoc(doc *parser.CommentGroup) {
+	cg.emit(commentText(doc, cg.getIndent()))
+}
+
+func commentText(group *parser.CommentGroup, indent string) string {
+	if group == nil {
+		return ""
+	}
+	var b strings.Builder
+	for _, c := range group.List {
+		b.WriteString(indent + c.Text + "\n")
+	}
+	return b.String()
+}
+
+// trailingComment renders a line comment to follow code on the same line.
+func trailingComment(group *parser.CommentGroup) string {
+	if group == nil {
+		return ""
+	}
+	texts := make([]string, len(group.List))
+	for i, c := range group.List {
+		texts[i] = c.Text
+	}
+	return " " + strings.Join(texts, " ")
+}
+
 func (cg *CodeGen) emit(s string) {
 	cg. output. WriteString(s)
 }
@@ -0,0 +1,963 @@
+package codegen
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MistyPigeon/lingo/pkg/lexer"
+	"github.com/MistyPigeon/lingo/pkg/parser"
+	"github.com/MistyPigeon/lingo/pkg/typechecker"
+)
+
+// runTest is a program and the output it must print once compiled to Go.
+type runTest struct {
+	src  string
+	want string
+}
+
+// compile runs src through the lexer, parser and type checker and returns
+// the generated Go code. Comments are kept, as by the lingo command.
+func compile(t *testing.T, src string) string {
+	t.Helper()
+	lex := lexer.New(src)
+	lex.Mode = lexer.ScanComments
+	program, err := parser.NewFromSource(lex).Parse()
+	if err != nil {
+		t.Fatalf("%s\nparse error: %v", src, err)
+	}
+	tc := typechecker.New()
+	if err := tc.Check(program); err != nil {
+		t.Fatalf("%s\ntype error: %v", src, err)
+	}
+	gen := New()
+	gen.Info = tc.Info()
+	code, err := gen.Generate(program)
+	if err != nil {
+		t.Fatalf("%s\ncodegen error: %v", src, err)
+	}
+	return code
+}
+
+// run builds and runs the Go code with the go command and returns what it
+// printed.
+func run(t *testing.T, code string) string {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("skipping go build in short mode")
+	}
+	goCmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":  "module prog\n\ngo 1.22\n",
+		"main.go": code,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cmd := exec.Command(goCmd, "run", ".")
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go run: %v\n%s\n%s", err, out, code)
+	}
+	return string(out)
+}
+
+func runRunTests(t *testing.T, tests []runTest) {
+	t.Helper()
+	for _, tt := range tests {
+		if got := run(t, compile(t, tt.src)); got != tt.want {
+			t.Errorf("%s\n got %q\nwant %q", tt.src, got, tt.want)
+		}
+	}
+}
+
+// runOutputTests checks that the Go generated for each source contains
+// want.
+func runOutputTests(t *testing.T, tests []runTest) {
+	t.Helper()
+	for _, tt := range tests {
+		if got := compile(t, tt.src); !strings.Contains(got, tt.want) {
+			t.Errorf("%s\ngenerated code does not contain %q:\n%s", tt.src, tt.want, got)
+		}
+	}
+}
+
+func TestNumericLiterals(t *testing.T) {
+	runOutputTests(t, []runTest{
+		{`func main() { fmt.Println(0xFF) }`, `fmt.Println(0xFF)`},
+		{`func main() { fmt.Println(1_000_000) }`, `fmt.Println(1_000_000)`},
+		{`func main() { fmt.Println(0x1p-2) }`, `fmt.Println(0x1p-2)`},
+	})
+	runRunTests(t, []runTest{
+		{`func main() {
+	var mask: uint8 = 0b1111_0000
+	fmt.Println(0xFF, 0o17, 017, 1_000, mask)
+}`, "255 15 15 1000 240\n"},
+		{`func main() {
+	var c: complex128 = 2i
+	fmt.Println(1e3, .5, 0x1p-2, c, -c)
+}`, "1000 0.5 0.25 (0+2i) (-0-2i)\n"},
+		{`func main() {
+	var x: int64 = 40
+	var f: float64 = 1.5
+	fmt.Println(x + 2, 1 - x, f * 2, 3 / f, 1 + 2.5)
+}`, "42 -39 3 2 3.5\n"},
+	})
+}
+
+func TestStringAndRuneLiterals(t *testing.T) {
+	runOutputTests(t, []runTest{
+		{"func main() { fmt.Println(`a\\b`) }", `fmt.Println("a\\b")`},
+		{`func main() { fmt.Println('\'') }`, `fmt.Println('\'')`},
+		{`func main() { fmt.Println("tab\there") }`, `fmt.Println("tab\there")`},
+	})
+	runRunTests(t, []runTest{
+		{"func main() {\n\tq := `SELECT *\nFROM \"t\"`\n\tfmt.Println(q)\n}", "SELECT *\nFROM \"t\"\n"},
+		{`func main() {
+	var r: rune = 'é'
+	fmt.Println(r, string(r), "\x41é", '\\')
+}`, "233 é Aé 92\n"},
+	})
+}
+
+func TestStatementTerminators(t *testing.T) {
+	runRunTests(t, []runTest{
+		{`func main() { x := 1; y := 2; fmt.Println(x + y) }`, "3\n"},
+		{`func f() int {
+	x := 1
+	return x +
+		2
+}
+
+func main() {
+	fmt.Println(
+		f(),
+		"done",
+	)
+}`, "3 done\n"},
+	})
+
+	// The type checker rejects an unused expression; unchecked, it is an
+	// error rather than being dropped.
+	program, err := parser.New(lexer.New("func main() {\n\treturn\n\tx + y\n}").Tokenize()).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "3:2: cannot generate *parser.BinaryOp statement"
+	if _, err := New().Generate(program); err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %q", err, want)
+	}
+}
+
+func TestDocComments(t *testing.T) {
+	code := compile(t, `// Package main is a demo.
+package main
+
+// Point is a point.
+type Point struct {
+	// X is across.
+	x: int
+}
+
+// Limit is the limit.
+const Limit = 10 // inclusive
+
+// Add adds.
+func Add(a: int, b: int) int {
+	// not a doc comment
+	return a + b
+}
+
+func main() {
+	fmt.Println(Add(Limit, 1))
+}
+`)
+	for _, want := range []string{
+		"// Package main is a demo.\npackage main\n",
+		"// Point is a point.\ntype Point struct {",
+		"// Limit is the limit.\nconst Limit = 10 // inclusive\n",
+		"// Add adds.\nfunc Add(a int, b int) int {",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("generated code does not contain %q:\n%s", want, code)
+		}
+	}
+	if got := run(t, code); got != "11\n" {
+		t.Errorf("got %q, want %q", got, "11\n")
+	}
+}
+
+func TestComments(t *testing.T) {
+	code := compile(t, `package main // the demo
+
+import "strings" // for ToUpper
+
+// Point is a point.
+type Point struct {
+	// X is across.
+	X: int // in pixels
+	Y: int
+}
+
+type Shape interface {
+	// Area returns the area.
+	Area() float64 // never negative
+}
+var count = 1 // how many
+const Limit = 10
+func main() {
+	fmt.Println(strings.ToUpper("a"), count, Limit)
+}
+`)
+	want := `package main // the demo
+
+import (
+	"fmt"
+	"strings" // for ToUpper
+)
+
+// Point is a point.
+type Point struct {
+	// X is across.
+	X int // in pixels
+	Y int
+}
+
+type Shape interface {
+	// Area returns the area.
+	Area() float64 // never negative
+}
+
+var count = 1 // how many
+
+const Limit = 10
+
+func main() {
+	fmt.Println(strings.ToUpper("a"), count, Limit)
+}
+`
+	if code != want {
+		t.Errorf("got:\n%s\nwant:\n%s", code, want)
+	}
+}
+
+func TestAssignOperators(t *testing.T) {
+	runRunTests(t, []runTest{
+		{`func sum(xs: ...int) int {
+	total := 0
+	for _, x := range xs {
+		total += x
+	}
+	return total
+}
+
+func main() {
+	i := 10
+	i++
+	i -= 3
+	i <<= 2
+	i &^= 4
+	nums := []int{1, 2, 3}
+	fmt.Println(i, sum(), sum(1, 2), sum(nums...), 7 &^ 5)
+}`, "32 0 3 6 2\n"},
+		{`func main() {
+	ch := make(chan int, 1)
+	ch <- 41
+	v := <-ch
+	v++
+	fmt.Println(v)
+}`, "42\n"},
+	})
+}
+
+func TestTypeExprs(t *testing.T) {
+	runOutputTests(t, []runTest{
+		{`func f(x: chan (<-chan int)) {}
+func main() { fmt.Println() }`, `func f(x chan (<-chan int))`},
+		{`func f(x: chan<- chan int) {}
+func main() { fmt.Println() }`, `func f(x chan<- chan int)`},
+		{`func f(g: func(a: int, b: ...string) (int, error)) {}
+func main() { fmt.Println() }`, `func f(g func(a int, b ...string) (int, error))`},
+	})
+	runRunTests(t, []runTest{
+		{`import "strings"
+
+func apply(g: func(int) int, x: int) int {
+	return g(x)
+}
+
+func double(x: int) int {
+	return x * 2
+}
+
+func main() {
+	var grid: [][]int = [][]int{[]int{1, 2}, []int{3}}
+	var buf: [4]byte = [4]byte{1, 2, 3, 4}
+	var m: map[string][]int = map[string][]int{"a": []int{5}}
+	var p: *[]int = &grid[0]
+	var ch: chan (<-chan int) = make(chan (<-chan int), 1)
+	var sb: strings.Builder
+	sb.WriteString("ok")
+	fmt.Println(grid, buf[3], m["a"], len(*p), cap(ch), apply(double, 4), sb.String())
+}`, "[[1 2] [3]] 4 [5] 2 1 8 ok\n"},
+	})
+}
+
+func TestFuncValues(t *testing.T) {
+	runRunTests(t, []runTest{
+		{`func double(x: int) int {
+	return x * 2
+}
+
+func Map[T any, U any](xs: []T, f: func(T) U) []U {
+	out := make([]U, len(xs))
+	for i, x := range xs {
+		out[i] = f(x)
+	}
+	return out
+}
+
+func main() {
+	g := double
+	var h: func(int) int = double
+	fmt.Println(g(2), h(3), Map([]int{1, 2}, double))
+}`, "4 6 [2 4]\n"},
+	})
+}
+
+func TestStructs(t *testing.T) {
+	runOutputTests(t, []runTest{
+		{"type User struct {\n\tid: int\n\tname: string `json:\"name\"`\n}\nfunc main() { fmt.Println(User{}) }",
+			"type User struct {\n\tid int\n\tname string `json:\"name\"`\n}\n"},
+		{`type Empty struct {}
+func main() { fmt.Println(Empty{}) }`, "type Empty struct{}\n"},
+	})
+	runRunTests(t, []runTest{
+		{`import "encoding/json"
+
+type Base struct {
+	ID: int ` + "`json:\"id\"`" + `
+}
+
+type User struct {
+	Base
+	Name: string ` + "`json:\"name\"`" + `
+	Email: ?string ` + "`json:\"email\"`" + `
+}
+
+func (u: *User) Rename(name: string) {
+	u.Name = name
+}
+
+func main() {
+	u := User{Base: Base{ID: 1}, Name: "Ann", Email: null}
+	u.Rename("Bea")
+	out, _ := json.Marshal(u)
+	fmt.Println(u.ID, u.Name, string(out))
+}`, "1 Bea {\"id\":1,\"name\":\"Bea\",\"email\":null}\n"},
+	})
+}
+
+func TestFuncLits(t *testing.T) {
+	runOutputTests(t, []runTest{
+		{`func main() { g := (x: int) -> x > 1; fmt.Println(g(2)) }`, "g := func(x int) bool {"},
+		{`func main() { g := (x: int) int -> x; fmt.Println(g(2)) }`, "g := func(x int) int {"},
+	})
+	runRunTests(t, []runTest{
+		{`func counter() func() int {
+	n := 0
+	return func() int {
+		n++
+		return n
+	}
+}
+
+func apply(f: func(int) int, x: int) int {
+	return f(x)
+}
+
+func main() {
+	next := counter()
+	next()
+	square := (x: int) -> x * x
+	name := () -> "lingo"
+	defer func() {
+		fmt.Println("recovered", recover())
+	}()
+	fmt.Println(next(), square(3), apply((x: int) -> x + 1, 1), name(), ((x: int) -> x * 2)(3) + 1)
+	panic("boom")
+}`, "2 9 2 lingo 7\nrecovered boom\n"},
+	})
+}
+
+func TestNullSafety(t *testing.T) {
+	runOutputTests(t, []runTest{
+		{`type User struct { email: ?string }
+func main() { fmt.Println(User{email: null}) }`, "email *string"},
+		{`type Pair struct { a: ?[]string; b: ?*Pair }
+func main() { fmt.Println(Pair{}) }`, "\ta []string\n\tb *Pair\n"},
+		{`func f(n: ?int) ?error { return null }
+func main() { fmt.Println(f(1)) }`, "func f(n *int) error {"},
+	})
+	runRunTests(t, []runTest{
+		{`type User struct {
+	id: int
+	name: string
+	email: ?string
+}
+
+func (u: *User) GetEmail() ?string {
+	return u.email
+}
+
+func greet(name: ?string) string {
+	return "Hello, " + (name ?: "Guest")
+}
+
+func main() {
+	var name: ?string = null
+	var greeting: string = name ?: "World"
+	fmt.Println("Hello, " + greeting)
+
+	u := User{id: 1, name: "Ann", email: null}
+	v := &User{id: 2, name: "Bob", email: "bob@example.com"}
+	fmt.Println(u.email == null, u.GetEmail() ?: "none", v.GetEmail() ?: "none")
+	u.email = "ann@example.com"
+	fmt.Println(u.email ?? "none", greet(null), greet("Cy"), greet(name))
+}`, "Hello, World\ntrue none bob@example.com\nann@example.com Hello, Guest Hello, Cy Hello, Guest\n"},
+		{`type Shape interface {
+	Area() int
+}
+
+type Square struct {
+	side: int
+}
+
+func (s: Square) Area() int {
+	return s.side * s.side
+}
+
+func find(ok: bool) ?int {
+	if ok {
+		return 42
+	}
+	return null
+}
+
+func pick[T any](x: ?T, d: T) T {
+	return x ?: d
+}
+
+func main() {
+	var count: ?int = 0
+	n := find(true)
+	m := find(false)
+	fmt.Println(count ?: 1, n ?: 0, m ?: -1, n != null, m == null)
+
+	var name: ?string = "Ann"
+	alias := name
+	name = null
+	fmt.Println(alias ?: "none", name ?: "none", pick[int](null, 7), pick[string]("q", "r"))
+
+	var shape: ?Shape = Square{3}
+	var items: ?[]string = null
+	fmt.Println((shape ?: Square{1}).Area(), len(items ?: []string{"z"}))
+}`, "0 42 -1 true true\nAnn none 7 q\n9 1\n"},
+		{`func describe(name: ?string) string {
+	switch name {
+	case "Ann":
+		return "ann"
+	case null:
+		return "nobody"
+	default:
+		var s: string = name
+		return s + "!"
+	}
+}
+
+func main() {
+	fmt.Println(describe("Ann"), describe(null), describe("Bob"))
+}`, "ann nobody Bob!\n"},
+		{`func double(n: ?int) int {
+	if n == null {
+		return 0
+	}
+	return n * 2
+}
+
+func main() {
+	var n: ?int = 4
+	var m: ?int = null
+	if n != null && n > 1 {
+		fmt.Println(n + 1)
+	}
+	if m == null || m > 1 {
+		fmt.Println("small")
+	} else {
+		fmt.Println(m)
+	}
+	fmt.Println(double(n), double(m))
+}`, "5\nsmall\n8 0\n"},
+	})
+}
+
+func TestInterfaces(t *testing.T) {
+	runOutputTests(t, []runTest{
+		{"import \"io\"\n\ntype ReadCloser interface {\n\tRead(p: []byte) (int, error)\n\tio.Closer\n}\nfunc main() { fmt.Println() }",
+			"type ReadCloser interface {\n\tio.Closer\n\tRead(p []byte) (int, error)\n}"},
+		{`type Empty interface {}
+func main() { fmt.Println() }`, "type Empty interface{}"},
+	})
+	runRunTests(t, []runTest{
+		{`type Shape interface {
+	Area() int
+}
+
+type Named interface {
+	Shape
+	Name() string
+}
+
+type Square struct {
+	side: int
+}
+
+func (s: Square) Area() int {
+	return s.side * s.side
+}
+
+func (s: Square) Name() string {
+	return "square"
+}
+
+type Circle struct {
+	r: int
+}
+
+func (c: *Circle) Area() int {
+	return 3 * c.r * c.r
+}
+
+func total(shapes: ...Shape) int {
+	sum := 0
+	for _, s := range shapes {
+		sum += s.Area()
+	}
+	return sum
+}
+
+func main() {
+	var n: Named = Square{2}
+	fmt.Println(n.Name(), n.Area(), total(Square{1}, &Circle{2}, n))
+}`, "square 4 17\n"},
+	})
+}
+
+func TestForLoops(t *testing.T) {
+	runRunTests(t, []runTest{
+		{`type IDs []int
+
+func main() {
+	sum := 0
+	for i := 0; i < 5; i++ {
+		if i == 1 {
+			continue
+		}
+		sum += i
+	}
+	n := 1
+	for n < 100 {
+		n *= 3
+	}
+	k := 0
+	for {
+		k++
+		if k == 4 {
+			break
+		}
+	}
+	fmt.Println(sum, n, k)
+
+	ids := IDs{4, 5}
+	for i, id := range ids {
+		fmt.Println(i, id)
+	}
+	for i := range 2 {
+		fmt.Println("tick", i)
+	}
+	ch := make(chan string, 2)
+	ch <- "a"
+	ch <- "b"
+	close(ch)
+	for s := range ch {
+		fmt.Println(s)
+	}
+	for _, r := range "hé" {
+		fmt.Println(r)
+	}
+}`, "9 243 4\n0 4\n1 5\ntick 0\ntick 1\na\nb\n104\n233\n"},
+	})
+}
+
+func TestSwitches(t *testing.T) {
+	runRunTests(t, []runTest{
+		{`func size(x: int) string {
+	switch x {
+	case 0:
+		return "zero"
+	case 1, 2:
+		return "small"
+	}
+	switch {
+	case x < 10:
+		return "medium"
+	default:
+		return "big"
+	}
+}
+
+func describe(x: interface{}) string {
+	switch v := x.(type) {
+	case null:
+		return "null"
+	case int:
+		return "int " + size(v)
+	case string, bool:
+		return "other"
+	}
+	return "unknown"
+}
+
+func main() {
+	for _, x := range []int{0, 2, 5, 50} {
+		switch y := x % 2; y {
+		case 0:
+			fmt.Print("even ")
+			fallthrough
+		case 1:
+			fmt.Println(size(x))
+		}
+	}
+	fmt.Println(describe(null), describe(3), describe("a"), describe(1.5))
+}`, "even zero\neven small\nmedium\neven big\nnull int medium other unknown\n"},
+		{`func greet(name: ?string) string {
+	switch name {
+	case "Ann":
+		return "hi Ann"
+	case null:
+		return "hello stranger"
+	default:
+		return "hello " + name
+	}
+}
+
+func main() {
+	fmt.Println(greet("Ann"), greet(null), greet("Bob"))
+}`, "hi Ann hello stranger hello Bob\n"},
+	})
+}
+
+func TestMultiAssign(t *testing.T) {
+	runRunTests(t, []runTest{
+		{`func divmod(a: int, b: int) (int, int) {
+	return a / b, a % b
+}
+
+func main() {
+	q, r := divmod(7, 2)
+	q, r = r, q
+	m := map[string]int{"a": 1}
+	v, ok := m["a"]
+	w, found := m["b"]
+	var x: interface{} = "s"
+	s, isStr := x.(string)
+	n, isInt := x.(int)
+	xs := []int{0, 0}
+	xs[0], xs[1], _ = 4, 5, 6
+	fmt.Println(q, r, v, ok, w, found, s, isStr, n, isInt, xs)
+}`, "1 3 1 true 0 false s true 0 false [4 5]\n"},
+	})
+}
+
+func TestCompositeLiterals(t *testing.T) {
+	runOutputTests(t, []runTest{
+		{`func main() { xs := [1, 2]; fmt.Println(xs) }`, "xs := []int{1, 2}"},
+		{`func main() { xs := ["a", 1]; fmt.Println(xs) }`, `xs := []interface{}{"a", 1}`},
+	})
+	runRunTests(t, []runTest{
+		{`type Point struct {
+	x: int
+	y: int
+}
+
+type User struct {
+	name: string
+	email: ?string
+}
+
+func main() {
+	pts := []Point{{1, 2}, {x: 3}}
+	m := map[string][]int{"b": {2}, "a": {1}}
+	u := User{name: "ann", email: null}
+	arr := [3]string{"a"}
+	p := &pts[1]
+	*p = Point{y: 4}
+	p.x++
+	fmt.Println(pts, m["a"], m["b"], u.name, u.email == null, len(arr), [1.5, 2.5])
+}`, "[{1 2} {1 4}] [1] [2] ann true 3 [1.5 2.5]\n"},
+	})
+}
+
+func TestGroupedDecls(t *testing.T) {
+	runOutputTests(t, []runTest{
+		{"import (\n\tstr \"strings\"\n\t_ \"embed\"\n)\nfunc main() { fmt.Println(str.ToUpper(\"a\")) }",
+			"import (\n\t_ \"embed\"\n\t\"fmt\"\n\tstr \"strings\"\n)\n"},
+		{"const (\n\tA = iota\n\tB\n)\nfunc main() { fmt.Println(A, B) }", "const (\n\tA = iota\n\tB\n)\n"},
+		{"import `os`\nfunc main() { os.Exit(0) }", "import (\n\t\"os\"\n)\n"},
+		{"import \"a\\tb\"\nfunc main() {}", "import (\n\t\"a\\tb\"\n)\n"},
+	})
+	runRunTests(t, []runTest{
+		{`import (
+	"os"
+	str "strings"
+)
+
+type (
+	ID int
+	Pair struct { a: int }
+)
+
+const (
+	KB = 1 << (10 * (iota + 1))
+	MB
+)
+
+const (
+	Red = iota
+	Green
+	_
+	Blue
+)
+
+var (
+	name: string = "lingo"
+	count = 2
+)
+
+func main() {
+	p := Pair{a: count}
+	os.Stdout.WriteString(str.ToUpper(name) + "\n")
+	fmt.Println(KB, MB, Red, Green, Blue, ID(p.a))
+}`, "LINGO\n1024 1048576 0 1 3 2\n"},
+	})
+}
+
+// TestFmtImport checks that fmt is only imported when the program uses it.
+func TestFmtImport(t *testing.T) {
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{`func main() { fmt.Println(1) }`, true},
+		{`func main() { f := fmt.Sprint; f(1) }`, true},
+		{`func main() { x := 1; x++ }`, false},
+		{"import \"os\"\nfunc main() { os.Exit(0) }", false},
+		{"import \"fmt\"\nfunc main() {}", true},
+		{`type P struct { x: int }
+func main() { fmt := P{x: 1}; fmt.x++ }`, false},
+	}
+	for _, tt := range tests {
+		code := compile(t, tt.src)
+		if got := strings.Contains(code, `"fmt"`); got != tt.want {
+			t.Errorf("%s\nimports fmt = %v, want %v:\n%s", tt.src, got, tt.want, code)
+		}
+	}
+	run(t, compile(t, "import \"os\"\nfunc main() { os.Exit(0) }"))
+}
+
+func TestGenerics(t *testing.T) {
+	runOutputTests(t, []runTest{
+		{"type Pair[K comparable, V any] struct { k: K; v: V }\nfunc main() { fmt.Println(Pair[string, int]{k: \"a\", v: 1}) }",
+			"type Pair[K comparable, V any] struct {"},
+		{"const N = 2\ntype A [N * 2]int\nfunc main() { var a: A; fmt.Println(a) }", "type A [(N * 2)]int"},
+	})
+	runRunTests(t, []runTest{
+		{`type Number interface {
+	~int | ~float64
+}
+
+type Box[T any] struct {
+	v: T
+}
+
+func Map[T, U any](xs: []T, f: func(T) U) []U {
+	out := make([]U, 0, len(xs))
+	for _, x := range xs {
+		out = append(out, f(x))
+	}
+	return out
+}
+
+func Sum[T Number](xs: []T) T {
+	var s: T
+	for _, x := range xs {
+		s += x
+	}
+	return s
+}
+
+const N = 2
+
+type Grid [N * 2]int
+
+func main() {
+	strs := Map([]int{1, 2}, (x: int) -> fmt.Sprint(x * 10))
+	var anys: []any = []interface{}{1, "a"}
+	var g: Grid
+	b := Box[string]{v: "boxed"}
+	fmt.Println(strs, Sum([]float64{1.5, 2}), Map[int, int]([]int{3}, (x: int) -> x + 1), anys, len(g), b.v)
+}`, "[10 20] 3.5 [4] [1 a] 4 boxed\n"},
+	})
+}
+
+func TestChannels(t *testing.T) {
+	runRunTests(t, []runTest{
+		{`func produce(out: chan<- int, n: int) {
+	for i := 0; i < n; i++ {
+		out <- i
+	}
+	close(out)
+}
+
+func main() {
+	ch := make(chan int)
+	go produce(ch, 3)
+	var got: []int
+	for {
+		v, ok := <-ch
+		if !ok {
+			break
+		}
+		got = append(got, v)
+	}
+	got = append(got, []int{7, 8}...)
+
+	buf := make(chan string, 1)
+	for i := 0; i < 3; i++ {
+		select {
+		case buf <- "x":
+			fmt.Println("sent")
+		case s, ok := <-buf:
+			fmt.Println("received", s, ok)
+		default:
+			fmt.Println("idle")
+		}
+	}
+	b := append([]byte{97, 98}, "cd"...)
+	fmt.Println(got, len(got), string(b))
+}`, "sent\nreceived x true\nsent\n[0 1 2 7 8] 5 abcd\n"},
+	})
+}
+
+func TestLabels(t *testing.T) {
+	runRunTests(t, []runTest{
+		{`func find(grid: [][]int, want: int) (int, int) {
+	r, c := -1, -1
+search:
+	for i, row := range grid {
+		for j, v := range row {
+			if v == want {
+				r, c = i, j
+				break search
+			}
+		}
+	}
+	return r, c
+}
+
+func main() {
+	grid := [][]int{{1, 2}, {3, 4}}
+	r, c := find(grid, 3)
+	fmt.Println(r, c)
+	r, c = find(grid, 9)
+	fmt.Println(r, c)
+
+	n := 0
+loop:
+	if n < 3 {
+		n++
+		goto loop
+	}
+
+	odd := 0
+next:
+	for i := 0; i < 6; i++ {
+		switch {
+		case i % 2 == 0:
+			continue next
+		case i == 5:
+			break next
+		}
+		odd++
+	}
+	fmt.Println(n, odd)
+}`, "1 0\n-1 -1\n3 2\n"},
+	})
+}
+
+func TestSelectors(t *testing.T) {
+	runRunTests(t, []runTest{
+		{`import str "strings"
+
+type Node struct {
+	name: string
+	kids: []Node
+}
+
+func (n: Node) First() Node {
+	return n.kids[0]
+}
+
+func (n: *Node) Rename(name: string) *Node {
+	n.name = name
+	return n
+}
+
+func main() {
+	leaf := Node{name: "leaf"}
+	root := Node{name: "root", kids: []Node{{name: "mid", kids: []Node{leaf}}}}
+	fmt.Println(root.First().First().name, root.First().kids[0].name)
+	fmt.Println(str.ToUpper(root.Rename("top").Rename("tree").name), len(root.kids[0].kids))
+}`, "leaf leaf\nTREE 1\n"},
+	})
+}
+
+func TestSliceExprs(t *testing.T) {
+	runRunTests(t, []runTest{
+		{`type IDs []int
+
+func main() {
+	xs := []int{0, 1, 2, 3, 4}
+	var a: [4]string
+	a[1], a[2] = "b", "c"
+	p := &a
+	s := "lingo"
+	ids := IDs{7, 8, 9}
+	head := xs[:2:2]
+	head = append(head, 9)
+	fmt.Println(xs[1:], xs[:2], xs[1:3], xs[:], head, xs[2])
+	fmt.Println(a[1:3], len(p[:2]), s[1:3], s[:1], ids[1:], cap(xs[1:3:4]))
+}`, "[1 2 3 4] [0 1] [1 2] [0 1 2 3 4] [0 1 9] 2\n[b c] 2 in l [8 9] 3\n"},
+	})
+}
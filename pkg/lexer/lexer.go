@@ -0,0 +1,1132 @@
+package lexer
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type TokenType string
+
+const (
+	// Literals
+	TOKEN_INT        TokenType = "INT"
+	TOKEN_FLOAT      TokenType = "FLOAT"
+	TOKEN_IMAG       TokenType = "IMAG"
+	TOKEN_STRING     TokenType = "STRING"
+	TOKEN_RAW_STRING TokenType = "RAW_STRING"
+	TOKEN_CHAR       TokenType = "CHAR"
+	TOKEN_BOOL       TokenType = "BOOL"
+	TOKEN_NULL       TokenType = "NULL"
+
+	// Keywords
+	TOKEN_FUNC        TokenType = "FUNC"
+	TOKEN_VAR         TokenType = "VAR"
+	TOKEN_CONST       TokenType = "CONST"
+	TOKEN_TYPE        TokenType = "TYPE"
+	TOKEN_STRUCT      TokenType = "STRUCT"
+	TOKEN_RETURN      TokenType = "RETURN"
+	TOKEN_IF          TokenType = "IF"
+	TOKEN_ELSE        TokenType = "ELSE"
+	TOKEN_FOR         TokenType = "FOR"
+	TOKEN_RANGE       TokenType = "RANGE"
+	TOKEN_BREAK       TokenType = "BREAK"
+	TOKEN_CONTINUE    TokenType = "CONTINUE"
+	TOKEN_SWITCH      TokenType = "SWITCH"
+	TOKEN_FALLTHROUGH TokenType = "FALLTHROUGH"
+	TOKEN_GOTO        TokenType = "GOTO"
+	TOKEN_PACKAGE     TokenType = "PACKAGE"
+	TOKEN_IMPORT      TokenType = "IMPORT"
+	TOKEN_INTERFACE   TokenType = "INTERFACE"
+	TOKEN_CHAN        TokenType = "CHAN"
+	TOKEN_GO          TokenType = "GO"
+	TOKEN_SELECT      TokenType = "SELECT"
+	TOKEN_CASE        TokenType = "CASE"
+	TOKEN_DEFAULT     TokenType = "DEFAULT"
+	TOKEN_DEFER       TokenType = "DEFER"
+	TOKEN_PANIC       TokenType = "PANIC"
+	TOKEN_RECOVER     TokenType = "RECOVER"
+
+	// Identifiers
+	TOKEN_IDENT TokenType = "IDENT"
+
+	// Operators
+	TOKEN_ASSIGN    TokenType = "="
+	TOKEN_PLUS      TokenType = "+"
+	TOKEN_MINUS     TokenType = "-"
+	TOKEN_MUL       TokenType = "*"
+	TOKEN_DIV       TokenType = "/"
+	TOKEN_MOD       TokenType = "%"
+	TOKEN_EQ        TokenType = "=="
+	TOKEN_NEQ       TokenType = "!="
+	TOKEN_LT        TokenType = "<"
+	TOKEN_LTE       TokenType = "<="
+	TOKEN_GT        TokenType = ">"
+	TOKEN_GTE       TokenType = ">="
+	TOKEN_LAND      TokenType = "&&"
+	TOKEN_LOR       TokenType = "||"
+	TOKEN_LNOT      TokenType = "!"
+	TOKEN_AND       TokenType = "&"
+	TOKEN_OR        TokenType = "|"
+	TOKEN_XOR       TokenType = "^"
+	TOKEN_TILDE     TokenType = "~"
+	TOKEN_LSHIFT    TokenType = "<<"
+	TOKEN_RSHIFT    TokenType = ">>"
+	TOKEN_WALRUS    TokenType = ":="
+	TOKEN_DOT       TokenType = "."
+	TOKEN_COMMA     TokenType = ","
+	TOKEN_COLON     TokenType = ":"
+	TOKEN_SEMICOLON TokenType = ";"
+	TOKEN_ARROW     TokenType = "->"
+	TOKEN_LPAREN    TokenType = "("
+	TOKEN_RPAREN    TokenType = ")"
+	TOKEN_LBRACE    TokenType = "{"
+	TOKEN_RBRACE    TokenType = "}"
+	TOKEN_LBRACKET  TokenType = "["
+	TOKEN_RBRACKET  TokenType = "]"
+
+	// Null-safety operators
+	TOKEN_QUESTION TokenType = "?"  // nullable marker and postfix nullable expression
+	TOKEN_ELVIS    TokenType = "?:" // x ?: fallback
+	TOKEN_SAFE_DOT TokenType = "?." // x?.field
+	TOKEN_NULLISH  TokenType = "??" // x ?? fallback
+
+	// Assignment operators
+	TOKEN_PLUS_ASSIGN    TokenType = "+="
+	TOKEN_MINUS_ASSIGN   TokenType = "-="
+	TOKEN_MUL_ASSIGN     TokenType = "*="
+	TOKEN_DIV_ASSIGN     TokenType = "/="
+	TOKEN_MOD_ASSIGN     TokenType = "%="
+	TOKEN_AND_ASSIGN     TokenType = "&="
+	TOKEN_OR_ASSIGN      TokenType = "|="
+	TOKEN_XOR_ASSIGN     TokenType = "^="
+	TOKEN_LSHIFT_ASSIGN  TokenType = "<<="
+	TOKEN_RSHIFT_ASSIGN  TokenType = ">>="
+	TOKEN_AND_NOT_ASSIGN TokenType = "&^="
+
+	TOKEN_AND_NOT  TokenType = "&^"
+	TOKEN_INC      TokenType = "++"
+	TOKEN_DEC      TokenType = "--"
+	TOKEN_RECV     TokenType = "<-"
+	TOKEN_ELLIPSIS TokenType = "..."
+
+	// Special
+	TOKEN_EOF     TokenType = "EOF"
+	TOKEN_NEWLINE TokenType = "NEWLINE"
+	TOKEN_ILLEGAL TokenType = "ILLEGAL"
+	TOKEN_COMMENT TokenType = "COMMENT"
+)
+
+// Mode controls optional lexer behaviour.
+type Mode uint
+
+const (
+	// ScanComments makes the lexer emit TOKEN_COMMENT tokens holding the
+	// full text of each comment, delimiters included, instead of
+	// discarding them.
+	ScanComments Mode = 1 << iota
+)
+
+const bom = 0xFEFF
+
+// Token is a single lexical unit. Line and Col are 1-based, with Col counted
+// in characters (runes); Offset is the 0-based byte offset into the input.
+type Token struct {
+	Type   TokenType
+	Value  string
+	Line   int
+	Col    int
+	Offset int
+
+	// Position just past the last character of the token.
+	EndLine   int
+	EndCol    int
+	EndOffset int
+}
+
+// Error is a lexical error at a position in the input.
+type Error struct {
+	Line   int
+	Col    int
+	Offset int
+	Msg    string
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Col, e.Msg)
+}
+
+// Lexer turns source text into tokens. Input comes either from memory or
+// from an io.Reader, of which only a window around the current token is
+// buffered, so tokens can be pulled one at a time with NextToken without
+// holding the whole source or token stream in memory.
+type Lexer struct {
+	// Mode may be set before the first token is read.
+	Mode Mode
+
+	src  io.Reader // nil once all input is in buf
+	buf  []byte    // buffered input; buf[0] is at byte offset base
+	base int
+
+	pos     int // byte offset of the current character
+	line    int
+	col     int
+	started bool
+	done    bool    // EOF token emitted
+	pending []Token // scanned tokens not yet returned by NextToken
+	errors  []Error
+
+	// start of the token being scanned
+	startPos  int
+	startLine int
+	startCol  int
+
+	// insertSemi is set when a newline after the last token ends a statement.
+	insertSemi bool
+}
+
+// readChunk is how much is read from an io.Reader at a time.
+const readChunk = 4096
+
+func New(input string) *Lexer {
+	return NewBytes([]byte(input))
+}
+
+// NewBytes returns a Lexer over src, which must not be modified while the
+// lexer is in use.
+func NewBytes(src []byte) *Lexer {
+	return &Lexer{
+		buf:  src,
+		line: 1,
+		col:  1,
+	}
+}
+
+// NewReader returns a Lexer that reads its input from r on demand.
+func NewReader(r io.Reader) *Lexer {
+	return &Lexer{
+		src:  r,
+		line: 1,
+		col:  1,
+	}
+}
+
+// Errors returns the lexical errors found so far, in source order.
+func (l *Lexer) Errors() []Error {
+	return l.errors
+}
+
+func (l *Lexer) errorAt(line, col, offset int, format string, args ...interface{}) {
+	l.errors = append(l.errors, Error{Line: line, Col: col, Offset: offset, Msg: fmt.Sprintf(format, args...)})
+}
+
+// errorf reports an error at the current position.
+func (l *Lexer) errorf(format string, args ...interface{}) {
+	l.errorAt(l.line, l.col, l.pos, format, args...)
+}
+
+// tokenErrorf reports an error at the start of the token being scanned.
+func (l *Lexer) tokenErrorf(format string, args ...interface{}) {
+	l.errorAt(l.startLine, l.startCol, l.startPos, format, args...)
+}
+
+// Tokenize reads all remaining tokens, up to and including TOKEN_EOF.
+func (l *Lexer) Tokenize() []Token {
+	tokens := []Token{}
+	for {
+		tok := l.NextToken()
+		tokens = append(tokens, tok)
+		if tok.Type == TOKEN_EOF {
+			return tokens
+		}
+	}
+}
+
+// NextToken returns the next token of the input. Once the input is
+// exhausted it keeps returning TOKEN_EOF.
+func (l *Lexer) NextToken() Token {
+	for len(l.pending) == 0 {
+		if l.done {
+			return Token{
+				Type: TOKEN_EOF, Line: l.line, Col: l.col, Offset: l.pos,
+				EndLine: l.line, EndCol: l.col, EndOffset: l.pos,
+			}
+		}
+		l.scan()
+	}
+	tok := l.pending[0]
+	l.pending = l.pending[:copy(l.pending, l.pending[1:])]
+	return tok
+}
+
+// scan reads the next token from the input, along with any semicolons or
+// comments preceding it.
+func (l *Lexer) scan() {
+	if !l.started {
+		l.started = true
+		// A byte order mark is only permitted as the very first character.
+		if r, size := l.decode(0); r == bom {
+			l.pos += size
+		}
+	}
+
+	l.skipWhitespaceAndComments()
+
+	l.startToken()
+	if !l.more() {
+		if l.insertSemi {
+			l.addToken(TOKEN_SEMICOLON, "\n")
+		}
+		l.addToken(TOKEN_EOF, "")
+		l.done = true
+		return
+	}
+
+	ch := l.current()
+
+	if isLetter(ch) {
+		l.readIdentifierOrKeyword()
+	} else if isDecimal(ch) || ch == '.' && isDecimal(l.peek(1)) {
+		l.readNumber()
+	} else if ch == '"' {
+		l.readString()
+	} else if ch == '`' {
+		l.readRawString()
+	} else if ch == '\'' {
+		l.readChar()
+	} else {
+		l.readOperator()
+	}
+}
+
+// fill makes sure the buffer holds the input up to byte offset pos plus a
+// full UTF-8 sequence, reading more from the source if needed.
+func (l *Lexer) fill(pos int) {
+	for l.src != nil && pos+utf8.UTFMax > l.base+len(l.buf) {
+		chunk := make([]byte, readChunk)
+		n, err := l.src.Read(chunk)
+		l.buf = append(l.buf, chunk[:n]...)
+		if err != nil {
+			if err != io.EOF {
+				l.errorf("read error: %v", err)
+			}
+			l.src = nil
+		}
+	}
+}
+
+// discard drops buffered input before byte offset pos once it is no longer
+// needed, keeping memory bounded when reading from an io.Reader.
+func (l *Lexer) discard(pos int) {
+	n := pos - l.base
+	if l.src == nil || n < readChunk || n < len(l.buf)/2 {
+		return
+	}
+	l.buf = l.buf[:copy(l.buf, l.buf[n:])]
+	l.base = pos
+}
+
+// more reports whether there is input left at the current position.
+func (l *Lexer) more() bool {
+	l.fill(l.pos)
+	return l.pos < l.base+len(l.buf)
+}
+
+// text returns the input from byte offset start up to the current position.
+func (l *Lexer) text(start int) string {
+	return string(l.buf[start-l.base : l.pos-l.base])
+}
+
+// decode returns the rune starting at byte offset pos and its width in bytes.
+func (l *Lexer) decode(pos int) (rune, int) {
+	l.fill(pos)
+	i := pos - l.base
+	if i >= len(l.buf) {
+		return 0, 0
+	}
+	if c := l.buf[i]; c < utf8.RuneSelf {
+		return rune(c), 1
+	}
+	return utf8.DecodeRune(l.buf[i:])
+}
+
+func (l *Lexer) current() rune {
+	r, _ := l.decode(l.pos)
+	return r
+}
+
+// peek returns the rune n characters ahead of the current one.
+func (l *Lexer) peek(n int) rune {
+	pos := l.pos
+	for i := 0; i < n; i++ {
+		_, size := l.decode(pos)
+		if size == 0 {
+			return 0
+		}
+		pos += size
+	}
+	r, _ := l.decode(pos)
+	return r
+}
+
+func (l *Lexer) advance() {
+	r, size := l.decode(l.pos)
+	if size == 0 {
+		return
+	}
+	if msg := encodingError(r, size); msg != "" {
+		l.errorf("%s", msg)
+	}
+	if r == '\n' {
+		l.line++
+		l.col = 1
+	} else {
+		l.col++
+	}
+	l.pos += size
+}
+
+func (l *Lexer) startToken() {
+	l.discard(l.pos)
+	l.startPos = l.pos
+	l.startLine = l.line
+	l.startCol = l.col
+}
+
+func (l *Lexer) addToken(typ TokenType, value string) {
+	l.pending = append(l.pending, Token{
+		Type:   typ,
+		Value:  value,
+		Line:   l.startLine,
+		Col:    l.startCol,
+		Offset: l.startPos,
+
+		EndLine:   l.line,
+		EndCol:    l.col,
+		EndOffset: l.pos,
+	})
+	// Comments are transparent to semicolon insertion.
+	if typ != TOKEN_COMMENT {
+		l.insertSemi = endsStatement(typ)
+	}
+}
+
+// endsStatement reports whether a line ending after a token of type typ
+// terminates the statement, following Go's automatic semicolon rules.
+func endsStatement(typ TokenType) bool {
+	switch typ {
+	case TOKEN_IDENT, TOKEN_INT, TOKEN_FLOAT, TOKEN_IMAG, TOKEN_STRING, TOKEN_RAW_STRING,
+		TOKEN_CHAR, TOKEN_BOOL, TOKEN_NULL, TOKEN_RETURN, TOKEN_RECOVER, TOKEN_BREAK, TOKEN_CONTINUE, TOKEN_FALLTHROUGH,
+		TOKEN_RPAREN, TOKEN_RBRACKET, TOKEN_RBRACE, TOKEN_INC, TOKEN_DEC, TOKEN_QUESTION:
+		return true
+	}
+	return false
+}
+
+// insertSemicolon emits an automatic semicolon at the current position if
+// the previous token ended a statement. Its value is "\n" to distinguish it
+// from one written in the source.
+func (l *Lexer) insertSemicolon() {
+	if l.insertSemi {
+		l.startToken()
+		l.addToken(TOKEN_SEMICOLON, "\n")
+	}
+}
+
+// encodingError describes why the rune r of width size may not appear in
+// source text at all, or returns "" if it may.
+func encodingError(r rune, size int) string {
+	switch {
+	case r == utf8.RuneError && size == 1:
+		return "invalid UTF-8 encoding"
+	case r == 0:
+		return "invalid character NUL"
+	case r == bom:
+		return "invalid BOM in the middle of the file"
+	}
+	return ""
+}
+
+func isLetter(ch rune) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' ||
+		ch >= utf8.RuneSelf && unicode.IsLetter(ch)
+}
+
+func isDigit(ch rune) bool {
+	return isDecimal(ch) || ch >= utf8.RuneSelf && unicode.IsDigit(ch)
+}
+
+func isDecimal(ch rune) bool {
+	return '0' <= ch && ch <= '9'
+}
+
+func (l *Lexer) skipWhitespaceAndComments() {
+	for l.more() {
+		ch := l.current()
+
+		if ch == ' ' || ch == '\t' || ch == '\r' {
+			l.advance()
+		} else if ch == '\n' {
+			l.insertSemicolon()
+			l.advance()
+		} else if ch == '/' && l.peek(1) == '/' {
+			l.startToken()
+			if l.Mode&ScanComments != 0 {
+				// The comment runs to the end of the line, so any
+				// semicolon due there belongs in front of it.
+				l.insertSemicolon()
+			}
+			for l.more() && l.current() != '\n' {
+				l.advance()
+			}
+			l.addComment()
+		} else if ch == '/' && l.peek(1) == '*' {
+			// A block comment spanning lines acts like a newline.
+			l.startToken()
+			line := l.line
+			l.advance()
+			l.advance()
+			terminated := false
+			for l.more() {
+				if l.current() == '*' && l.peek(1) == '/' {
+					l.advance()
+					l.advance()
+					terminated = true
+					break
+				}
+				l.advance()
+			}
+			if !terminated {
+				l.tokenErrorf("comment not terminated")
+			}
+			if l.line > line && l.insertSemi {
+				l.addToken(TOKEN_SEMICOLON, "\n")
+			}
+			l.addComment()
+		} else {
+			break
+		}
+	}
+}
+
+// addComment emits the comment scanned since the token start when comments
+// are being kept.
+func (l *Lexer) addComment() {
+	if l.Mode&ScanComments == 0 {
+		return
+	}
+	text := strings.TrimSuffix(l.text(l.startPos), "\r")
+	l.addToken(TOKEN_COMMENT, text)
+}
+
+func (l *Lexer) readIdentifierOrKeyword() {
+	start := l.pos
+
+	for l.more() && (isLetter(l.current()) || isDigit(l.current())) {
+		l.advance()
+	}
+
+	value := l.text(start)
+
+	// Check if it's a keyword
+	typ := TOKEN_IDENT
+	switch value {
+	case "func":
+		typ = TOKEN_FUNC
+	case "var":
+		typ = TOKEN_VAR
+	case "const":
+		typ = TOKEN_CONST
+	case "type":
+		typ = TOKEN_TYPE
+	case "struct":
+		typ = TOKEN_STRUCT
+	case "return":
+		typ = TOKEN_RETURN
+	case "if":
+		typ = TOKEN_IF
+	case "else":
+		typ = TOKEN_ELSE
+	case "for":
+		typ = TOKEN_FOR
+	case "range":
+		typ = TOKEN_RANGE
+	case "break":
+		typ = TOKEN_BREAK
+	case "continue":
+		typ = TOKEN_CONTINUE
+	case "switch":
+		typ = TOKEN_SWITCH
+	case "fallthrough":
+		typ = TOKEN_FALLTHROUGH
+	case "goto":
+		typ = TOKEN_GOTO
+	case "package":
+		typ = TOKEN_PACKAGE
+	case "import":
+		typ = TOKEN_IMPORT
+	case "interface":
+		typ = TOKEN_INTERFACE
+	case "chan":
+		typ = TOKEN_CHAN
+	case "go":
+		typ = TOKEN_GO
+	case "select":
+		typ = TOKEN_SELECT
+	case "case":
+		typ = TOKEN_CASE
+	case "default":
+		typ = TOKEN_DEFAULT
+	case "defer":
+		typ = TOKEN_DEFER
+	case "panic":
+		typ = TOKEN_PANIC
+	case "recover":
+		typ = TOKEN_RECOVER
+	case "true", "false":
+		typ = TOKEN_BOOL
+	case "null":
+		typ = TOKEN_NULL
+	}
+
+	l.addToken(typ, value)
+}
+
+// readNumber scans any Go numeric literal: decimal, legacy octal and
+// 0x/0o/0b prefixed integers, decimal and hexadecimal floats, digit
+// separators and the imaginary suffix. The literal text is kept verbatim;
+// the parser is responsible for evaluating it.
+func (l *Lexer) readNumber() {
+	start := l.pos
+	typ := TOKEN_INT
+	base := 10
+
+	if l.current() != '.' {
+		if l.current() == '0' {
+			switch lower(l.peek(1)) {
+			case 'x':
+				base = 16
+			case 'o':
+				base = 8
+			case 'b':
+				base = 2
+			}
+			if base != 10 {
+				l.advance()
+				l.advance()
+			}
+		}
+	}
+
+	digits := l.skipDigits(base)
+
+	if l.current() == '.' && (base == 10 || base == 16) {
+		typ = TOKEN_FLOAT
+		l.advance()
+		digits += l.skipDigits(base)
+	}
+
+	if base != 10 && digits == 0 {
+		l.tokenErrorf("%s literal has no digits", baseName(base))
+	}
+
+	if e := lower(l.current()); e == 'e' && base == 10 || e == 'p' && base == 16 {
+		typ = TOKEN_FLOAT
+		l.advance()
+		if l.current() == '+' || l.current() == '-' {
+			l.advance()
+		}
+		if l.skipDigits(10) == 0 {
+			l.errorf("exponent has no digits")
+		}
+	} else if base == 16 && typ == TOKEN_FLOAT {
+		l.errorf("hexadecimal mantissa requires a 'p' exponent")
+	}
+
+	if l.current() == 'i' {
+		typ = TOKEN_IMAG
+		l.advance()
+	}
+
+	lit := l.text(start)
+	l.checkDigits(lit, base, typ)
+	if i := invalidSep(lit); i >= 0 {
+		l.errorAt(l.startLine, l.startCol+i, l.startPos+i, "'_' must separate successive digits")
+	}
+
+	l.addToken(typ, lit)
+}
+
+func baseName(base int) string {
+	switch base {
+	case 2:
+		return "binary"
+	case 8:
+		return "octal"
+	case 16:
+		return "hexadecimal"
+	}
+	return "decimal"
+}
+
+// checkDigits reports the first digit of lit that is not valid in base.
+// Integers with a plain leading zero are octal.
+func (l *Lexer) checkDigits(lit string, base int, typ TokenType) {
+	i := 0
+	if base != 10 {
+		i = 2 // skip prefix
+	} else if typ == TOKEN_INT && len(lit) > 1 && lit[0] == '0' {
+		base = 8
+	}
+	if base == 10 || base == 16 {
+		return
+	}
+	for ; i < len(lit); i++ {
+		if d := rune(lit[i]); isDecimal(d) && int(d-'0') >= base {
+			l.errorAt(l.startLine, l.startCol+i, l.startPos+i, "invalid digit %q in %s literal", d, baseName(base))
+			return
+		}
+	}
+}
+
+// invalidSep returns the index of the first misplaced '_' in a numeric
+// literal, or -1 if every separator sits between digits or after a base
+// prefix.
+func invalidSep(lit string) int {
+	x1 := ' ' // prefix char, we only care if it's 'x'
+	d := '.'  // previous char class: '_', '0' (a digit) or '.' (anything else)
+	i := 0
+
+	// a prefix counts as a digit
+	if len(lit) >= 2 && lit[0] == '0' {
+		x1 = lower(rune(lit[1]))
+		if x1 == 'x' || x1 == 'o' || x1 == 'b' {
+			d = '0'
+			i = 2
+		}
+	}
+
+	for ; i < len(lit); i++ {
+		p := d
+		d = rune(lit[i])
+		switch {
+		case d == '_':
+			if p != '0' {
+				return i
+			}
+		case isDecimal(d) || x1 == 'x' && digitVal(d) < 16:
+			d = '0'
+		default:
+			if p == '_' {
+				return i - 1
+			}
+			d = '.'
+		}
+	}
+	if d == '_' {
+		return len(lit) - 1
+	}
+	return -1
+}
+
+// skipDigits consumes digits valid in the given base along with '_'
+// separators and returns the number of digits seen. Binary and octal
+// literals accept any decimal digit so that a stray 8 or 9 ends up in the
+// literal and is reported by checkDigits.
+func (l *Lexer) skipDigits(base int) int {
+	n := 0
+	for {
+		ch := l.current()
+		if isDecimal(ch) || base == 16 && 'a' <= lower(ch) && lower(ch) <= 'f' {
+			n++
+		} else if ch != '_' {
+			return n
+		}
+		l.advance()
+	}
+}
+
+func lower(ch rune) rune {
+	return ('a' - 'A') | ch
+}
+
+// readString scans an interpreted string literal. The token value is the
+// decoded string with all escape sequences resolved.
+func (l *Lexer) readString() {
+	l.advance() // Skip opening quote
+	var value strings.Builder
+
+	for l.more() && l.current() != '"' && l.current() != '\n' {
+		if l.current() == '\\' {
+			r, isByte, ok := l.readEscape('"')
+			if !ok {
+				continue
+			}
+			if isByte {
+				value.WriteByte(byte(r))
+			} else {
+				value.WriteRune(r)
+			}
+			continue
+		}
+		value.WriteRune(l.current())
+		l.advance()
+	}
+
+	if l.current() == '"' {
+		l.advance() // Skip closing quote
+	} else {
+		l.tokenErrorf("string literal not terminated")
+	}
+
+	l.addToken(TOKEN_STRING, value.String())
+}
+
+// readRawString scans a backquoted string. Raw strings may span lines and
+// take their contents verbatim, except that carriage returns are discarded
+// as in Go.
+func (l *Lexer) readRawString() {
+	l.advance() // Skip opening backquote
+	var value strings.Builder
+
+	for l.more() && l.current() != '`' {
+		if l.current() != '\r' {
+			value.WriteRune(l.current())
+		}
+		l.advance()
+	}
+
+	if l.current() == '`' {
+		l.advance() // Skip closing backquote
+	} else {
+		l.tokenErrorf("raw string literal not terminated")
+	}
+
+	l.addToken(TOKEN_RAW_STRING, value.String())
+}
+
+// readChar scans a rune literal. The token value is the UTF-8 encoding of
+// the decoded rune.
+func (l *Lexer) readChar() {
+	l.advance() // Skip opening quote
+	var value strings.Builder
+	n := 0
+
+	for l.more() && l.current() != '\'' && l.current() != '\n' {
+		n++
+		if l.current() == '\\' {
+			if r, _, ok := l.readEscape('\''); ok {
+				value.WriteRune(r)
+			}
+			continue
+		}
+		value.WriteRune(l.current())
+		l.advance()
+	}
+
+	if l.current() == '\'' {
+		l.advance() // Skip closing quote
+		if n == 0 {
+			l.tokenErrorf("empty rune literal or unescaped ' in rune literal")
+		} else if n > 1 {
+			l.tokenErrorf("more than one character in rune literal")
+		}
+	} else {
+		l.tokenErrorf("rune literal not terminated")
+	}
+
+	l.addToken(TOKEN_CHAR, value.String())
+}
+
+var simpleEscapes = map[rune]rune{
+	'a': '\a', 'b': '\b', 'f': '\f', 'n': '\n', 'r': '\r', 't': '\t', 'v': '\v', '\\': '\\',
+}
+
+// readEscape decodes the escape sequence starting at the current backslash.
+// quote is the delimiter of the enclosing literal, the only quote that may
+// be escaped. isByte reports a \x or octal escape, which denotes a single
+// byte inside strings rather than a UTF-8 encoded rune. On a malformed
+// escape ok is false and the offending characters are left unconsumed.
+func (l *Lexer) readEscape(quote rune) (r rune, isByte bool, ok bool) {
+	line, col, offset := l.line, l.col, l.pos
+	l.advance() // Skip backslash
+	ch := l.current()
+
+	if esc, found := simpleEscapes[ch]; found {
+		l.advance()
+		return esc, false, true
+	}
+	if ch == quote {
+		l.advance()
+		return quote, false, true
+	}
+
+	var n int
+	var base, max uint32
+	switch {
+	case '0' <= ch && ch <= '7':
+		n, base, max, isByte = 3, 8, 255, true
+	case ch == 'x':
+		l.advance()
+		n, base, max, isByte = 2, 16, 255, true
+	case ch == 'u':
+		l.advance()
+		n, base, max = 4, 16, unicode.MaxRune
+	case ch == 'U':
+		l.advance()
+		n, base, max = 8, 16, unicode.MaxRune
+	default:
+		if !l.more() || ch == '\n' {
+			l.errorAt(line, col, offset, "escape sequence not terminated")
+		} else {
+			l.errorAt(line, col, offset, "unknown escape sequence")
+		}
+		return 0, false, false
+	}
+
+	var x uint32
+	for i := 0; i < n; i++ {
+		d := uint32(digitVal(l.current()))
+		if d >= base {
+			if !l.more() || l.current() == quote || l.current() == '\n' {
+				l.errorAt(line, col, offset, "escape sequence not terminated")
+			} else {
+				l.errorf("illegal character %#U in escape sequence", l.current())
+			}
+			return 0, false, false
+		}
+		x = x*base + d
+		l.advance()
+	}
+
+	if x > max || !isByte && 0xD800 <= x && x < 0xE000 {
+		l.errorAt(line, col, offset, "escape sequence is invalid Unicode code point")
+		return 0, false, false
+	}
+	return rune(x), isByte, true
+}
+
+func digitVal(ch rune) int {
+	switch {
+	case '0' <= ch && ch <= '9':
+		return int(ch - '0')
+	case 'a' <= lower(ch) && lower(ch) <= 'f':
+		return int(lower(ch) - 'a' + 10)
+	}
+	return 16 // larger than any legal digit
+}
+
+// addOperator consumes the characters of the operator op and emits it.
+func (l *Lexer) addOperator(typ TokenType, op string) {
+	for range op {
+		l.advance()
+	}
+	l.addToken(typ, op)
+}
+
+func (l *Lexer) readOperator() {
+	ch := l.current()
+
+	// Three-character operators
+	switch string([]rune{ch, l.peek(1), l.peek(2)}) {
+	case "<<=":
+		l.addOperator(TOKEN_LSHIFT_ASSIGN, "<<=")
+		return
+	case ">>=":
+		l.addOperator(TOKEN_RSHIFT_ASSIGN, ">>=")
+		return
+	case "&^=":
+		l.addOperator(TOKEN_AND_NOT_ASSIGN, "&^=")
+		return
+	case "...":
+		l.addOperator(TOKEN_ELLIPSIS, "...")
+		return
+	}
+
+	// Two-character operators
+	if l.peek(1) != 0 {
+		twoChar := string([]rune{ch, l.peek(1)})
+		switch twoChar {
+		case "+=":
+			l.addOperator(TOKEN_PLUS_ASSIGN, "+=")
+			return
+		case "-=":
+			l.addOperator(TOKEN_MINUS_ASSIGN, "-=")
+			return
+		case "*=":
+			l.addOperator(TOKEN_MUL_ASSIGN, "*=")
+			return
+		case "/=":
+			l.addOperator(TOKEN_DIV_ASSIGN, "/=")
+			return
+		case "%=":
+			l.addOperator(TOKEN_MOD_ASSIGN, "%=")
+			return
+		case "&=":
+			l.addOperator(TOKEN_AND_ASSIGN, "&=")
+			return
+		case "|=":
+			l.addOperator(TOKEN_OR_ASSIGN, "|=")
+			return
+		case "^=":
+			l.addOperator(TOKEN_XOR_ASSIGN, "^=")
+			return
+		case "&^":
+			l.addOperator(TOKEN_AND_NOT, "&^")
+			return
+		case "++":
+			l.addOperator(TOKEN_INC, "++")
+			return
+		case "--":
+			l.addOperator(TOKEN_DEC, "--")
+			return
+		case "<-":
+			l.addOperator(TOKEN_RECV, "<-")
+			return
+		case "?:":
+			l.addOperator(TOKEN_ELVIS, "?:")
+			return
+		case "?.":
+			l.addOperator(TOKEN_SAFE_DOT, "?.")
+			return
+		case "??":
+			l.addOperator(TOKEN_NULLISH, "??")
+			return
+		case "==":
+			l.advance()
+			l.advance()
+			l.addToken(TOKEN_EQ, "==")
+			return
+		case "!=":
+			l.advance()
+			l.advance()
+			l.addToken(TOKEN_NEQ, "!=")
+			return
+		case "<=":
+			l.advance()
+			l.advance()
+			l.addToken(TOKEN_LTE, "<=")
+			return
+		case ">=":
+			l.advance()
+			l.advance()
+			l.addToken(TOKEN_GTE, ">=")
+			return
+		case "&&":
+			l.advance()
+			l.advance()
+			l.addToken(TOKEN_LAND, "&&")
+			return
+		case "||":
+			l.advance()
+			l.advance()
+			l.addToken(TOKEN_LOR, "||")
+			return
+		case ":=":
+			l.advance()
+			l.advance()
+			l.addToken(TOKEN_WALRUS, ":=")
+			return
+		case "->":
+			l.advance()
+			l.advance()
+			l.addToken(TOKEN_ARROW, "->")
+			return
+		case "<<":
+			l.advance()
+			l.advance()
+			l.addToken(TOKEN_LSHIFT, "<<")
+			return
+		case ">>":
+			l.advance()
+			l.advance()
+			l.addToken(TOKEN_RSHIFT, ">>")
+			return
+		}
+	}
+
+	// Single-character operators
+	switch ch {
+	case '+':
+		l.advance()
+		l.addToken(TOKEN_PLUS, "+")
+	case '-':
+		l.advance()
+		l.addToken(TOKEN_MINUS, "-")
+	case '*':
+		l.advance()
+		l.addToken(TOKEN_MUL, "*")
+	case '/':
+		l.advance()
+		l.addToken(TOKEN_DIV, "/")
+	case '%':
+		l.advance()
+		l.addToken(TOKEN_MOD, "%")
+	case '=':
+		l.advance()
+		l.addToken(TOKEN_ASSIGN, "=")
+	case '<':
+		l.advance()
+		l.addToken(TOKEN_LT, "<")
+	case '>':
+		l.advance()
+		l.addToken(TOKEN_GT, ">")
+	case '!':
+		l.advance()
+		l.addToken(TOKEN_LNOT, "!")
+	case '&':
+		l.advance()
+		l.addToken(TOKEN_AND, "&")
+	case '|':
+		l.advance()
+		l.addToken(TOKEN_OR, "|")
+	case '^':
+		l.advance()
+		l.addToken(TOKEN_XOR, "^")
+	case '~':
+		l.advance()
+		l.addToken(TOKEN_TILDE, "~")
+	case '.':
+		l.advance()
+		l.addToken(TOKEN_DOT, ".")
+	case ',':
+		l.advance()
+		l.addToken(TOKEN_COMMA, ",")
+	case ':':
+		l.advance()
+		l.addToken(TOKEN_COLON, ":")
+	case ';':
+		l.advance()
+		l.addToken(TOKEN_SEMICOLON, ";")
+	case '(':
+		l.advance()
+		l.addToken(TOKEN_LPAREN, "(")
+	case ')':
+		l.advance()
+		l.addToken(TOKEN_RPAREN, ")")
+	case '{':
+		l.advance()
+		l.addToken(TOKEN_LBRACE, "{")
+	case '}':
+		l.advance()
+		l.addToken(TOKEN_RBRACE, "}")
+	case '[':
+		l.advance()
+		l.addToken(TOKEN_LBRACKET, "[")
+	case ']':
+		l.advance()
+		l.addToken(TOKEN_RBRACKET, "]")
+	case '?':
+		l.advance()
+		l.addToken(TOKEN_QUESTION, "?")
+	default:
+		// advance itself reports malformed encodings
+		if r, size := l.decode(l.pos); encodingError(r, size) == "" {
+			l.errorf("invalid character %#U", ch)
+		}
+		l.advance()
+		l.addToken(TOKEN_ILLEGAL, string(ch))
+	}
+}
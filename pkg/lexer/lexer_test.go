@@ -0,0 +1,340 @@
+package lexer
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// format renders tokens compactly for comparison: the token type, followed
+// by the quoted value when it differs from the type's own spelling. The
+// final EOF is left out.
+func format(tokens []Token) string {
+	var parts []string
+	for _, tok := range tokens {
+		if tok.Type == TOKEN_EOF {
+			break
+		}
+		if tok.Value == string(tok.Type) {
+			parts = append(parts, string(tok.Type))
+		} else {
+			parts = append(parts, fmt.Sprintf("%s(%q)", tok.Type, tok.Value))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// checkTokens lexes each source and compares the tokens with want. It
+// fails on any lexical error.
+func checkTokens(t *testing.T, tests []struct{ src, want string }) {
+	t.Helper()
+	for _, tt := range tests {
+		lex := New(tt.src)
+		got := format(lex.Tokenize())
+		if errs := lex.Errors(); len(errs) > 0 {
+			t.Errorf("%q: unexpected errors %v", tt.src, errs)
+		}
+		if got != tt.want {
+			t.Errorf("%q:\n got %s\nwant %s", tt.src, got, tt.want)
+		}
+	}
+}
+
+// checkErrors lexes each source and compares its first error with want.
+func checkErrors(t *testing.T, tests []struct{ src, want string }) {
+	t.Helper()
+	for _, tt := range tests {
+		lex := New(tt.src)
+		lex.Tokenize()
+		errs := lex.Errors()
+		if len(errs) == 0 {
+			t.Errorf("%q: no error, want %q", tt.src, tt.want)
+			continue
+		}
+		if got := errs[0].Error(); got != tt.want {
+			t.Errorf("%q: got error %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestUnicodeIdentifiers(t *testing.T) {
+	checkTokens(t, []struct{ src, want string }{
+		{`café`, `IDENT("café") ;("\n")`},
+		{`π := 3`, `IDENT("π") := INT("3") ;("\n")`},
+		{`日本語 = x`, `IDENT("日本語") = IDENT("x") ;("\n")`},
+		{`_x1 x_ÿ`, `IDENT("_x1") IDENT("x_ÿ") ;("\n")`},
+		{`a١٢`, `IDENT("a١٢") ;("\n")`},
+		{`"naïve 日本"`, `STRING("naïve 日本") ;("\n")`},
+		{"\uFEFFpackage main", `PACKAGE("package") IDENT("main") ;("\n")`},
+	})
+}
+
+func TestUnicodeErrors(t *testing.T) {
+	checkErrors(t, []struct{ src, want string }{
+		{"x := \xff", "1:6: invalid UTF-8 encoding"},
+		{"x := 1\x00", "1:7: invalid character NUL"},
+		{"x \uFEFF", "1:3: invalid BOM in the middle of the file"},
+		{"x := €", "1:6: invalid character U+20AC '€'"},
+	})
+}
+
+func TestPositions(t *testing.T) {
+	type pos struct{ line, col, offset int }
+	tests := []struct {
+		src  string
+		want []pos
+	}{
+		{"a b", []pos{{1, 1, 0}, {1, 3, 2}}},
+		{"é ü", []pos{{1, 1, 0}, {1, 3, 3}}},
+		{"日本 x", []pos{{1, 1, 0}, {1, 4, 7}}},
+		{"\"ä\" y", []pos{{1, 1, 0}, {1, 5, 5}}},
+		{"a\n  ö", []pos{{1, 1, 0}, {1, 2, 1}, {2, 3, 4}}},
+	}
+	for _, tt := range tests {
+		tokens := New(tt.src).Tokenize()
+		for i, want := range tt.want {
+			if i >= len(tokens) {
+				t.Errorf("%q: missing token %d", tt.src, i)
+				break
+			}
+			got := pos{tokens[i].Line, tokens[i].Col, tokens[i].Offset}
+			if got != want {
+				t.Errorf("%q: token %d (%s) at %v, want %v", tt.src, i, tokens[i].Type, got, want)
+			}
+		}
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	checkTokens(t, []struct{ src, want string }{
+		{`42 0 0755`, `INT("42") INT("0") INT("0755") ;("\n")`},
+		{`0xFF 0X_1f`, `INT("0xFF") INT("0X_1f") ;("\n")`},
+		{`0b1010 0B_1`, `INT("0b1010") INT("0B_1") ;("\n")`},
+		{`0o755 0O17`, `INT("0o755") INT("0O17") ;("\n")`},
+		{`1_000_000`, `INT("1_000_000") ;("\n")`},
+		{`1.5 1. .5 1e9 1E-9 2.5e+3`, `FLOAT("1.5") FLOAT("1.") FLOAT(".5") FLOAT("1e9") FLOAT("1E-9") FLOAT("2.5e+3") ;("\n")`},
+		{`0x1p-2 0x1.8p1 0X.8P0`, `FLOAT("0x1p-2") FLOAT("0x1.8p1") FLOAT("0X.8P0") ;("\n")`},
+		{`2i 0i 1.5e+3i 0x1p2i 0.i`, `IMAG("2i") IMAG("0i") IMAG("1.5e+3i") IMAG("0x1p2i") IMAG("0.i") ;("\n")`},
+		{`x.y 1..2`, `IDENT("x") . IDENT("y") FLOAT("1.") FLOAT(".2") ;("\n")`},
+	})
+}
+
+func TestNumberErrors(t *testing.T) {
+	checkErrors(t, []struct{ src, want string }{
+		{`0x`, "1:1: hexadecimal literal has no digits"},
+		{`0b`, "1:1: binary literal has no digits"},
+		{`0o`, "1:1: octal literal has no digits"},
+		{`0b102`, "1:5: invalid digit '2' in binary literal"},
+		{`0o8`, "1:3: invalid digit '8' in octal literal"},
+		{`09`, "1:2: invalid digit '9' in octal literal"},
+		{`1e`, "1:3: exponent has no digits"},
+		{`0x1.5`, "1:6: hexadecimal mantissa requires a 'p' exponent"},
+		{`1__0`, "1:3: '_' must separate successive digits"},
+		{`1_`, "1:2: '_' must separate successive digits"},
+	})
+}
+
+func TestStringsAndRunes(t *testing.T) {
+	checkTokens(t, []struct{ src, want string }{
+		{`"hello"`, `STRING("hello") ;("\n")`},
+		{`"a\tb\n"`, `STRING("a\tb\n") ;("\n")`},
+		{`"\x41\101é\U0001F600"`, `STRING("AAé😀") ;("\n")`},
+		{`"\"\\"`, `STRING("\"\\") ;("\n")`},
+		{"`a\\nb`", `RAW_STRING("a\\nb") ;("\n")`},
+		{"`line 1\nline 2`", `RAW_STRING("line 1\nline 2") ;("\n")`},
+		{"`a\r\nb`", `RAW_STRING("a\nb") ;("\n")`},
+		{`'a'`, `CHAR("a") ;("\n")`},
+		{`'\n' '\'' '\x41' 'é' 'é'`, `CHAR("\n") CHAR("'") CHAR("A") CHAR("é") CHAR("é") ;("\n")`},
+	})
+}
+
+func TestStringErrors(t *testing.T) {
+	checkErrors(t, []struct{ src, want string }{
+		{`"abc`, "1:1: string literal not terminated"},
+		{"\"a\nb\"", "1:1: string literal not terminated"},
+		{"`abc", "1:1: raw string literal not terminated"},
+		{`''`, "1:1: empty rune literal or unescaped ' in rune literal"},
+		{`'ab'`, "1:1: more than one character in rune literal"},
+		{`'a`, "1:1: rune literal not terminated"},
+		{`"\q"`, "1:2: unknown escape sequence"},
+		{`"\x4"`, "1:2: escape sequence not terminated"},
+		{`"\x4g"`, "1:5: illegal character U+0067 'g' in escape sequence"},
+		{`"\uD800"`, "1:2: escape sequence is invalid Unicode code point"},
+		{`'\"'`, "1:2: unknown escape sequence"},
+	})
+}
+
+func TestSemicolonInsertion(t *testing.T) {
+	checkTokens(t, []struct{ src, want string }{
+		{"x\ny", `IDENT("x") ;("\n") IDENT("y") ;("\n")`},
+		{"x;y", `IDENT("x") ; IDENT("y") ;("\n")`},
+		{"return\nx", `RETURN("return") ;("\n") IDENT("x") ;("\n")`},
+		{"break\ncontinue\nfallthrough\n", `BREAK("break") ;("\n") CONTINUE("continue") ;("\n") FALLTHROUGH("fallthrough") ;("\n")`},
+		{"f()\n", `IDENT("f") ( ) ;("\n")`},
+		{"a[0]\n}\n", `IDENT("a") [ INT("0") ] ;("\n") } ;("\n")`},
+		{"x++\ny--\n", `IDENT("x") ++ ;("\n") IDENT("y") -- ;("\n")`},
+		{"1 2.0 3i 'c' \"s\" `r`\n", `INT("1") FLOAT("2.0") IMAG("3i") CHAR("c") STRING("s") RAW_STRING("r") ;("\n")`},
+		{"true\nnull\n", `BOOL("true") ;("\n") NULL("null") ;("\n")`},
+		{"x +\ny", `IDENT("x") + IDENT("y") ;("\n")`},
+		{"f(a,\nb)", `IDENT("f") ( IDENT("a") , IDENT("b") ) ;("\n")`},
+		{"x // comment\ny", `IDENT("x") ;("\n") IDENT("y") ;("\n")`},
+		{"x /* a\nb */ y", `IDENT("x") ;("\n") IDENT("y") ;("\n")`},
+		{"x /* a */ y", `IDENT("x") IDENT("y") ;("\n")`},
+		{"func f() {\n}\n", `FUNC("func") IDENT("f") ( ) { } ;("\n")`},
+		{"\n\n", ``},
+	})
+}
+
+func TestIllegalCharacters(t *testing.T) {
+	tests := []struct {
+		src    string
+		tokens string
+		errs   []string
+	}{
+		{"x @ y", `IDENT("x") ILLEGAL("@") IDENT("y") ;("\n")`, []string{"1:3: invalid character U+0040 '@'"}},
+		{"$a", `ILLEGAL("$") IDENT("a") ;("\n")`, []string{"1:1: invalid character U+0024 '$'"}},
+		{"# \\", `ILLEGAL("#") ILLEGAL("\\")`, []string{"1:1: invalid character U+0023 '#'", "1:3: invalid character U+005C '\\'"}},
+		{"a\n  /* open", `IDENT("a") ;("\n")`, []string{"2:3: comment not terminated"}},
+		{"x := \"open\ny", `IDENT("x") := STRING("open") ;("\n") IDENT("y") ;("\n")`, []string{"1:6: string literal not terminated"}},
+	}
+	for _, tt := range tests {
+		lex := New(tt.src)
+		if got := format(lex.Tokenize()); got != tt.tokens {
+			t.Errorf("%q:\n got %s\nwant %s", tt.src, got, tt.tokens)
+		}
+		var errs []string
+		for _, e := range lex.Errors() {
+			errs = append(errs, e.Error())
+		}
+		if strings.Join(errs, "\n") != strings.Join(tt.errs, "\n") {
+			t.Errorf("%q: got errors %q, want %q", tt.src, errs, tt.errs)
+		}
+	}
+}
+
+func TestScanComments(t *testing.T) {
+	tests := []struct{ src, want string }{
+		{"// doc\nx", `COMMENT("// doc") IDENT("x") ;("\n")`},
+		{"x // line\ny", `IDENT("x") ;("\n") COMMENT("// line") IDENT("y") ;("\n")`},
+		{"x /* a */ y", `IDENT("x") COMMENT("/* a */") IDENT("y") ;("\n")`},
+		{"/* a\nb */", `COMMENT("/* a\nb */")`},
+		{"x // end", `IDENT("x") ;("\n") COMMENT("// end")`},
+	}
+	for _, tt := range tests {
+		lex := New(tt.src)
+		lex.Mode = ScanComments
+		if got := format(lex.Tokenize()); got != tt.want {
+			t.Errorf("%q:\n got %s\nwant %s", tt.src, got, tt.want)
+		}
+	}
+
+	// Without the mode comments are skipped.
+	if got := format(New("x // line\ny").Tokenize()); got != `IDENT("x") ;("\n") IDENT("y") ;("\n")` {
+		t.Errorf("comments kept without ScanComments: %s", got)
+	}
+}
+
+func TestReaderInput(t *testing.T) {
+	srcs := []string{
+		"package main\n\nfunc main() {\n\tx := \"héllo, 世界\"\n}\n",
+		"// comment\nx := `raw\nstring` + 'é' // trailing\n",
+		"a := 0x1p-2 + 1_000\n",
+		"x := \"open",
+	}
+	for _, src := range srcs {
+		want := New(src)
+		want.Mode = ScanComments
+		wantTokens := want.Tokenize()
+
+		// One byte at a time splits multi-byte characters across reads.
+		readers := []*Lexer{
+			NewBytes([]byte(src)),
+			NewReader(strings.NewReader(src)),
+			NewReader(iotest.OneByteReader(strings.NewReader(src))),
+		}
+		for i, lex := range readers {
+			lex.Mode = ScanComments
+			if got := lex.Tokenize(); !reflect.DeepEqual(got, wantTokens) {
+				t.Errorf("%q: lexer %d:\n got %s\nwant %s", src, i, format(got), format(wantTokens))
+			}
+			if !reflect.DeepEqual(lex.Errors(), want.Errors()) {
+				t.Errorf("%q: lexer %d: got errors %v, want %v", src, i, lex.Errors(), want.Errors())
+			}
+		}
+	}
+}
+
+func TestNextToken(t *testing.T) {
+	lex := New("x y")
+	for _, want := range []TokenType{TOKEN_IDENT, TOKEN_IDENT, TOKEN_SEMICOLON, TOKEN_EOF, TOKEN_EOF} {
+		if tok := lex.NextToken(); tok.Type != want {
+			t.Fatalf("got %s, want %s", tok.Type, want)
+		}
+	}
+}
+
+func TestReaderMemory(t *testing.T) {
+	line := "x := \"some text\" // comment\n"
+	src := strings.Repeat(line, 10000)
+	lex := NewReader(strings.NewReader(src))
+	n := 0
+	for tok := lex.NextToken(); tok.Type != TOKEN_EOF; tok = lex.NextToken() {
+		n++
+		if len(lex.buf) > 4*readChunk {
+			t.Fatalf("buffer grew to %d bytes after %d tokens", len(lex.buf), n)
+		}
+	}
+	if n != 40000 {
+		t.Errorf("got %d tokens, want 40000", n)
+	}
+}
+
+func TestReaderError(t *testing.T) {
+	lex := NewReader(iotest.TimeoutReader(strings.NewReader("x y z")))
+	lex.Tokenize()
+	errs := lex.Errors()
+	if len(errs) != 1 || errs[0].Msg != "read error: "+iotest.ErrTimeout.Error() {
+		t.Errorf("got errors %v, want a read error", errs)
+	}
+}
+
+func TestOperators(t *testing.T) {
+	checkTokens(t, []struct{ src, want string }{
+		{`+= -= *= /= %=`, `+= -= *= /= %=`},
+		{`&= |= ^= <<= >>= &^=`, `&= |= ^= <<= >>= &^=`},
+		{`& &^ && | || ^ ~`, `& &^ && | || ^ ~`},
+		{`x++ y--`, `IDENT("x") ++ IDENT("y") -- ;("\n")`},
+		{`ch <- v <-ch`, `IDENT("ch") <- IDENT("v") <- IDENT("ch") ;("\n")`},
+		{`a<-b`, `IDENT("a") <- IDENT("b") ;("\n")`},
+		{`f(xs...)`, `IDENT("f") ( IDENT("xs") ... ) ;("\n")`},
+		{`a.b ..`, `IDENT("a") . IDENT("b") . .`},
+		{`< <= << > >= >> = == ! != := ->`, `< <= << > >= >> = == ! != := ->`},
+	})
+}
+
+func TestNullSafetyOperators(t *testing.T) {
+	checkTokens(t, []struct{ src, want string }{
+		{`var x: ?string`, `VAR("var") IDENT("x") : ? IDENT("string") ;("\n")`},
+		{`a ?: b`, `IDENT("a") ?: IDENT("b") ;("\n")`},
+		{`a ? : b`, `IDENT("a") ? : IDENT("b") ;("\n")`},
+		{`a?.b`, `IDENT("a") ?. IDENT("b") ;("\n")`},
+		{`a ?? b`, `IDENT("a") ?? IDENT("b") ;("\n")`},
+		{`a???.b`, `IDENT("a") ?? ?. IDENT("b") ;("\n")`},
+		{`x?`, `IDENT("x") ? ;("\n")`},
+		{`c ? .5 : 1`, `IDENT("c") ? FLOAT(".5") : INT("1") ;("\n")`},
+	})
+}
+
+func TestBranchKeywords(t *testing.T) {
+	checkTokens(t, []struct{ src, want string }{
+		{`break`, `BREAK("break") ;("\n")`},
+		{`continue`, `CONTINUE("continue") ;("\n")`},
+		{`fallthrough`, `FALLTHROUGH("fallthrough") ;("\n")`},
+		{`goto L`, `GOTO("goto") IDENT("L") ;("\n")`},
+		{`break outer`, `BREAK("break") IDENT("outer") ;("\n")`},
+		{`L: x++`, `IDENT("L") : IDENT("x") ++ ;("\n")`},
+		{`breaks`, `IDENT("breaks") ;("\n")`},
+	})
+}
@@ -1,97 +1,248 @@
 package parser
 
+import (
+	"fmt"
+	"go/constant"
+	"strconv"
+	"strings"
+)
+
+// ASTNode is implemented by every node of the syntax tree. Pos is the
+// position of the node's first character and End the position just past
+// its last.
 type ASTNode interface {
+	Pos() Pos
+	End() Pos
 	astNode()
 }
 
+// Pos is a location in a source file. Line and Col are 1-based, with Col
+// counted in characters; Offset is a 0-based byte offset.
+type Pos struct {
+	File   string
+	Offset int
+	Line   int
+	Col    int
+}
+
+// IsValid reports whether the position was set by the parser.
+func (p Pos) IsValid() bool { return p.Line > 0 }
+
+// String returns "file:line:col", or "line:col" when the file is unnamed.
+func (p Pos) String() string {
+	s := fmt.Sprintf("%d:%d", p.Line, p.Col)
+	if p.File != "" {
+		s = p.File + ":" + s
+	}
+	return s
+}
+
+// Span is embedded in every node to record its extent.
+type Span struct {
+	From Pos
+	To   Pos
+}
+
+func (s Span) Pos() Pos { return s.From }
+func (s Span) End() Pos { return s.To }
+
 type Program struct {
-	Items []ASTNode
+	Span
+	Items    []ASTNode
+	Comments []*CommentGroup // all comments in the file, in source order
 }
 
 func (p *Program) astNode() {}
 
+// Comment is a single // or /* */ comment; Text includes the delimiters.
+type Comment struct {
+	Text   string
+	Line   int
+	Col    int
+	Offset int
+}
+
+// CommentGroup is a run of comments with no blank line or other token
+// between them.
+type CommentGroup struct {
+	List []*Comment
+}
+
+// Text returns the text of the comment group with comment delimiters,
+// leading "//" spaces and surrounding blank lines removed.
+func (g *CommentGroup) Text() string {
+	if g == nil {
+		return ""
+	}
+	var lines []string
+	for _, c := range g.List {
+		text := c.Text
+		if strings.HasPrefix(text, "//") {
+			text = strings.TrimPrefix(text[2:], " ")
+		} else {
+			text = strings.TrimSuffix(strings.TrimPrefix(text, "/*"), "*/")
+		}
+		for _, line := range strings.Split(text, "\n") {
+			lines = append(lines, strings.TrimRight(line, " \t"))
+		}
+	}
+	for len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
 type PackageDecl struct {
-	Name string
+	Span
+	Name    string
+	Doc     *CommentGroup
+	Comment *CommentGroup
 }
 
 func (p *PackageDecl) astNode() {}
 
 type ImportDecl struct {
-	Path  string
-	Alias string
+	Span
+	Path    string
+	Alias   string
+	Doc     *CommentGroup
+	Comment *CommentGroup
 }
 
 func (i *ImportDecl) astNode() {}
 
 type FuncDecl struct {
-	Name    string
-	Receiver *Param
-	Params  []*Param
-	Returns []string
-	Body    []ASTNode
+	Span
+	Name       string
+	TypeParams []*TypeParam
+	Receiver   *Param
+	Params     []*Param
+	Returns    []TypeExpr
+	Body       []ASTNode
+	Doc        *CommentGroup
+	Comment    *CommentGroup
 }
 
 func (f *FuncDecl) astNode() {}
 
+// TypeParam is a type parameter of a generic function or type. Those
+// declared together, as in [K, V any], share one Constraint.
+type TypeParam struct {
+	Span
+	Name       string
+	Constraint TypeExpr
+}
+
+// Param is a parameter; for a variadic one Type is the element type.
 type Param struct {
-	Name string
-	Type string
+	Span
+	Name     string
+	Type     TypeExpr
+	Variadic bool
 }
 
 type VarDecl struct {
-	Name         string
-	Type         string
-	Value        ASTNode
-	IsNullable   bool
-	Initializer  ASTNode
+	Span
+	Name        string
+	Type        TypeExpr
+	Value       ASTNode
+	IsNullable  bool
+	Initializer ASTNode
+	Doc         *CommentGroup
+	Comment     *CommentGroup
 }
 
 func (v *VarDecl) astNode() {}
 
+// ConstDecl is a constant. In a group Value is nil when the constant
+// repeats the type and value of the one before it, and Iota is the
+// constant's index in the group.
 type ConstDecl struct {
-	Name  string
-	Type  string
-	Value ASTNode
+	Span
+	Name    string
+	Type    TypeExpr
+	Value   ASTNode
+	Iota    int
+	Doc     *CommentGroup
+	Comment *CommentGroup
 }
 
 func (c *ConstDecl) astNode() {}
 
+// GenDecl is a parenthesised group of import, const, var or type
+// declarations. Tok is the keyword, and each spec is the node the
+// declaration would be on its own.
+type GenDecl struct {
+	Span
+	Tok     string
+	Specs   []ASTNode
+	Doc     *CommentGroup
+	Comment *CommentGroup
+}
+
+func (g *GenDecl) astNode() {}
+
 type StructDecl struct {
-	Name   string
-	Fields []*StructField
+	Span
+	Name       string
+	TypeParams []*TypeParam
+	Fields     []*StructField
+	Doc        *CommentGroup
+	Comment    *CommentGroup
 }
 
 func (s *StructDecl) astNode() {}
 
+// StructField is a struct field; Name is empty for an embedded field.
 type StructField struct {
+	Span
 	Name       string
-	Type       string
+	Type       TypeExpr
 	IsNullable bool
 	Tag        string
+	Doc        *CommentGroup
+	Comment    *CommentGroup
 }
 
 type InterfaceDecl struct {
-	Name    string
-	Methods []*Param
+	Span
+	Name       string
+	TypeParams []*TypeParam
+	Methods    []*InterfaceMethod
+	Embeds     []TypeExpr // embedded interfaces and, in constraints, type unions
+	Doc        *CommentGroup
+	Comment    *CommentGroup
 }
 
 func (i *InterfaceDecl) astNode() {}
 
 type TypeDecl struct {
-	Name  string
-	Type  string
+	Span
+	Name       string
+	TypeParams []*TypeParam
+	Type       TypeExpr
 	IsNullable bool
+	Doc        *CommentGroup
+	Comment    *CommentGroup
 }
 
 func (t *TypeDecl) astNode() {}
 
 type ReturnStmt struct {
+	Span
 	Values []ASTNode
 }
 
 func (r *ReturnStmt) astNode() {}
 
 type IfStmt struct {
+	Span
 	Condition ASTNode
 	Then      []ASTNode
 	Else      []ASTNode
@@ -100,6 +251,7 @@ type IfStmt struct {
 func (i *IfStmt) astNode() {}
 
 type ForStmt struct {
+	Span
 	Init      ASTNode
 	Condition ASTNode
 	Post      ASTNode
@@ -108,45 +260,124 @@ type ForStmt struct {
 
 func (f *ForStmt) astNode() {}
 
+// ForRangeStmt is for Key, Value := range Expr. Key and Value are empty
+// when omitted; Define is false when they are assigned with = instead.
 type ForRangeStmt struct {
-	Key   string
-	Value string
-	Expr  ASTNode
-	Body  []ASTNode
+	Span
+	Key    string
+	Value  string
+	Define bool
+	Expr   ASTNode
+	Body   []ASTNode
 }
 
 func (f *ForRangeStmt) astNode() {}
 
+// BranchStmt is break, continue, goto or fallthrough. Label is empty
+// when no label is given.
+type BranchStmt struct {
+	Span
+	Tok   string
+	Label string
+}
+
+func (b *BranchStmt) astNode() {}
+
+// LabeledStmt is a statement preceded by a label. Stmt is nil when the
+// label is on an empty statement.
+type LabeledStmt struct {
+	Span
+	Label string
+	Stmt  ASTNode
+}
+
+func (l *LabeledStmt) astNode() {}
+
+// SwitchStmt is an expression switch; Tag is nil for a tagless switch.
+type SwitchStmt struct {
+	Span
+	Init ASTNode
+	Tag  ASTNode
+	Body []*CaseClause
+}
+
+func (s *SwitchStmt) astNode() {}
+
+// TypeSwitchStmt is switch Binding := X.(type); Binding is empty when no
+// variable is declared.
+type TypeSwitchStmt struct {
+	Span
+	Init    ASTNode
+	Binding string
+	X       ASTNode
+	Body    []*CaseClause
+}
+
+func (s *TypeSwitchStmt) astNode() {}
+
+// CaseClause is a case of a switch; List is nil for the default clause.
+// In a type switch List holds TypeExpr nodes and LiteralNull.
+type CaseClause struct {
+	Span
+	List []ASTNode
+	Body []ASTNode
+}
+
+func (c *CaseClause) astNode() {}
+
+// AssignStmt is a plain or compound assignment; Op is "=" or an
+// operator-assignment such as "+=" or "&^=". Each Lhs element is an
+// Identifier (possibly _), an IndexExpr, a selector or a dereference.
 type AssignStmt struct {
-	Name  string
-	Value ASTNode
+	Span
+	Lhs []ASTNode
+	Op  string
+	Rhs []ASTNode
 }
 
 func (a *AssignStmt) astNode() {}
 
+// IncDecStmt is x++ or x--.
+type IncDecStmt struct {
+	Span
+	X  ASTNode
+	Op string
+}
+
+func (i *IncDecStmt) astNode() {}
+
+// ShortAssignStmt is a, b := x, y.
 type ShortAssignStmt struct {
-	Name  string
-	Value ASTNode
+	Span
+	Lhs []*Identifier
+	Rhs []ASTNode
 }
 
 func (s *ShortAssignStmt) astNode() {}
 
+// CallExpr calls Fun, which may be any expression of function type: a
+// name, a selector, a function literal or another call.
 type CallExpr struct {
-	Func string
-	Args []ASTNode
+	Span
+	Fun      ASTNode
+	Args     []ASTNode
+	Ellipsis bool
 }
 
 func (c *CallExpr) astNode() {}
 
-type MethodCall struct {
-	Receiver string
-	Method   string
-	Args     []ASTNode
+// SelectorExpr is X.Sel: a field, a method, or a name from another
+// package.
+type SelectorExpr struct {
+	Span
+	X   ASTNode
+	Sel *Identifier
 }
 
-func (m *MethodCall) astNode() {}
+func (s *SelectorExpr) astNode() {}
 
 type BinaryOp struct {
+	Span
 	Left  ASTNode
 	Op    string
 	Right ASTNode
@@ -155,97 +386,206 @@ type BinaryOp struct {
 func (b *BinaryOp) astNode() {}
 
 type UnaryOp struct {
+	Span
 	Op    string
 	Right ASTNode
 }
 
 func (u *UnaryOp) astNode() {}
 
+// LiteralInt is an integer literal. Value keeps the source spelling
+// (prefix, digit separators) so it can be emitted unchanged; Const holds
+// the exact value.
 type LiteralInt struct {
+	Span
 	Value string
+	Base  int
+	Const constant.Value
 }
 
 func (l *LiteralInt) astNode() {}
 
 type LiteralFloat struct {
+	Span
 	Value string
+	Base  int
+	Const constant.Value
 }
 
 func (l *LiteralFloat) astNode() {}
 
+type LiteralImag struct {
+	Span
+	Value string
+	Base  int
+	Const constant.Value
+}
+
+func (l *LiteralImag) astNode() {}
+
+// LiteralString holds the decoded contents of a string literal. Raw records
+// that it was written with backquotes.
 type LiteralString struct {
+	Span
 	Value string
+	Raw   bool
 }
 
 func (l *LiteralString) astNode() {}
 
+type LiteralChar struct {
+	Span
+	Value rune
+}
+
+func (l *LiteralChar) astNode() {}
+
 type LiteralBool struct {
+	Span
 	Value bool
 }
 
 func (l *LiteralBool) astNode() {}
 
-type LiteralNull struct{}
+type LiteralNull struct {
+	Span
+}
 
 func (l *LiteralNull) astNode() {}
 
 type Identifier struct {
+	Span
 	Name string
 }
 
 func (i *Identifier) astNode() {}
 
 type NullableExpr struct {
+	Span
 	Expr ASTNode
 }
 
 func (n *NullableExpr) astNode() {}
 
+// NullCheckExpr is x ?: fallback or x ?? fallback; Op records which was
+// written. Both yield Expr unless it is null.
 type NullCheckExpr struct {
+	Span
 	Expr        ASTNode
+	Op          string
 	DefaultExpr ASTNode
 }
 
 func (n *NullCheckExpr) astNode() {}
 
+// SafeNavExpr is x?.Field, which is null when x is null.
+type SafeNavExpr struct {
+	Span
+	Expr  ASTNode
+	Field string
+}
+
+func (s *SafeNavExpr) astNode() {}
+
+// FuncLit is an anonymous function, either func(x: int) int { ... } or
+// the arrow form (x: int) -> x * 2, whose body is a single return of the
+// expression. An arrow function without a result type returns the type
+// the typechecker infers for its expression.
+type FuncLit struct {
+	Span
+	Type  *FuncType
+	Body  []ASTNode
+	Arrow bool
+}
+
+func (f *FuncLit) astNode() {}
+
+// TypeAssertExpr is x.(T); Type is nil for x.(type) in a type switch.
+type TypeAssertExpr struct {
+	Span
+	Expr ASTNode
+	Type TypeExpr
+}
+
+func (t *TypeAssertExpr) astNode() {}
+
 type IndexExpr struct {
+	Span
 	Expr  ASTNode
 	Index ASTNode
 }
 
 func (i *IndexExpr) astNode() {}
 
+// InstanceExpr instantiates a generic function or type with explicit type
+// arguments, as in Map[int, string]. A single argument that could also be
+// an index, as in Max[int], is parsed as an IndexExpr instead.
+type InstanceExpr struct {
+	Span
+	Expr     ASTNode
+	TypeArgs []TypeExpr
+}
+
+func (i *InstanceExpr) astNode() {}
+
+// SliceExpr is Expr[Low:High], or Expr[Low:High:Max] when Slice3 is set.
+// Omitted indices are nil.
 type SliceExpr struct {
-	Expr  ASTNode
-	Start ASTNode
-	End   ASTNode
+	Span
+	Expr   ASTNode
+	Low    ASTNode
+	High   ASTNode
+	Max    ASTNode
+	Slice3 bool
 }
 
 func (s *SliceExpr) astNode() {}
 
+// MapLiteral is map[K]V{k: v, ...}, with entries in source order. The
+// key and value types are nil for the untyped {k: v} form.
 type MapLiteral struct {
-	KeyType   string
-	ValueType string
-	Pairs     map[string]ASTNode
+	Span
+	KeyType   TypeExpr
+	ValueType TypeExpr
+	Entries   []*KeyValueExpr
 }
 
 func (m *MapLiteral) astNode() {}
 
+// ArrayLiteral is []T{...}, [N]T{...} or the untyped [a, b] form, whose
+// element type the typechecker fills in when the elements agree.
 type ArrayLiteral struct {
-	Type     string
+	Span
+	Type     TypeExpr // element type
+	Len      ASTNode  // nil for a slice
 	Elements []ASTNode
 }
 
 func (a *ArrayLiteral) astNode() {}
 
+// StructLiteral is T{name: value, ...} or T{value, ...}; the Key of each
+// field is an Identifier, or nil when fields are given by position.
 type StructLiteral struct {
-	Type   string
-	Fields map[string]ASTNode
+	Span
+	Type   TypeExpr
+	Fields []*KeyValueExpr
 }
 
 func (s *StructLiteral) astNode() {}
 
+// KeyValueExpr is an element key: value of a composite literal.
+type KeyValueExpr struct {
+	Span
+	Key   ASTNode
+	Value ASTNode
+}
+
+func (k *KeyValueExpr) astNode() {}
+
+// ChanOp is a channel send (Expr <- Value) when Value is set, and a
+// receive (<-Expr) otherwise.
 type ChanOp struct {
+	Span
 	Op    string
 	Expr  ASTNode
 	Value ASTNode
@@ -254,34 +594,317 @@ type ChanOp struct {
 func (c *ChanOp) astNode() {}
 
 type GoStmt struct {
+	Span
 	Call *CallExpr
 }
 
 func (g *GoStmt) astNode() {}
 
 type SelectStmt struct {
+	Span
 	Cases []*SelectCase
 }
 
 func (s *SelectStmt) astNode() {}
 
+// SelectCase is a case of a select. Comm is a send, a receive or an
+// assignment from a receive, and nil for the default case.
 type SelectCase struct {
-	ChanOp *ChanOp
-	Body   []ASTNode
+	Span
+	Comm ASTNode
+	Body []ASTNode
 }
 
+func (s *SelectCase) astNode() {}
+
 type DeferStmt struct {
+	Span
 	Call *CallExpr
 }
 
 func (d *DeferStmt) astNode() {}
 
 type PanicStmt struct {
+	Span
 	Expr ASTNode
 }
 
 func (p *PanicStmt) astNode() {}
 
-type RecoverExpr struct{}
+type RecoverExpr struct {
+	Span
+}
 
 func (r *RecoverExpr) astNode() {}
+
+// BadDecl, BadStmt and BadExpr stand in for constructs that could not be
+// parsed, covering the source that was skipped.
+type BadDecl struct {
+	Span
+}
+
+func (b *BadDecl) astNode() {}
+
+type BadStmt struct {
+	Span
+}
+
+func (b *BadStmt) astNode() {}
+
+type BadExpr struct {
+	Span
+}
+
+func (b *BadExpr) astNode() {}
+
+// TypeExpr is a type written in the source. String renders it in Go
+// syntax, except that nullable types keep their leading "?".
+type TypeExpr interface {
+	ASTNode
+	String() string
+	typeExpr()
+}
+
+// IdentType is a named type such as int or Point.
+type IdentType struct {
+	Span
+	Name string
+}
+
+// QualifiedType is a type exported by another package, such as time.Time.
+type QualifiedType struct {
+	Span
+	Package string
+	Name    string
+}
+
+type PointerType struct {
+	Span
+	Elem TypeExpr
+}
+
+type SliceType struct {
+	Span
+	Elem TypeExpr
+}
+
+type ArrayType struct {
+	Span
+	Len  ASTNode
+	Elem TypeExpr
+}
+
+// MapType is map[K]V, also written {K}V.
+type MapType struct {
+	Span
+	Key   TypeExpr
+	Value TypeExpr
+}
+
+type ChanDir int
+
+const (
+	ChanBoth ChanDir = iota // chan T
+	ChanSend                // chan<- T
+	ChanRecv                // <-chan T
+)
+
+type ChanType struct {
+	Span
+	Dir  ChanDir
+	Elem TypeExpr
+}
+
+// FuncType is a function signature; parameter names are optional.
+type FuncType struct {
+	Span
+	Params  []*Param
+	Results []TypeExpr
+}
+
+type StructType struct {
+	Span
+	Fields []*StructField
+}
+
+// InterfaceType lists the methods of an interface and the interfaces it
+// embeds.
+type InterfaceType struct {
+	Span
+	Methods []*InterfaceMethod
+	Embeds  []TypeExpr
+}
+
+type InterfaceMethod struct {
+	Span
+	Name    string
+	Type    *FuncType
+	Doc     *CommentGroup
+	Comment *CommentGroup
+}
+
+// NullableType is ?T or T?.
+type NullableType struct {
+	Span
+	Elem TypeExpr
+}
+
+// GenericType instantiates a generic type, as in List[int].
+type GenericType struct {
+	Span
+	Base TypeExpr
+	Args []TypeExpr
+}
+
+// UnionType is a union of type terms in a constraint, as in ~int | string.
+type UnionType struct {
+	Span
+	Terms []TypeExpr
+}
+
+// TildeType is ~T, which stands for every type whose underlying type is T.
+type TildeType struct {
+	Span
+	Elem TypeExpr
+}
+
+func (t *IdentType) typeExpr()     {}
+func (t *QualifiedType) typeExpr() {}
+func (t *PointerType) typeExpr()   {}
+func (t *SliceType) typeExpr()     {}
+func (t *ArrayType) typeExpr()     {}
+func (t *MapType) typeExpr()       {}
+func (t *ChanType) typeExpr()      {}
+func (t *FuncType) typeExpr()      {}
+func (t *StructType) typeExpr()    {}
+func (t *InterfaceType) typeExpr() {}
+func (t *NullableType) typeExpr()  {}
+func (t *GenericType) typeExpr()   {}
+func (t *UnionType) typeExpr()     {}
+func (t *TildeType) typeExpr()     {}
+
+func (t *IdentType) astNode()     {}
+func (t *QualifiedType) astNode() {}
+func (t *PointerType) astNode()   {}
+func (t *SliceType) astNode()     {}
+func (t *ArrayType) astNode()     {}
+func (t *MapType) astNode()       {}
+func (t *ChanType) astNode()      {}
+func (t *FuncType) astNode()      {}
+func (t *StructType) astNode()    {}
+func (t *InterfaceType) astNode() {}
+func (t *NullableType) astNode()  {}
+func (t *GenericType) astNode()   {}
+func (t *UnionType) astNode()     {}
+func (t *TildeType) astNode()     {}
+
+func (t *IdentType) String() string     { return t.Name }
+func (t *QualifiedType) String() string { return t.Package + "." + t.Name }
+func (t *PointerType) String() string   { return "*" + t.Elem.String() }
+func (t *SliceType) String() string     { return "[]" + t.Elem.String() }
+func (t *NullableType) String() string  { return "?" + t.Elem.String() }
+func (t *TildeType) String() string     { return "~" + t.Elem.String() }
+
+func (t *ArrayType) String() string {
+	n := "?"
+	switch l := t.Len.(type) {
+	case *LiteralInt:
+		n = l.Value
+	case *Identifier:
+		n = l.Name
+	}
+	return "[" + n + "]" + t.Elem.String()
+}
+
+func (t *MapType) String() string {
+	return "map[" + t.Key.String() + "]" + t.Value.String()
+}
+
+func (t *ChanType) String() string {
+	switch t.Dir {
+	case ChanSend:
+		return "chan<- " + t.Elem.String()
+	case ChanRecv:
+		return "<-chan " + t.Elem.String()
+	}
+	if t.RecvElem() {
+		return "chan (" + t.Elem.String() + ")"
+	}
+	return "chan " + t.Elem.String()
+}
+
+// RecvElem reports whether t is a bidirectional channel of receive-only
+// channels, whose element type must be parenthesised: chan <-chan T would
+// read as chan<- (chan T).
+func (t *ChanType) RecvElem() bool {
+	elem, ok := t.Elem.(*ChanType)
+	return ok && t.Dir == ChanBoth && elem.Dir == ChanRecv
+}
+
+func (t *FuncType) String() string {
+	return "func" + t.signature()
+}
+
+// signature renders the parameter and result lists of t.
+func (t *FuncType) signature() string {
+	params := make([]string, len(t.Params))
+	for i, param := range t.Params {
+		params[i] = param.Type.String()
+		if param.Variadic {
+			params[i] = "..." + params[i]
+		}
+	}
+	s := "(" + strings.Join(params, ", ") + ")"
+	switch len(t.Results) {
+	case 0:
+		return s
+	case 1:
+		return s + " " + t.Results[0].String()
+	}
+	return s + " (" + typeList(t.Results) + ")"
+}
+
+func (t *StructType) String() string {
+	fields := make([]string, len(t.Fields))
+	for i, f := range t.Fields {
+		fields[i] = f.Type.String()
+		if f.Name != "" {
+			fields[i] = f.Name + " " + fields[i]
+		}
+		if f.Tag != "" {
+			fields[i] += " " + strconv.Quote(f.Tag)
+		}
+	}
+	return "struct{" + strings.Join(fields, "; ") + "}"
+}
+
+func (t *InterfaceType) String() string {
+	var elems []string
+	for _, e := range t.Embeds {
+		elems = append(elems, e.String())
+	}
+	for _, m := range t.Methods {
+		elems = append(elems, m.Name+m.Type.signature())
+	}
+	return "interface{" + strings.Join(elems, "; ") + "}"
+}
+
+func (t *GenericType) String() string {
+	return t.Base.String() + "[" + typeList(t.Args) + "]"
+}
+
+func (t *UnionType) String() string {
+	terms := make([]string, len(t.Terms))
+	for i, term := range t.Terms {
+		terms[i] = term.String()
+	}
+	return strings.Join(terms, " | ")
+}
+
+func typeList(types []TypeExpr) string {
+	s := make([]string, len(types))
+	for i, t := range types {
+		s[i] = t.String()
+	}
+	return strings.Join(s, ", ")
+}
@@ -0,0 +1,127 @@
+package parser
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/MistyPigeon/lingo/pkg/lexer"
+)
+
+func TestPrintError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{
+			ErrorList{
+				{Pos: Pos{Line: 1, Col: 2}, Msg: "first"},
+				{Pos: Pos{File: "a.lingo", Line: 3, Col: 4}, Msg: "second"},
+			},
+			"1:2: first\na.lingo:3:4: second\n",
+		},
+		{ErrorList{}, ""},
+		{errors.New("boom"), "Parse error: boom\n"},
+	}
+	for _, tt := range tests {
+		var buf strings.Builder
+		PrintError(&buf, tt.err)
+		if got := buf.String(); got != tt.want {
+			t.Errorf("PrintError(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestIllegalTokens(t *testing.T) {
+	runErrorTests(t, []parseTest{
+		{"func f() {\nx := @\n}", "2:6: expected expression, got ILLEGAL"},
+		{"func f() {\nx := 1 # 2\n}", "2:8: expected ; or newline, got ILLEGAL"},
+	})
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		src   string
+		errs  []string
+		items string // dump of the partial program
+	}{
+		{
+			"func f() {\n\tx := )\n\ty := 1\n\tz = = 2\n}\n\nfunc g( {\n}\n\nvar ok: int = 1\n",
+			[]string{
+				"2:7: expected expression, got )",
+				"4:6: expected expression, got =",
+				"7:9: expected parameter name, got {",
+			},
+			`[FuncDecl{Name: "f", Body: [ShortAssignStmt{Lhs: [x], Rhs: [BadExpr{}]}, BadStmt{}, ` +
+				`ShortAssignStmt{Lhs: [y], Rhs: [LiteralInt{Value: "1", Base: 10, Const: 1}]}, AssignStmt{Lhs: [z], Op: "=", Rhs: [BadExpr{}]}]}, ` +
+				`FuncDecl{Name: "g"}, ` +
+				`VarDecl{Name: "ok", Type: int, Value: LiteralInt{Value: "1", Base: 10, Const: 1}}]`,
+		},
+		{
+			"@@@\nfunc f() {}\n",
+			[]string{"1:1: expected declaration, got ILLEGAL"},
+			`[BadDecl{}, FuncDecl{Name: "f"}]`,
+		},
+		{
+			"func f() {\n\tif x {\n\t\treturn\n}\n",
+			[]string{"5:1: expected }, got EOF"},
+			`[FuncDecl{Name: "f", Body: [IfStmt{Condition: x, Then: [ReturnStmt{}]}]}]`,
+		},
+		{
+			"func f() {\n\tif x {\n\t\ty()\n}\n\nfunc g() {\n\tz()\n}\n\ntype T int\n",
+			[]string{"6:1: expected }, got FUNC"},
+			`[FuncDecl{Name: "f", Body: [IfStmt{Condition: x, Then: [CallExpr{Fun: y}]}]}, ` +
+				`FuncDecl{Name: "g", Body: [CallExpr{Fun: z}]}, TypeDecl{Name: "T", Type: int}]`,
+		},
+		{
+			"func f() {\n\tif {\n\t\ty()\n\t}\n}\n",
+			[]string{"2:5: missing condition in if statement"},
+			`[FuncDecl{Name: "f", Body: [IfStmt{Condition: BadExpr{}, Then: [CallExpr{Fun: y}]}]}]`,
+		},
+		{
+			"func f() {\n\tg(1, 2\n\th()\n}\n",
+			[]string{"2:8: expected ), got newline"},
+			`[FuncDecl{Name: "f", Body: [CallExpr{Fun: g, Args: [LiteralInt{Value: "1", Base: 10, Const: 1}, LiteralInt{Value: "2", Base: 10, Const: 2}]}, CallExpr{Fun: h}]}]`,
+		},
+	}
+	for _, tt := range tests {
+		program, err := New(lexer.New(tt.src).Tokenize()).Parse()
+		var errs []string
+		if list, ok := err.(ErrorList); ok {
+			for _, e := range list {
+				errs = append(errs, e.Error())
+			}
+		}
+		if strings.Join(errs, "\n") != strings.Join(tt.errs, "\n") {
+			t.Errorf("%s\ngot errors %q\nwant %q", tt.src, errs, tt.errs)
+		}
+		if program == nil {
+			t.Errorf("%s\nno partial program", tt.src)
+			continue
+		}
+		if got := dump(program.Items); got != tt.items {
+			t.Errorf("%s\n got %s\nwant %s", tt.src, got, tt.items)
+		}
+	}
+}
+
+func TestErrorList(t *testing.T) {
+	one := &SyntaxError{Pos: Pos{Line: 1, Col: 2}, Msg: "one"}
+	two := &SyntaxError{Pos: Pos{Line: 3, Col: 4}, Msg: "two"}
+	tests := []struct {
+		list ErrorList
+		want string
+	}{
+		{ErrorList{}, "no errors"},
+		{ErrorList{one}, "1:2: one"},
+		{ErrorList{one, two}, "1:2: one (and 1 more errors)"},
+	}
+	for _, tt := range tests {
+		if got := tt.list.Error(); got != tt.want {
+			t.Errorf("Error() = %q, want %q", got, tt.want)
+		}
+	}
+	if err := (ErrorList{}).Err(); err != nil {
+		t.Errorf("Err() of an empty list = %v, want nil", err)
+	}
+}
@@ -2,43 +2,102 @@ package parser
 
 import (
 	"fmt"
-	"strconv"
+	"go/constant"
+	"go/token"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/MistyPigeon/lingo/pkg/lexer"
 )
 
+// TokenSource supplies tokens to the parser on demand. After the last
+// token it must keep returning lexer.TOKEN_EOF. *lexer.Lexer implements it.
+type TokenSource interface {
+	NextToken() lexer.Token
+}
+
+// sliceSource is a TokenSource over already scanned tokens.
+type sliceSource struct {
+	tokens []lexer.Token
+	pos    int
+}
+
+func (s *sliceSource) NextToken() lexer.Token {
+	if s.pos >= len(s.tokens) {
+		return lexer.Token{Type: lexer.TOKEN_EOF}
+	}
+	tok := s.tokens[s.pos]
+	if tok.Type != lexer.TOKEN_EOF {
+		s.pos++
+	}
+	return tok
+}
+
 type Parser struct {
-	tokens    []lexer.Token
-	pos       int
-	current   lexer.Token
-	peekToken lexer.Token
+	// Filename is recorded in the positions of the nodes produced.
+	Filename string
+
+	src     TokenSource
+	current lexer.Token
+	ahead   []lexer.Token // tokens read from src past current
+
+	// Comments, present when the lexer ran with lexer.ScanComments.
+	comments    []*CommentGroup
+	leadComment *CommentGroup // group ending on the line before current
+	lineComment *CommentGroup // group after the previous token on its line
+
+	prevEnd Pos // end of the last token consumed
+	errors  ErrorList
+
+	// exprLev is < 0 in the header of an if, for or switch, where
+	// "T {" opens a block rather than a composite literal, and >= 0
+	// elsewhere, including inside parentheses.
+	exprLev int
 }
 
 func New(tokens []lexer.Token) *Parser {
-	p := &Parser{
-		tokens: tokens,
-		pos:    0,
-	}
-	p.advance()
+	return NewFromSource(&sliceSource{tokens: tokens})
+}
+
+// NewFromSource returns a Parser that pulls tokens from src as it goes,
+// looking at most a few tokens ahead.
+func NewFromSource(src TokenSource) *Parser {
+	p := &Parser{src: src}
 	p.advance()
 	return p
 }
 
+// Parse parses the whole input. It always returns a Program; when there
+// are syntax errors the error is an ErrorList and the Program holds
+// BadDecl, BadStmt and BadExpr nodes where parsing failed.
 func (p *Parser) Parse() (*Program, error) {
 	program := &Program{Items: []ASTNode{}}
 
 	for ! p.is(lexer.TOKEN_EOF) {
+		doc := p.leadComment
+		start := p.pos()
 		item, err := p.parseTopLevel()
 		if err != nil {
-			return nil, err
+			p.syncDecl(start)
+			program.Items = append(program.Items, &BadDecl{Span: p.span(start)})
+			continue
 		}
 		if item != nil {
 			program.Items = append(program.Items, item)
 		}
+		if err := p.parseTerminator(item, doc); err != nil {
+			p.syncDecl(start)
+		}
 	}
 
-	return program, nil
+	program.Span = Span{From: Pos{File: p.Filename, Line: 1, Col: 1}, To: p.pos()}
+	program.Comments = p.comments
+	return program, p.errors.Err()
+}
+
+// Errors returns the syntax errors found so far.
+func (p *Parser) Errors() ErrorList {
+	return p.errors
 }
 
 func (p *Parser) parseTopLevel() (ASTNode, error) {
@@ -56,71 +115,115 @@ func (p *Parser) parseTopLevel() (ASTNode, error) {
 	case lexer. TOKEN_CONST:
 		return p.parseConst()
 	default:
-		return nil, fmt. Errorf("unexpected token: %v", p.current. Type)
+		return nil, p.errorf("expected declaration, got %s", p.found())
 	}
 }
 
 func (p *Parser) parsePackage() (*PackageDecl, error) {
+	start := p.pos()
 	if ! p.match(lexer.TOKEN_PACKAGE) {
-		return nil, fmt.Errorf("expected package")
+		return nil, p.errorf("expected package")
 	}
 
 	name := p.current.Value
 	p. advance()
 
-	return &PackageDecl{Name: name}, nil
+	return &PackageDecl{Span: p.span(start), Name: name}, nil
 }
 
-func (p *Parser) parseImport() (*ImportDecl, error) {
+// parseImport parses a single import or a parenthesised group of them.
+func (p *Parser) parseImport() (ASTNode, error) {
+	start := p.pos()
 	if !p.match(lexer.TOKEN_IMPORT) {
-		return nil, fmt. Errorf("expected import")
+		return nil, p.errorf("expected import")
 	}
-
-	var path, alias string
-
 	if p.is(lexer.TOKEN_LPAREN) {
+		return p.parseGroup(start, "import", p.parseImportSpec)
+	}
+	return p.parseImportSpec(start)
+}
+
+// parseImportSpec parses an import path with an optional name, which may
+// be "." or "_".
+func (p *Parser) parseImportSpec(start Pos) (ASTNode, error) {
+	var alias string
+	switch {
+	case p.is(lexer.TOKEN_IDENT):
+		alias = p.current.Value
 		p.advance()
-		path = strings. Trim(p.current.Value, `"`)
-		p.advance()
-		p.expect(lexer.TOKEN_RPAREN)
-	} else {
-		if p.is(lexer.TOKEN_IDENT) {
-			alias = p.current.Value
-			p.advance()
-		}
-		path = strings.Trim(p.current.Value, `"`)
+	case p.is(lexer.TOKEN_DOT):
+		alias = "."
 		p.advance()
 	}
 
-	return &ImportDecl{Path: path, Alias: alias}, nil
+	if !p.is(lexer.TOKEN_STRING) && !p.is(lexer.TOKEN_RAW_STRING) {
+		return nil, p.errorf("expected import path, got %s", p.found())
+	}
+	path := p.current.Value
+	p.advance()
+
+	return &ImportDecl{Span: p.span(start), Path: path, Alias: alias}, nil
+}
+
+// parseGroup parses the parenthesised specs of a grouped declaration,
+// whose keyword has been consumed. Each spec may carry its own doc and
+// line comments.
+func (p *Parser) parseGroup(start Pos, tok string, parseSpec func(start Pos) (ASTNode, error)) (*GenDecl, error) {
+	p.expect(lexer.TOKEN_LPAREN)
+	decl := &GenDecl{Tok: tok, Specs: []ASTNode{}}
+	for !p.is(lexer.TOKEN_RPAREN) && !p.is(lexer.TOKEN_EOF) {
+		doc := p.leadComment
+		spec, err := parseSpec(p.pos())
+		if err != nil {
+			return nil, err
+		}
+		decl.Specs = append(decl.Specs, spec)
+		if p.is(lexer.TOKEN_RPAREN) {
+			break
+		}
+		if err := p.parseTerminator(spec, doc); err != nil {
+			return nil, err
+		}
+	}
+	p.expect(lexer.TOKEN_RPAREN)
+	decl.Span = p.span(start)
+	return decl, nil
 }
 
 func (p *Parser) parseFunc() (*FuncDecl, error) {
+	start := p.pos()
 	if !p.match(lexer.TOKEN_FUNC) {
-		return nil, fmt.Errorf("expected func")
+		return nil, p.errorf("expected func")
 	}
 
 	var receiver *Param
 
 	if p.is(lexer.TOKEN_LPAREN) {
 		p.advance()
-		receiver = &Param{
-			Name: p.current.Value,
-			Type: "",
-		}
+		recvStart := p.pos()
+		receiver = &Param{Name: p.current.Value}
 		p.advance()
-		if p.is(lexer.TOKEN_MUL) {
-			receiver.Type = "*"
-			p.advance()
+		p.match(lexer.TOKEN_COLON)
+		recvType, err := p.parseTypeExpr()
+		if err != nil {
+			return nil, err
 		}
-		receiver.Type += p.current.Value
-		p. advance()
+		receiver.Type = recvType
+		receiver.Span = p.span(recvStart)
 		p.expect(lexer.TOKEN_RPAREN)
 	}
 
 	name := p.current.Value
 	p.advance()
 
+	var tparams []*TypeParam
+	if p.is(lexer.TOKEN_LBRACKET) {
+		var err error
+		if tparams, err = p.parseTypeParams(); err != nil {
+			return nil, err
+		}
+	}
+
 	p. expect(lexer.TOKEN_LPAREN)
 	params, err := p.parseParamList()
 	if err != nil {
@@ -128,44 +231,9 @@ func (p *Parser) parseFunc() (*FuncDecl, error) {
 	}
 	p.expect(lexer.TOKEN_RPAREN)
 
-	returns := []string{}
-	if p.is(lexer.TOKEN_LPAREN) || p.is(lexer.TOKEN_IDENT) || p.is(lexer.TOKEN_MUL) {
-		if p.is(lexer.TOKEN_LPAREN) {
-			p. advance()
-			for ! p.is(lexer.TOKEN_RPAREN) {
-				ret := ""
-				if p.is(lexer.TOKEN_MUL) {
-					ret = "*"
-					p.advance()
-				}
-				if p.is(lexer.TOKEN_LBRACKET) {
-					p.advance()
-					ret += "[]"
-					p.advance()
-				}
-				ret += p.current.Value
-				p.advance()
-				returns = append(returns, ret)
-				if p.is(lexer. TOKEN_COMMA) {
-					p.advance()
-				}
-			}
-			p.expect(lexer.TOKEN_RPAREN)
-		} else {
-			ret := ""
-			if p.is(lexer.TOKEN_MUL) {
-				ret = "*"
-				p.advance()
-			}
-			if p.is(lexer.TOKEN_LBRACKET) {
-				p.advance()
-				ret += "[]"
-				p.advance()
-			}
-			ret += p.current.Value
-			p. advance()
-			returns = append(returns, ret)
-		}
+	returns, err := p.parseResults()
+	if err != nil {
+		return nil, err
 	}
 
 	p.expect(lexer.TOKEN_LBRACE)
@@ -176,11 +244,13 @@ func (p *Parser) parseFunc() (*FuncDecl, error) {
 	p.expect(lexer.TOKEN_RBRACE)
 
 	return &FuncDecl{
-		Name:     name,
-		Receiver: receiver,
-		Params:   params,
-		Returns:  returns,
-		Body:     body,
+		Span:       p.span(start),
+		Name:       name,
+		TypeParams: tparams,
+		Receiver:   receiver,
+		Params:     params,
+		Returns:    returns,
+		Body:       body,
 	}, nil
 }
 
@@ -188,171 +258,624 @@ func (p *Parser) parseParamList() ([]*Param, error) {
 	params := []*Param{}
 
 	for !p.is(lexer. TOKEN_RPAREN) && ! p.is(lexer.TOKEN_EOF) {
+		if !p.is(lexer.TOKEN_IDENT) {
+			p.errorf("expected parameter name, got %s", p.found())
+			break
+		}
+		start := p.pos()
 		name := p.current.Value
 		p.advance()
 
 		p.expect(lexer.TOKEN_COLON)
 
-		varType := ""
-		if p. is(lexer.TOKEN_MUL) {
-			varType = "*"
-			p.advance()
-		}
-		if p.is(lexer.TOKEN_LBRACKET) {
-			varType += "["
-			p.advance()
-			varType += "]"
-			p.advance()
+		variadic := p.match(lexer.TOKEN_ELLIPSIS)
+		varType, err := p.parseTypeExpr()
+		if err != nil {
+			return nil, err
 		}
-		varType += p.current.Value
-		p.advance()
 
-		params = append(params, &Param{Name: name, Type: varType})
+		params = append(params, &Param{Span: p.span(start), Name: name, Type: varType, Variadic: variadic})
 
-		if p.is(lexer.TOKEN_COMMA) {
-			p.advance()
+		if !p.match(lexer.TOKEN_COMMA) {
+			break
 		}
 	}
 
+	p.checkVariadic(params)
 	return params, nil
 }
 
-func (p *Parser) parseType() (*TypeDecl, error) {
+// checkVariadic reports a ... on any parameter but the last.
+func (p *Parser) checkVariadic(params []*Param) {
+	for i, param := range params {
+		if param.Variadic && i < len(params)-1 {
+			p.errorAt(param.Pos(), "can only use ... with final parameter")
+		}
+	}
+}
+
+// parseResults parses the optional result types of a function: a single
+// type or a parenthesised list.
+func (p *Parser) parseResults() ([]TypeExpr, error) {
+	if p.match(lexer.TOKEN_LPAREN) {
+		results, err := p.parseTypeList(lexer.TOKEN_RPAREN)
+		if err != nil {
+			return nil, err
+		}
+		p.expect(lexer.TOKEN_RPAREN)
+		return results, nil
+	}
+
+	if startsType(p.current.Type) {
+		result, err := p.parseTypeExpr()
+		if err != nil {
+			return nil, err
+		}
+		return []TypeExpr{result}, nil
+	}
+	return []TypeExpr{}, nil
+}
+
+// startsType reports whether a token of type t may begin a type.
+func startsType(t lexer.TokenType) bool {
+	switch t {
+	case lexer.TOKEN_IDENT, lexer.TOKEN_MUL, lexer.TOKEN_LBRACKET, lexer.TOKEN_QUESTION,
+		lexer.TOKEN_CHAN, lexer.TOKEN_RECV, lexer.TOKEN_FUNC, lexer.TOKEN_STRUCT, lexer.TOKEN_INTERFACE:
+		return true
+	}
+	return false
+}
+
+// parseType parses a type declaration or a group of them. Struct types
+// declare a StructDecl, interfaces an InterfaceDecl and any other type a
+// TypeDecl.
+func (p *Parser) parseType() (ASTNode, error) {
+	start := p.pos()
 	if !p.match(lexer. TOKEN_TYPE) {
-		return nil, fmt.Errorf("expected type")
+		return nil, p.errorf("expected type")
+	}
+	if p.is(lexer.TOKEN_LPAREN) {
+		return p.parseGroup(start, "type", p.parseTypeSpec)
 	}
+	return p.parseTypeSpec(start)
+}
 
+func (p *Parser) parseTypeSpec(start Pos) (ASTNode, error) {
+	if !p.is(lexer.TOKEN_IDENT) {
+		return nil, p.errorf("expected type name, got %s", p.found())
+	}
 	name := p.current.Value
 	p.advance()
 
-	varType := ""
-	isNullable := false
+	var tparams []*TypeParam
+	if p.isTypeParams() {
+		var err error
+		if tparams, err = p.parseTypeParams(); err != nil {
+			return nil, err
+		}
+	}
 
-	if p.is(lexer.TOKEN_QUESTION) {
-		isNullable = true
+	if p.is(lexer.TOKEN_STRUCT) {
+		st, err := p.parseStructType()
+		if err != nil {
+			return nil, err
+		}
+		return &StructDecl{Span: p.span(start), Name: name, TypeParams: tparams, Fields: st.Fields}, nil
+	}
+	if p.is(lexer.TOKEN_INTERFACE) {
+		it, err := p.parseInterfaceType()
+		if err != nil {
+			return nil, err
+		}
+		return &InterfaceDecl{Span: p.span(start), Name: name, TypeParams: tparams, Methods: it.Methods, Embeds: it.Embeds}, nil
+	}
+
+	typ, err := p.parseTypeExpr()
+	if err != nil {
+		return nil, err
+	}
+	typ, isNullable := unwrapNullable(typ)
+
+	return &TypeDecl{Span: p.span(start), Name: name, TypeParams: tparams, Type: typ, IsNullable: isNullable}, nil
+}
+
+// isTypeParams reports whether the bracket at the current token opens a
+// type parameter list such as [T any] rather than the length of an array
+// type such as [N]int or [N * 2]int: the name in it must be followed by a
+// constraint or by a comma.
+func (p *Parser) isTypeParams() bool {
+	if !p.is(lexer.TOKEN_LBRACKET) || !p.peekIs(lexer.TOKEN_IDENT) {
+		return false
+	}
+	switch p.lookahead(2).Type {
+	case lexer.TOKEN_IDENT, lexer.TOKEN_COMMA, lexer.TOKEN_TILDE, lexer.TOKEN_LBRACKET,
+		lexer.TOKEN_FUNC, lexer.TOKEN_CHAN, lexer.TOKEN_INTERFACE, lexer.TOKEN_STRUCT:
+		return true
+	}
+	return false
+}
+
+// parseTypeParams parses a type parameter list such as [K comparable, V any],
+// in which consecutive names may share a constraint, as in [K, V any].
+func (p *Parser) parseTypeParams() ([]*TypeParam, error) {
+	p.expect(lexer.TOKEN_LBRACKET)
+	params := []*TypeParam{}
+	var pending []*TypeParam
+	for !p.is(lexer.TOKEN_RBRACKET) && !p.is(lexer.TOKEN_EOF) {
+		if !p.is(lexer.TOKEN_IDENT) {
+			return nil, p.errorf("expected type parameter name, got %s", p.found())
+		}
+		start := p.pos()
+		name := p.current.Value
 		p.advance()
+		pending = append(pending, &TypeParam{Span: p.span(start), Name: name})
+		if p.match(lexer.TOKEN_COMMA) {
+			continue
+		}
+
+		constraint, err := p.parseConstraint()
+		if err != nil {
+			return nil, err
+		}
+		for _, param := range pending {
+			param.Constraint = constraint
+		}
+		params = append(params, pending...)
+		pending = nil
+		if !p.match(lexer.TOKEN_COMMA) {
+			break
+		}
+	}
+	if len(pending) > 0 {
+		return nil, p.errorAt(pending[len(pending)-1].Pos(), "missing type constraint")
+	}
+	if len(params) == 0 {
+		return nil, p.errorf("empty type parameter list")
+	}
+	p.expect(lexer.TOKEN_RBRACKET)
+	return params, nil
+}
+
+// parseConstraint parses a type constraint: a type, or a union of type
+// terms such as ~int | ~float64.
+func (p *Parser) parseConstraint() (TypeExpr, error) {
+	start := p.pos()
+	var terms []TypeExpr
+	for {
+		termStart := p.pos()
+		tilde := p.match(lexer.TOKEN_TILDE)
+		term, err := p.parseTypeExpr()
+		if err != nil {
+			return nil, err
+		}
+		if tilde {
+			term = &TildeType{Span: p.span(termStart), Elem: term}
+		}
+		terms = append(terms, term)
+		if !p.match(lexer.TOKEN_OR) {
+			break
+		}
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return &UnionType{Span: p.span(start), Terms: terms}, nil
+}
+
+// parseVar parses a variable declaration or a group of them.
+func (p *Parser) parseVar() (ASTNode, error) {
+	start := p.pos()
+	if !p.match(lexer.TOKEN_VAR) {
+		return nil, p.errorf("expected var")
+	}
+	if p.is(lexer.TOKEN_LPAREN) {
+		return p.parseGroup(start, "var", p.parseVarSpec)
+	}
+	return p.parseVarSpec(start)
+}
+
+func (p *Parser) parseVarSpec(start Pos) (ASTNode, error) {
+	if !p.is(lexer.TOKEN_IDENT) {
+		return nil, p.errorf("expected variable name, got %s", p.found())
 	}
+	name := p.current.Value
+	p.advance()
 
-	if p.is(lexer.TOKEN_MUL) {
-		varType = "*"
+	var varType TypeExpr
+	isNullable := false
+
+	if p.is(lexer.TOKEN_COLON) {
 		p.advance()
+		var err error
+		varType, err = p.parseTypeExpr()
+		if err != nil {
+			return nil, err
+		}
+		varType, isNullable = unwrapNullable(varType)
 	}
-	if p.is(lexer.TOKEN_LBRACKET) {
-		varType += "["
+
+	var value ASTNode
+	if p.is(lexer.TOKEN_ASSIGN) {
 		p.advance()
-		varType += "]"
-		p. advance()
+		var err error
+		value, err = p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	varType += p.current.Value
+	return &VarDecl{
+		Span:       p.span(start),
+		Name:       name,
+		Type:       varType,
+		Value:      value,
+		IsNullable: isNullable,
+	}, nil
+}
+
+// unwrapNullable strips the nullable marker from the type of a variable
+// or type declaration, which records it in an IsNullable flag instead.
+func unwrapNullable(typ TypeExpr) (TypeExpr, bool) {
+	if n, ok := typ.(*NullableType); ok {
+		return n.Elem, true
+	}
+	return typ, false
+}
+
+// parseConst parses a constant declaration or a group of them. Within a
+// group a constant may omit its type and value to repeat those of the
+// constant before it, with iota counting the constants of the group.
+func (p *Parser) parseConst() (ASTNode, error) {
+	start := p.pos()
+	if !p.match(lexer.TOKEN_CONST) {
+		return nil, p.errorf("expected const")
+	}
+	if !p.is(lexer.TOKEN_LPAREN) {
+		return p.parseConstSpec(start, false)
+	}
+
+	group, err := p.parseGroup(start, "const", func(start Pos) (ASTNode, error) {
+		return p.parseConstSpec(start, true)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, spec := range group.Specs {
+		c := spec.(*ConstDecl)
+		if i == 0 && c.Value == nil {
+			return nil, p.errorAt(c.Pos(), "missing init expr for const declaration")
+		}
+		c.Iota = i
+	}
+	return group, nil
+}
+
+// parseConstSpec parses a single constant. When implicit is set the
+// value may be omitted, leaving Value nil.
+func (p *Parser) parseConstSpec(start Pos, implicit bool) (ASTNode, error) {
+	if !p.is(lexer.TOKEN_IDENT) {
+		return nil, p.errorf("expected constant name, got %s", p.found())
+	}
+	name := p.current.Value
 	p.advance()
 
-	return &TypeDecl{Name: name, Type: varType, IsNullable: isNullable}, nil
+	if implicit && (p.is(lexer.TOKEN_SEMICOLON) || p.is(lexer.TOKEN_RPAREN)) {
+		return &ConstDecl{Span: p.span(start), Name: name}, nil
+	}
+
+	var varType TypeExpr
+	if p.is(lexer.TOKEN_COLON) {
+		p.advance()
+		var err error
+		varType, err = p.parseTypeExpr()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	p.expect(lexer.TOKEN_ASSIGN)
+	value, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ConstDecl{Span: p.span(start), Name: name, Type: varType, Value: value}, nil
 }
 
-func (p *Parser) parseVar() (*VarDecl, error) {
-	if !p.match(lexer.TOKEN_VAR) {
-		return nil, fmt. Errorf("expected var")
+// parseTypeExpr parses a type. A trailing "?" makes it nullable, as a
+// leading one does.
+func (p *Parser) parseTypeExpr() (TypeExpr, error) {
+	start := p.pos()
+	var typ TypeExpr
+
+	switch p.current.Type {
+	case lexer.TOKEN_IDENT:
+		name := p.current.Value
+		p.advance()
+		switch {
+		case name == "map" && p.is(lexer.TOKEN_LBRACKET):
+			p.advance()
+			key, err := p.parseTypeExpr()
+			if err != nil {
+				return nil, err
+			}
+			p.expect(lexer.TOKEN_RBRACKET)
+			value, err := p.parseTypeExpr()
+			if err != nil {
+				return nil, err
+			}
+			typ = &MapType{Span: p.span(start), Key: key, Value: value}
+		case p.is(lexer.TOKEN_DOT):
+			p.advance()
+			if !p.is(lexer.TOKEN_IDENT) {
+				return nil, p.errorf("expected type name after %s., got %s", name, p.found())
+			}
+			sel := p.current.Value
+			p.advance()
+			typ = &QualifiedType{Span: p.span(start), Package: name, Name: sel}
+		default:
+			typ = &IdentType{Span: p.span(start), Name: name}
+		}
+		if p.match(lexer.TOKEN_LBRACKET) {
+			args, err := p.parseTypeList(lexer.TOKEN_RBRACKET)
+			if err != nil {
+				return nil, err
+			}
+			p.expect(lexer.TOKEN_RBRACKET)
+			typ = &GenericType{Span: p.span(start), Base: typ, Args: args}
+		}
+
+	case lexer.TOKEN_QUESTION:
+		p.advance()
+		elem, err := p.parseTypeExpr()
+		if err != nil {
+			return nil, err
+		}
+		return &NullableType{Span: p.span(start), Elem: elem}, nil
+
+	case lexer.TOKEN_MUL:
+		p.advance()
+		elem, err := p.parseTypeExpr()
+		if err != nil {
+			return nil, err
+		}
+		return &PointerType{Span: p.span(start), Elem: elem}, nil
+
+	case lexer.TOKEN_LBRACKET:
+		p.advance()
+		if p.match(lexer.TOKEN_RBRACKET) {
+			elem, err := p.parseTypeExpr()
+			if err != nil {
+				return nil, err
+			}
+			return &SliceType{Span: p.span(start), Elem: elem}, nil
+		}
+		length, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		p.expect(lexer.TOKEN_RBRACKET)
+		elem, err := p.parseTypeExpr()
+		if err != nil {
+			return nil, err
+		}
+		return &ArrayType{Span: p.span(start), Len: length, Elem: elem}, nil
+
+	case lexer.TOKEN_LBRACE:
+		// {K}V is shorthand for map[K]V.
+		p.advance()
+		key, err := p.parseTypeExpr()
+		if err != nil {
+			return nil, err
+		}
+		p.expect(lexer.TOKEN_RBRACE)
+		value, err := p.parseTypeExpr()
+		if err != nil {
+			return nil, err
+		}
+		return &MapType{Span: p.span(start), Key: key, Value: value}, nil
+
+	case lexer.TOKEN_CHAN, lexer.TOKEN_RECV:
+		dir := ChanBoth
+		if p.match(lexer.TOKEN_RECV) {
+			dir = ChanRecv
+		}
+		p.expect(lexer.TOKEN_CHAN)
+		if dir == ChanBoth && p.match(lexer.TOKEN_RECV) {
+			dir = ChanSend
+		}
+		elem, err := p.parseTypeExpr()
+		if err != nil {
+			return nil, err
+		}
+		return &ChanType{Span: p.span(start), Dir: dir, Elem: elem}, nil
+
+	case lexer.TOKEN_FUNC:
+		p.advance()
+		return p.parseSignature(start)
+
+	case lexer.TOKEN_STRUCT:
+		return p.parseStructType()
+
+	case lexer.TOKEN_INTERFACE:
+		return p.parseInterfaceType()
+
+	case lexer.TOKEN_LPAREN:
+		p.advance()
+		inner, err := p.parseTypeExpr()
+		if err != nil {
+			return nil, err
+		}
+		p.expect(lexer.TOKEN_RPAREN)
+		typ = inner
+
+	default:
+		return nil, p.errorf("expected type, got %s", p.found())
+	}
+
+	if p.match(lexer.TOKEN_QUESTION) {
+		typ = &NullableType{Span: p.span(start), Elem: typ}
+	}
+	return typ, nil
+}
+
+// parseTypeList parses comma-separated types up to end, which it leaves
+// for the caller.
+func (p *Parser) parseTypeList(end lexer.TokenType) ([]TypeExpr, error) {
+	types := []TypeExpr{}
+	for !p.is(end) && !p.is(lexer.TOKEN_EOF) {
+		typ, err := p.parseTypeExpr()
+		if err != nil {
+			return nil, err
+		}
+		types = append(types, typ)
+		if !p.match(lexer.TOKEN_COMMA) {
+			break
+		}
+	}
+	return types, nil
+}
+
+// parseSignature parses the parameters and results of a function type,
+// whose "func" keyword, if any, began at start. Parameters may be named
+// (x: int) or not (int).
+func (p *Parser) parseSignature(start Pos) (*FuncType, error) {
+	p.expect(lexer.TOKEN_LPAREN)
+	params := []*Param{}
+	for !p.is(lexer.TOKEN_RPAREN) && !p.is(lexer.TOKEN_EOF) {
+		paramStart := p.pos()
+		name := ""
+		if p.is(lexer.TOKEN_IDENT) && p.peekIs(lexer.TOKEN_COLON) {
+			name = p.current.Value
+			p.advance()
+			p.advance()
+		}
+		variadic := p.match(lexer.TOKEN_ELLIPSIS)
+		typ, err := p.parseTypeExpr()
+		if err != nil {
+			return nil, err
+		}
+		params = append(params, &Param{Span: p.span(paramStart), Name: name, Type: typ, Variadic: variadic})
+		if !p.match(lexer.TOKEN_COMMA) {
+			break
+		}
+	}
+	p.checkVariadic(params)
+	p.expect(lexer.TOKEN_RPAREN)
+
+	results, err := p.parseResults()
+	if err != nil {
+		return nil, err
 	}
+	return &FuncType{Span: p.span(start), Params: params, Results: results}, nil
+}
 
-	name := p.current.Value
-	p.advance()
-
-	var varType string
-	isNullable := false
+// parseStructType parses struct { name: Type `tag`; Embedded }. Fields may
+// also be separated by commas.
+func (p *Parser) parseStructType() (*StructType, error) {
+	start := p.pos()
+	p.expect(lexer.TOKEN_STRUCT)
+	p.expect(lexer.TOKEN_LBRACE)
 
-	if p.is(lexer.TOKEN_COLON) {
-		p.advance()
-		if p.is(lexer.TOKEN_QUESTION) {
-			isNullable = true
+	fields := []*StructField{}
+	for !p.is(lexer.TOKEN_RBRACE) && !p.is(lexer.TOKEN_EOF) {
+		if p.match(lexer.TOKEN_SEMICOLON) || p.match(lexer.TOKEN_COMMA) {
+			continue
+		}
+		fieldStart := p.pos()
+		doc := p.leadComment
+		name := ""
+		if p.is(lexer.TOKEN_IDENT) && p.peekIs(lexer.TOKEN_COLON) {
+			name = p.current.Value
+			p.advance()
 			p.advance()
 		}
-		varType = p.parseTypeAnnotation()
-	}
-
-	var value ASTNode
-	if p.is(lexer.TOKEN_ASSIGN) {
-		p.advance()
-		var err error
-		value, err = p.parseExpr()
+		typ, err := p.parseTypeExpr()
 		if err != nil {
 			return nil, err
 		}
-	}
-
-	return &VarDecl{
-		Name:       name,
-		Type:       varType,
-		Value:      value,
-		IsNullable: isNullable,
-	}, nil
-}
-
-func (p *Parser) parseTypeAnnotation() string {
-	varType := ""
-	if p.is(lexer.TOKEN_MUL) {
-		varType = "*"
-		p.advance()
-	}
-	if p.is(lexer.TOKEN_LBRACKET) {
-		varType += "["
-		p.advance()
-		varType += "]"
-		p.advance()
-	}
-	if p.is(lexer.TOKEN_LBRACE) {
-		p.advance()
-		keyType := p.current.Value
-		p.advance()
-		p.expect(lexer.TOKEN_RBRACE)
-		varType += "map[" + keyType + "]"
-		if p.is(lexer.TOKEN_MUL) {
-			varType += "*"
-			p. advance()
+		typ, isNullable := unwrapNullable(typ)
+		field := &StructField{Name: name, Type: typ, IsNullable: isNullable, Doc: doc}
+		if p.is(lexer.TOKEN_STRING) || p.is(lexer.TOKEN_RAW_STRING) {
+			field.Tag = p.current.Value
+			p.advance()
 		}
-		varType += p.current.Value
-		p. advance()
-	} else {
-		varType += p.current.Value
-		p.advance()
-	}
-	return varType
-}
+		field.Span = p.span(fieldStart)
+		fields = append(fields, field)
 
-func (p *Parser) parseConst() (*ConstDecl, error) {
-	if !p.match(lexer.TOKEN_CONST) {
-		return nil, fmt. Errorf("expected const")
+		if p.match(lexer.TOKEN_SEMICOLON) {
+			field.Comment = p.lineComment
+		} else if !p.match(lexer.TOKEN_COMMA) && !p.is(lexer.TOKEN_RBRACE) {
+			return nil, p.errorf("expected ; or newline after struct field, got %s", p.found())
+		}
 	}
+	p.expect(lexer.TOKEN_RBRACE)
 
-	name := p.current.Value
-	p.advance()
+	return &StructType{Span: p.span(start), Fields: fields}, nil
+}
 
-	var varType string
-	if p.is(lexer.TOKEN_COLON) {
-		p.advance()
-		varType = p.parseTypeAnnotation()
-	}
+// parseInterfaceType parses interface { Method(params) results; Embedded }.
+func (p *Parser) parseInterfaceType() (*InterfaceType, error) {
+	start := p.pos()
+	p.expect(lexer.TOKEN_INTERFACE)
+	p.expect(lexer.TOKEN_LBRACE)
 
-	p.expect(lexer.TOKEN_ASSIGN)
-	value, err := p.parseExpr()
-	if err != nil {
-		return nil, err
+	iface := &InterfaceType{Methods: []*InterfaceMethod{}, Embeds: []TypeExpr{}}
+	for !p.is(lexer.TOKEN_RBRACE) && !p.is(lexer.TOKEN_EOF) {
+		if p.match(lexer.TOKEN_SEMICOLON) {
+			continue
+		}
+		if p.is(lexer.TOKEN_IDENT) && p.peekIs(lexer.TOKEN_LPAREN) {
+			methodStart := p.pos()
+			doc := p.leadComment
+			name := p.current.Value
+			p.advance()
+			sig, err := p.parseSignature(p.pos())
+			if err != nil {
+				return nil, err
+			}
+			method := &InterfaceMethod{Span: p.span(methodStart), Name: name, Type: sig, Doc: doc}
+			iface.Methods = append(iface.Methods, method)
+			if p.match(lexer.TOKEN_SEMICOLON) {
+				method.Comment = p.lineComment
+			}
+			continue
+		}
+		embed, err := p.parseConstraint()
+		if err != nil {
+			return nil, err
+		}
+		iface.Embeds = append(iface.Embeds, embed)
 	}
+	p.expect(lexer.TOKEN_RBRACE)
 
-	return &ConstDecl{Name: name, Type: varType, Value: value}, nil
+	iface.Span = p.span(start)
+	return iface, nil
 }
 
 func (p *Parser) parseBlock() ([]ASTNode, error) {
 	statements := []ASTNode{}
 
-	for !p.is(lexer.TOKEN_RBRACE) && !p.is(lexer. TOKEN_EOF) {
+	for !p.is(lexer.TOKEN_RBRACE) && !p.is(lexer.TOKEN_CASE) && !p.is(lexer.TOKEN_DEFAULT) && !p.is(lexer.TOKEN_EOF) && !p.atDecl() {
+		// Empty statement
+		if p.match(lexer.TOKEN_SEMICOLON) {
+			continue
+		}
+
+		doc := p.leadComment
+		start := p.pos()
 		stmt, err := p.parseStatement()
 		if err != nil {
-			return nil, err
+			p.syncStmt(start)
+			statements = append(statements, &BadStmt{Span: p.span(start)})
+			continue
 		}
 		if stmt != nil {
 			statements = append(statements, stmt)
 		}
+		if err := p.parseTerminator(stmt, doc); err != nil {
+			p.syncStmt(start)
+		}
 	}
 
 	return statements, nil
@@ -370,6 +893,10 @@ func (p *Parser) parseStatement() (ASTNode, error) {
 		return p. parseIf()
 	case lexer. TOKEN_FOR:
 		return p.parseFor()
+	case lexer.TOKEN_SWITCH:
+		return p.parseSwitch()
+	case lexer.TOKEN_BREAK, lexer.TOKEN_CONTINUE, lexer.TOKEN_GOTO, lexer.TOKEN_FALLTHROUGH:
+		return p.parseBranch()
 	case lexer.TOKEN_DEFER:
 		return p.parseDefer()
 	case lexer.TOKEN_GO:
@@ -378,21 +905,59 @@ func (p *Parser) parseStatement() (ASTNode, error) {
 		return p.parseSelect()
 	case lexer.TOKEN_PANIC:
 		return p.parsePanic()
-	case lexer. TOKEN_IDENT:
-		return p.parseAssignmentOrCall()
+	case lexer.TOKEN_IDENT, lexer.TOKEN_LPAREN, lexer.TOKEN_RECV, lexer.TOKEN_FUNC, lexer.TOKEN_RECOVER,
+		lexer.TOKEN_MUL, lexer.TOKEN_AND, lexer.TOKEN_LNOT, lexer.TOKEN_MINUS, lexer.TOKEN_PLUS, lexer.TOKEN_XOR:
+		if p.is(lexer.TOKEN_IDENT) && p.peekIs(lexer.TOKEN_COLON) {
+			return p.parseLabeled()
+		}
+		return p.parseSimpleStmt()
 	default:
-		return nil, fmt. Errorf("unexpected statement: %v", p.current. Type)
+		return nil, p.errorf("expected statement, got %s", p.found())
+	}
+}
+
+// parseBranch parses break, continue, goto or fallthrough and its label.
+func (p *Parser) parseBranch() (*BranchStmt, error) {
+	start := p.pos()
+	tok := p.current.Value
+	p.advance()
+
+	var label string
+	if p.is(lexer.TOKEN_IDENT) && tok != "fallthrough" {
+		label = p.current.Value
+		p.advance()
+	} else if tok == "goto" {
+		return nil, p.errorf("expected label after goto, got %s", p.found())
 	}
+	return &BranchStmt{Span: p.span(start), Tok: tok, Label: label}, nil
+}
+
+// parseLabeled parses a label and the statement it labels.
+func (p *Parser) parseLabeled() (*LabeledStmt, error) {
+	start := p.pos()
+	label := p.current.Value
+	p.advance()
+	p.expect(lexer.TOKEN_COLON)
+
+	if p.is(lexer.TOKEN_SEMICOLON) || p.is(lexer.TOKEN_RBRACE) || p.is(lexer.TOKEN_CASE) || p.is(lexer.TOKEN_DEFAULT) {
+		return &LabeledStmt{Span: p.span(start), Label: label}, nil
+	}
+	stmt, err := p.parseStatement()
+	if err != nil {
+		return nil, err
+	}
+	return &LabeledStmt{Span: p.span(start), Label: label, Stmt: stmt}, nil
 }
 
 func (p *Parser) parseReturn() (*ReturnStmt, error) {
+	start := p.pos()
 	if !p.match(lexer. TOKEN_RETURN) {
-		return nil, fmt.Errorf("expected return")
+		return nil, p.errorf("expected return")
 	}
 
 	values := []ASTNode{}
 
-	if !p.is(lexer.TOKEN_RBRACE) && !p.is(lexer.TOKEN_EOF) {
+	if !p.is(lexer.TOKEN_SEMICOLON) && !p.is(lexer.TOKEN_RBRACE) && !p.is(lexer.TOKEN_EOF) {
 		expr, err := p.parseExpr()
 		if err != nil {
 			return nil, err
@@ -409,17 +974,30 @@ func (p *Parser) parseReturn() (*ReturnStmt, error) {
 		}
 	}
 
-	return &ReturnStmt{Values: values}, nil
+	return &ReturnStmt{Span: p.span(start), Values: values}, nil
 }
 
 func (p *Parser) parseIf() (*IfStmt, error) {
+	start := p.pos()
 	if !p.match(lexer. TOKEN_IF) {
-		return nil, fmt.Errorf("expected if")
+		return nil, p.errorf("expected if")
 	}
 
-	cond, err := p.parseExpr()
-	if err != nil {
-		return nil, err
+	var cond ASTNode
+	if p.is(lexer.TOKEN_LBRACE) {
+		// Report the missing condition rather than parsing the block as a
+		// composite literal, and go on with the block.
+		p.errorf("missing condition in if statement")
+		cond = &BadExpr{Span: Span{From: p.pos(), To: p.pos()}}
+	} else {
+		outer := p.exprLev
+		p.exprLev = -1
+		var err error
+		cond, err = p.parseExpr()
+		p.exprLev = outer
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	p.expect(lexer.TOKEN_LBRACE)
@@ -448,105 +1026,356 @@ func (p *Parser) parseIf() (*IfStmt, error) {
 		}
 	}
 
-	return &IfStmt{Condition: cond, Then: thenBlock, Else: elseBlock}, nil
+	return &IfStmt{Span: p.span(start), Condition: cond, Then: thenBlock, Else: elseBlock}, nil
 }
 
+// parseFor parses every form of for loop: infinite, condition-only,
+// three-clause and range.
 func (p *Parser) parseFor() (ASTNode, error) {
+	start := p.pos()
 	if !p.match(lexer.TOKEN_FOR) {
-		return nil, fmt.Errorf("expected for")
+		return nil, p.errorf("expected for")
+	}
+
+	outer := p.exprLev
+	p.exprLev = -1
+	defer func() { p.exprLev = outer }()
+
+	var init, cond, post ASTNode
+	switch {
+	case p.is(lexer.TOKEN_LBRACE):
+		return p.parseForBody(&ForStmt{Span: Span{From: start}})
+	case p.is(lexer.TOKEN_RANGE):
+		loop, err := p.parseRange(start, nil, false)
+		if err != nil {
+			return nil, err
+		}
+		return p.parseForBody(loop)
+	case !p.is(lexer.TOKEN_SEMICOLON):
+		stmt, err := p.parseSimpleStmtMode(true)
+		if err != nil {
+			return nil, err
+		}
+		if loop, ok := stmt.(*ForRangeStmt); ok {
+			loop.From = start
+			return p.parseForBody(loop)
+		}
+		if p.is(lexer.TOKEN_LBRACE) {
+			return p.parseForBody(&ForStmt{Span: Span{From: start}, Condition: stmt})
+		}
+		init = stmt
+	}
+
+	p.expect(lexer.TOKEN_SEMICOLON)
+	if !p.is(lexer.TOKEN_SEMICOLON) {
+		var err error
+		if cond, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	p.expect(lexer.TOKEN_SEMICOLON)
+	if !p.is(lexer.TOKEN_LBRACE) {
+		var err error
+		if post, err = p.parseSimpleStmt(); err != nil {
+			return nil, err
+		}
+	}
+
+	return p.parseForBody(&ForStmt{Span: Span{From: start}, Init: init, Condition: cond, Post: post})
+}
+
+// parseRange parses "range expr" following the iteration variables lhs,
+// which are declared if define is set. The loop body is left to the
+// caller.
+func (p *Parser) parseRange(start Pos, lhs []ASTNode, define bool) (*ForRangeStmt, error) {
+	loop := &ForRangeStmt{Span: Span{From: start}, Define: define}
+	if len(lhs) > 2 {
+		return nil, p.errorAt(lhs[2].Pos(), "range clause permits at most two iteration variables")
+	}
+	for i, x := range lhs {
+		ident, ok := x.(*Identifier)
+		if !ok {
+			return nil, p.errorAt(x.Pos(), "expected identifier in range clause")
+		}
+		if i == 0 {
+			loop.Key = ident.Name
+		} else {
+			loop.Value = ident.Name
+		}
+	}
+
+	p.expect(lexer.TOKEN_RANGE)
+	expr, err := p.parseExpr()
+	if err != nil {
+		return nil, err
 	}
+	loop.Expr = expr
+	loop.Span = p.span(start)
+	return loop, nil
+}
 
+// parseForBody parses the body of loop and completes its span.
+func (p *Parser) parseForBody(loop ASTNode) (ASTNode, error) {
 	p.expect(lexer.TOKEN_LBRACE)
+	outer := p.exprLev
+	p.exprLev = 0
 	body, err := p.parseBlock()
+	p.exprLev = outer
 	if err != nil {
 		return nil, err
 	}
 	p.expect(lexer.TOKEN_RBRACE)
 
-	return &ForStmt{Body: body}, nil
+	switch l := loop.(type) {
+	case *ForStmt:
+		l.Body = body
+		l.Span = p.span(l.From)
+	case *ForRangeStmt:
+		l.Body = body
+		l.Span = p.span(l.From)
+	}
+	return loop, nil
 }
 
-func (p *Parser) parseDefer() (*DeferStmt, error) {
-	if !p.match(lexer.TOKEN_DEFER) {
-		return nil, fmt. Errorf("expected defer")
+// parseSwitch parses expression and type switches, each with an optional
+// init statement.
+func (p *Parser) parseSwitch() (ASTNode, error) {
+	start := p.pos()
+	if !p.match(lexer.TOKEN_SWITCH) {
+		return nil, p.errorf("expected switch")
 	}
 
-	if !p.is(lexer.TOKEN_IDENT) {
-		return nil, fmt.Errorf("expected function call after defer")
+	init, tag, err := p.parseSwitchHeader()
+	if err != nil {
+		return nil, err
 	}
 
-	funcName := p.current.Value
-	p.advance()
+	// A type switch guard is x.(type), optionally bound with :=.
+	binding := ""
+	guard, _ := tag.(*TypeAssertExpr)
+	if assign, ok := tag.(*ShortAssignStmt); ok {
+		if len(assign.Lhs) == 1 && len(assign.Rhs) == 1 {
+			guard, _ = assign.Rhs[0].(*TypeAssertExpr)
+		}
+		if guard == nil || guard.Type != nil {
+			return nil, p.errorAt(assign.Pos(), "expected switch expression, got assignment")
+		}
+		binding = assign.Lhs[0].Name
+	}
+	isTypeSwitch := guard != nil && guard.Type == nil
+	if !isTypeSwitch && tag != nil && !isExpr(tag) {
+		return nil, p.errorAt(tag.Pos(), "expected switch expression")
+	}
 
-	p.expect(lexer.TOKEN_LPAREN)
-	args, err := p.parseArgList()
+	p.expect(lexer.TOKEN_LBRACE)
+	clauses := []*CaseClause{}
+	for !p.is(lexer.TOKEN_RBRACE) && !p.is(lexer.TOKEN_EOF) {
+		clause, err := p.parseCaseClause(isTypeSwitch)
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, clause)
+	}
+	p.expect(lexer.TOKEN_RBRACE)
+
+	if isTypeSwitch {
+		return &TypeSwitchStmt{Span: p.span(start), Init: init, Binding: binding, X: guard.Expr, Body: clauses}, nil
+	}
+	return &SwitchStmt{Span: p.span(start), Init: init, Tag: tag, Body: clauses}, nil
+}
+
+// parseSwitchHeader parses the optional init statement and tag of a
+// switch, up to its opening brace.
+func (p *Parser) parseSwitchHeader() (init, tag ASTNode, err error) {
+	outer := p.exprLev
+	p.exprLev = -1
+	defer func() { p.exprLev = outer }()
+
+	if p.is(lexer.TOKEN_LBRACE) {
+		return nil, nil, nil
+	}
+	if !p.is(lexer.TOKEN_SEMICOLON) {
+		if tag, err = p.parseSimpleStmt(); err != nil {
+			return nil, nil, err
+		}
+	}
+	if p.match(lexer.TOKEN_SEMICOLON) {
+		init, tag = tag, nil
+		if !p.is(lexer.TOKEN_LBRACE) {
+			if tag, err = p.parseSimpleStmt(); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return init, tag, nil
+}
+
+// parseCaseClause parses a case or default clause. The cases of a type
+// switch are types, or null.
+func (p *Parser) parseCaseClause(typeSwitch bool) (*CaseClause, error) {
+	start := p.pos()
+	var list []ASTNode
+	if p.match(lexer.TOKEN_CASE) {
+		list = []ASTNode{}
+		for {
+			var item ASTNode
+			var err error
+			switch {
+			case typeSwitch && p.is(lexer.TOKEN_NULL):
+				nullStart := p.pos()
+				p.advance()
+				item = &LiteralNull{Span: p.span(nullStart)}
+			case typeSwitch:
+				item, err = p.parseTypeExpr()
+			default:
+				item, err = p.parseExpr()
+			}
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+			if !p.match(lexer.TOKEN_COMMA) {
+				break
+			}
+		}
+	} else if !p.match(lexer.TOKEN_DEFAULT) {
+		return nil, p.errorf("expected case or default, got %s", p.found())
+	}
+	p.expect(lexer.TOKEN_COLON)
+
+	body, err := p.parseBlock()
 	if err != nil {
 		return nil, err
 	}
-	p.expect(lexer.TOKEN_RPAREN)
-
-	return &DeferStmt{Call: &CallExpr{Func: funcName, Args: args}}, nil
+	return &CaseClause{Span: p.span(start), List: list, Body: body}, nil
 }
 
-func (p *Parser) parseGo() (*GoStmt, error) {
-	if !p.match(lexer.TOKEN_GO) {
-		return nil, fmt.Errorf("expected go")
+// isExpr reports whether node is an expression rather than a statement.
+func isExpr(node ASTNode) bool {
+	switch n := node.(type) {
+	case *AssignStmt, *ShortAssignStmt, *IncDecStmt:
+		return false
+	case *ChanOp:
+		return n.Value == nil
 	}
+	return true
+}
 
-	if !p.is(lexer.TOKEN_IDENT) {
-		return nil, fmt. Errorf("expected function call after go")
+func (p *Parser) parseDefer() (*DeferStmt, error) {
+	start := p.pos()
+	if !p.match(lexer.TOKEN_DEFER) {
+		return nil, p.errorf("expected defer")
 	}
 
-	funcName := p.current.Value
-	p.advance()
+	call, err := p.parseCallStmt("defer")
+	if err != nil {
+		return nil, err
+	}
+	return &DeferStmt{Span: p.span(start), Call: call}, nil
+}
 
-	p.expect(lexer.TOKEN_LPAREN)
-	args, err := p.parseArgList()
+// parseCallStmt parses the function call following go or defer.
+func (p *Parser) parseCallStmt(keyword string) (*CallExpr, error) {
+	start := p.pos()
+	expr, err := p.parseExpr()
 	if err != nil {
 		return nil, err
 	}
-	p.expect(lexer.TOKEN_RPAREN)
+	call, ok := expr.(*CallExpr)
+	if !ok {
+		return nil, p.errorAt(start, "expression in %s must be function call", keyword)
+	}
+	return call, nil
+}
+
+func (p *Parser) parseGo() (*GoStmt, error) {
+	start := p.pos()
+	if !p.match(lexer.TOKEN_GO) {
+		return nil, p.errorf("expected go")
+	}
 
-	return &GoStmt{Call: &CallExpr{Func: funcName, Args: args}}, nil
+	call, err := p.parseCallStmt("go")
+	if err != nil {
+		return nil, err
+	}
+	return &GoStmt{Span: p.span(start), Call: call}, nil
 }
 
 func (p *Parser) parseSelect() (*SelectStmt, error) {
+	start := p.pos()
 	if !p.match(lexer.TOKEN_SELECT) {
-		return nil, fmt.Errorf("expected select")
+		return nil, p.errorf("expected select")
 	}
 
 	p.expect(lexer.TOKEN_LBRACE)
-
 	cases := []*SelectCase{}
-	for ! p.is(lexer.TOKEN_RBRACE) && !p.is(lexer.TOKEN_EOF) {
-		if !p.match(lexer.TOKEN_CASE) {
-			break
-		}
-
-		var chanOp *ChanOp
-		expr, err := p.parseExpr()
+	for !p.is(lexer.TOKEN_RBRACE) && !p.is(lexer.TOKEN_EOF) {
+		c, err := p.parseSelectCase()
 		if err != nil {
 			return nil, err
 		}
-		chanOp = &ChanOp{Op: "<-", Expr: expr}
+		cases = append(cases, c)
+	}
+	p.expect(lexer. TOKEN_RBRACE)
 
-		p.expect(lexer.TOKEN_COLON)
-		body, err := p.parseBlock()
+	return &SelectStmt{Span: p.span(start), Cases: cases}, nil
+}
+
+// parseSelectCase parses a case or default clause of a select.
+func (p *Parser) parseSelectCase() (*SelectCase, error) {
+	start := p.pos()
+	var comm ASTNode
+	if p.match(lexer.TOKEN_CASE) {
+		commStart := p.pos()
+		stmt, err := p.parseSimpleStmt()
 		if err != nil {
 			return nil, err
 		}
-
-		cases = append(cases, &SelectCase{ChanOp: chanOp, Body: body})
+		if !isCommStmt(stmt) {
+			return nil, p.errorAt(commStart, "select case must be receive, send or assign recv")
+		}
+		comm = stmt
+	} else if !p.match(lexer.TOKEN_DEFAULT) {
+		return nil, p.errorf("expected case or default, got %s", p.found())
 	}
+	p.expect(lexer.TOKEN_COLON)
 
-	p.expect(lexer. TOKEN_RBRACE)
+	body, err := p.parseBlock()
+	if err != nil {
+		return nil, err
+	}
+	return &SelectCase{Span: p.span(start), Comm: comm, Body: body}, nil
+}
 
-	return &SelectStmt{Cases: cases}, nil
+// isCommStmt reports whether stmt may be the communication of a select
+// case: a send, a receive, or a receive assigned to one or two operands.
+func isCommStmt(stmt ASTNode) bool {
+	var lhs int
+	var rhs []ASTNode
+	switch s := stmt.(type) {
+	case *ChanOp:
+		return true
+	case *AssignStmt:
+		if s.Op != "=" {
+			return false
+		}
+		lhs, rhs = len(s.Lhs), s.Rhs
+	case *ShortAssignStmt:
+		lhs, rhs = len(s.Lhs), s.Rhs
+	default:
+		return false
+	}
+	if lhs > 2 || len(rhs) != 1 {
+		return false
+	}
+	recv, ok := rhs[0].(*ChanOp)
+	return ok && recv.Value == nil
 }
 
 func (p *Parser) parsePanic() (*PanicStmt, error) {
+	start := p.pos()
 	if !p. match(lexer.TOKEN_PANIC) {
-		return nil, fmt.Errorf("expected panic")
+		return nil, p.errorf("expected panic")
 	}
 
 	p.expect(lexer.TOKEN_LPAREN)
@@ -556,71 +1385,156 @@ func (p *Parser) parsePanic() (*PanicStmt, error) {
 	}
 	p.expect(lexer.TOKEN_RPAREN)
 
-	return &PanicStmt{Expr: expr}, nil
+	return &PanicStmt{Span: p.span(start), Expr: expr}, nil
 }
 
-func (p *Parser) parseAssignmentOrCall() (ASTNode, error) {
-	name := p.current.Value
-	p.advance()
+// parseSimpleStmt parses the statements that begin with an expression:
+// expression statements, assignments, inc/dec and channel sends.
+func (p *Parser) parseSimpleStmt() (ASTNode, error) {
+	return p.parseSimpleStmtMode(false)
+}
+
+// parseSimpleStmtMode is parseSimpleStmt that, when rangeOk is set, also
+// accepts the "k, v := range x" header of a for loop and returns it as a
+// ForRangeStmt without a body.
+func (p *Parser) parseSimpleStmtMode(rangeOk bool) (ASTNode, error) {
+	start := p.pos()
+	lhs, err := p.parseExprList()
+	if err != nil {
+		return nil, err
+	}
 
-	if p. is(lexer.TOKEN_ASSIGN) {
+	switch {
+	case isAssignOp(p.current.Type), p.is(lexer.TOKEN_WALRUS):
+		define := p.is(lexer.TOKEN_WALRUS)
+		op := p.current.Value
 		p.advance()
-		value, err := p.parseExpr()
+		if rangeOk && p.is(lexer.TOKEN_RANGE) && (define || op == "=") {
+			return p.parseRange(start, lhs, define)
+		}
+		rhs, err := p.parseExprList()
 		if err != nil {
 			return nil, err
 		}
-		return &AssignStmt{Name: name, Value: value}, nil
-	} else if p.is(lexer.TOKEN_WALRUS) {
+		if !define {
+			return &AssignStmt{Span: p.span(start), Lhs: lhs, Op: op, Rhs: rhs}, nil
+		}
+		idents := make([]*Identifier, len(lhs))
+		for i, x := range lhs {
+			ident, ok := x.(*Identifier)
+			if !ok {
+				return nil, p.errorAt(x.Pos(), "expected identifier on left side of :=")
+			}
+			idents[i] = ident
+		}
+		return &ShortAssignStmt{Span: p.span(start), Lhs: idents, Rhs: rhs}, nil
+	}
+
+	if len(lhs) > 1 {
+		return nil, p.errorf("expected := or = or comma, got %s", p.found())
+	}
+	x := lhs[0]
+
+	switch {
+	case p.is(lexer.TOKEN_INC), p.is(lexer.TOKEN_DEC):
+		op := p.current.Value
+		p.advance()
+		return &IncDecStmt{Span: p.span(start), X: x, Op: op}, nil
+	case p.is(lexer.TOKEN_RECV):
 		p.advance()
 		value, err := p.parseExpr()
 		if err != nil {
 			return nil, err
 		}
-		return &ShortAssignStmt{Name: name, Value: value}, nil
-	} else if p.is(lexer.TOKEN_LPAREN) {
-		p.advance()
-		args, err := p.parseArgList()
+		return &ChanOp{Span: p.span(start), Op: "<-", Expr: x, Value: value}, nil
+	}
+
+	return x, nil
+}
+
+// parseExprList parses one or more comma-separated expressions.
+func (p *Parser) parseExprList() ([]ASTNode, error) {
+	list := []ASTNode{}
+	for {
+		expr, err := p.parseExpr()
 		if err != nil {
 			return nil, err
 		}
-		p.expect(lexer.TOKEN_RPAREN)
-		return &CallExpr{Func: name, Args: args}, nil
-	} else if p.is(lexer.TOKEN_DOT) {
-		p.advance()
-		method := p.current.Value
-		p.advance()
-		p.expect(lexer.TOKEN_LPAREN)
-		args, err := p.parseArgList()
-		if err != nil {
-			return nil, err
+		list = append(list, expr)
+		if !p.match(lexer.TOKEN_COMMA) {
+			return list, nil
 		}
-		p.expect(lexer.TOKEN_RPAREN)
-		return &MethodCall{Receiver: name, Method: method, Args: args}, nil
 	}
+}
 
-	return &Identifier{Name: name}, nil
+func isAssignOp(t lexer.TokenType) bool {
+	switch t {
+	case lexer.TOKEN_ASSIGN, lexer.TOKEN_PLUS_ASSIGN, lexer.TOKEN_MINUS_ASSIGN,
+		lexer.TOKEN_MUL_ASSIGN, lexer.TOKEN_DIV_ASSIGN, lexer.TOKEN_MOD_ASSIGN,
+		lexer.TOKEN_AND_ASSIGN, lexer.TOKEN_OR_ASSIGN, lexer.TOKEN_XOR_ASSIGN,
+		lexer.TOKEN_LSHIFT_ASSIGN, lexer.TOKEN_RSHIFT_ASSIGN, lexer.TOKEN_AND_NOT_ASSIGN:
+		return true
+	}
+	return false
 }
 
-func (p *Parser) parseArgList() ([]ASTNode, error) {
-	args := []ASTNode{}
+// parseArgList parses call arguments; ellipsis reports a trailing "..."
+// spreading the last argument into a variadic parameter. When typeFirst
+// is set, as for the builtins make and new, the first argument is a type.
+func (p *Parser) parseArgList(typeFirst bool) (args []ASTNode, ellipsis bool, err error) {
+	args = []ASTNode{}
+	p.exprLev++
+	defer func() { p.exprLev-- }()
 
 	for !p.is(lexer. TOKEN_RPAREN) && ! p.is(lexer.TOKEN_EOF) {
-		expr, err := p.parseExpr()
+		var expr ASTNode
+		var err error
+		if typeFirst && len(args) == 0 {
+			expr, err = p.parseTypeExpr()
+		} else {
+			expr, err = p.parseExpr()
+		}
 		if err != nil {
-			return nil, err
+			return nil, false, err
 		}
 		args = append(args, expr)
 
-		if p. is(lexer.TOKEN_COMMA) {
-			p.advance()
+		if p.match(lexer.TOKEN_ELLIPSIS) {
+			ellipsis = true
+			p.match(lexer.TOKEN_COMMA)
+			break
+		}
+		if !p.match(lexer.TOKEN_COMMA) {
+			break
 		}
 	}
 
-	return args, nil
+	return args, ellipsis, nil
 }
 
 func (p *Parser) parseExpr() (ASTNode, error) {
-	return p.parseLogicalOr()
+	return p.parseNullCheck()
+}
+
+// parseNullCheck parses ?: and ??, which bind more loosely than any other
+// binary operator and associate to the right.
+func (p *Parser) parseNullCheck() (ASTNode, error) {
+	left, err := p.parseLogicalOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.is(lexer.TOKEN_ELVIS) || p.is(lexer.TOKEN_NULLISH) {
+		op := p.current.Value
+		p.advance()
+		def, err := p.parseNullCheck()
+		if err != nil {
+			return nil, err
+		}
+		return &NullCheckExpr{Span: p.span(left.Pos()), Expr: left, Op: op, DefaultExpr: def}, nil
+	}
+
+	return left, nil
 }
 
 func (p *Parser) parseLogicalOr() (ASTNode, error) {
@@ -636,7 +1550,7 @@ func (p *Parser) parseLogicalOr() (ASTNode, error) {
 		if err != nil {
 			return nil, err
 		}
-		left = &BinaryOp{Left: left, Op: op, Right: right}
+		left = &BinaryOp{Span: p.span(left.Pos()), Left: left, Op: op, Right: right}
 	}
 
 	return left, nil
@@ -655,7 +1569,7 @@ func (p *Parser) parseLogicalAnd() (ASTNode, error) {
 		if err != nil {
 			return nil, err
 		}
-		left = &BinaryOp{Left: left, Op: op, Right: right}
+		left = &BinaryOp{Span: p.span(left.Pos()), Left: left, Op: op, Right: right}
 	}
 
 	return left, nil
@@ -674,7 +1588,7 @@ func (p *Parser) parseEquality() (ASTNode, error) {
 		if err != nil {
 			return nil, err
 		}
-		left = &BinaryOp{Left: left, Op: op, Right: right}
+		left = &BinaryOp{Span: p.span(left.Pos()), Left: left, Op: op, Right: right}
 	}
 
 	return left, nil
@@ -693,7 +1607,7 @@ func (p *Parser) parseComparison() (ASTNode, error) {
 		if err != nil {
 			return nil, err
 		}
-		left = &BinaryOp{Left: left, Op: op, Right: right}
+		left = &BinaryOp{Span: p.span(left.Pos()), Left: left, Op: op, Right: right}
 	}
 
 	return left, nil
@@ -712,7 +1626,7 @@ func (p *Parser) parseBitwiseOr() (ASTNode, error) {
 		if err != nil {
 			return nil, err
 		}
-		left = &BinaryOp{Left: left, Op: op, Right: right}
+		left = &BinaryOp{Span: p.span(left.Pos()), Left: left, Op: op, Right: right}
 	}
 
 	return left, nil
@@ -731,7 +1645,7 @@ func (p *Parser) parseBitwiseXor() (ASTNode, error) {
 		if err != nil {
 			return nil, err
 		}
-		left = &BinaryOp{Left: left, Op: op, Right: right}
+		left = &BinaryOp{Span: p.span(left.Pos()), Left: left, Op: op, Right: right}
 	}
 
 	return left, nil
@@ -743,14 +1657,14 @@ func (p *Parser) parseBitwiseAnd() (ASTNode, error) {
 		return nil, err
 	}
 
-	for p.is(lexer.TOKEN_AND) && !p.peekIs(lexer.TOKEN_AND) {
+	for (p.is(lexer.TOKEN_AND) && !p.peekIs(lexer.TOKEN_AND)) || p.is(lexer.TOKEN_AND_NOT) {
 		op := p.current.Value
 		p.advance()
 		right, err := p.parseShift()
 		if err != nil {
 			return nil, err
 		}
-		left = &BinaryOp{Left: left, Op: op, Right: right}
+		left = &BinaryOp{Span: p.span(left.Pos()), Left: left, Op: op, Right: right}
 	}
 
 	return left, nil
@@ -769,7 +1683,7 @@ func (p *Parser) parseShift() (ASTNode, error) {
 		if err != nil {
 			return nil, err
 		}
-		left = &BinaryOp{Left: left, Op: op, Right: right}
+		left = &BinaryOp{Span: p.span(left.Pos()), Left: left, Op: op, Right: right}
 	}
 
 	return left, nil
@@ -788,7 +1702,7 @@ func (p *Parser) parseAdditive() (ASTNode, error) {
 		if err != nil {
 			return nil, err
 		}
-		left = &BinaryOp{Left: left, Op: op, Right: right}
+		left = &BinaryOp{Span: p.span(left.Pos()), Left: left, Op: op, Right: right}
 	}
 
 	return left, nil
@@ -807,21 +1721,31 @@ func (p *Parser) parseMultiplicative() (ASTNode, error) {
 		if err != nil {
 			return nil, err
 		}
-		left = &BinaryOp{Left: left, Op: op, Right: right}
+		left = &BinaryOp{Span: p.span(left.Pos()), Left: left, Op: op, Right: right}
 	}
 
 	return left, nil
 }
 
 func (p *Parser) parseUnary() (ASTNode, error) {
-	if p.is(lexer.TOKEN_LNOT) || p.is(lexer.TOKEN_MINUS) || p.is(lexer.TOKEN_PLUS) || p.is(lexer.TOKEN_AND) || p.is(lexer.TOKEN_MUL) {
+	start := p.pos()
+	if p.is(lexer.TOKEN_RECV) {
+		p.advance()
+		ch, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &ChanOp{Span: p.span(start), Op: "<-", Expr: ch}, nil
+	}
+
+	if p.is(lexer.TOKEN_LNOT) || p.is(lexer.TOKEN_MINUS) || p.is(lexer.TOKEN_PLUS) || p.is(lexer.TOKEN_XOR) || p.is(lexer.TOKEN_AND) || p.is(lexer.TOKEN_MUL) {
 		op := p.current. Value
 		p.advance()
 		right, err := p.parseUnary()
 		if err != nil {
 			return nil, err
 		}
-		return &UnaryOp{Op: op, Right: right}, nil
+		return &UnaryOp{Span: p.span(start), Op: op, Right: right}, nil
 	}
 
 	return p.parsePostfix()
@@ -835,30 +1759,65 @@ func (p *Parser) parsePostfix() (ASTNode, error) {
 
 	for {
 		if p.is(lexer.TOKEN_LBRACKET) {
+			if left, err = p.parseIndexOrInstance(left); err != nil {
+				return nil, err
+			}
+			if p.is(lexer.TOKEN_LBRACE) && p.exprLev >= 0 {
+				// A composite literal of an instantiated generic type.
+				typ, ok := exprToType(left)
+				if !ok {
+					return nil, p.errorAt(left.Pos(), "expected type before {")
+				}
+				if left, err = p.parseCompositeBody(left.Pos(), typ); err != nil {
+					return nil, err
+				}
+			}
+		} else if p.is(lexer.TOKEN_LPAREN) {
 			p.advance()
-			index, err := p.parseExpr()
+			args, ellipsis, err := p.parseArgList(isBuiltin(left, "make", "new"))
 			if err != nil {
 				return nil, err
 			}
-			p.expect(lexer.TOKEN_RBRACKET)
-			left = &IndexExpr{Expr: left, Index: index}
+			p.expect(lexer.TOKEN_RPAREN)
+			left = &CallExpr{Span: p.span(left.Pos()), Fun: left, Args: args, Ellipsis: ellipsis}
+		} else if p.is(lexer.TOKEN_DOT) && p.peekIs(lexer.TOKEN_LPAREN) {
+			p.advance()
+			p.advance()
+			var typ TypeExpr
+			if !p.match(lexer.TOKEN_TYPE) {
+				if typ, err = p.parseTypeExpr(); err != nil {
+					return nil, err
+				}
+			}
+			p.expect(lexer.TOKEN_RPAREN)
+			left = &TypeAssertExpr{Span: p.span(left.Pos()), Expr: left, Type: typ}
 		} else if p.is(lexer.TOKEN_DOT) {
 			p.advance()
+			fieldPos := p.pos()
+			if !p.is(lexer.TOKEN_IDENT) {
+				return nil, p.errorf("expected selector after ., got %s", p.found())
+			}
 			field := p.current.Value
 			p.advance()
-			left = &BinaryOp{Left: left, Op: ".", Right: &Identifier{Name: field}}
-		} else if p.is(lexer.TOKEN_QUESTION) {
-			p.advance()
-			if p.is(lexer.TOKEN_COLON) {
-				p.advance()
-				def, err := p.parseExpr()
-				if err != nil {
+			if pkg, ok := left.(*Identifier); ok && p.is(lexer.TOKEN_LBRACE) && p.exprLev >= 0 {
+				typ := &QualifiedType{Span: p.span(left.Pos()), Package: pkg.Name, Name: field}
+				if left, err = p.parseCompositeBody(left.Pos(), typ); err != nil {
 					return nil, err
 				}
-				left = &NullCheckExpr{Expr: left, DefaultExpr: def}
-			} else {
-				left = &NullableExpr{Expr: left}
+				continue
+			}
+			left = &SelectorExpr{Span: p.span(left.Pos()), X: left, Sel: &Identifier{Span: p.span(fieldPos), Name: field}}
+		} else if p.is(lexer.TOKEN_SAFE_DOT) {
+			p.advance()
+			if !p.is(lexer.TOKEN_IDENT) {
+				return nil, p.errorf("expected field name after ?., got %s", p.found())
 			}
+			field := p.current.Value
+			p.advance()
+			left = &SafeNavExpr{Span: p.span(left.Pos()), Expr: left, Field: field}
+		} else if p.is(lexer.TOKEN_QUESTION) {
+			p.advance()
+			left = &NullableExpr{Span: p.span(left.Pos()), Expr: left}
 		} else {
 			break
 		}
@@ -867,49 +1826,221 @@ func (p *Parser) parsePostfix() (ASTNode, error) {
 	return left, nil
 }
 
+// parseIndexOrInstance parses x[i], a slice expression, or x[T1, T2]
+// with explicit type arguments. Arguments that can only be types, such as
+// []int, also make an instantiation.
+func (p *Parser) parseIndexOrInstance(x ASTNode) (ASTNode, error) {
+	p.expect(lexer.TOKEN_LBRACKET)
+	p.exprLev++
+	defer func() { p.exprLev-- }()
+
+	var first ASTNode
+	var err error
+	typeOnly := p.is(lexer.TOKEN_LBRACKET) && p.peekIs(lexer.TOKEN_RBRACKET) ||
+		p.is(lexer.TOKEN_IDENT) && p.current.Value == "map" && p.peekIs(lexer.TOKEN_LBRACKET)
+	switch {
+	case typeOnly, p.is(lexer.TOKEN_CHAN), p.is(lexer.TOKEN_STRUCT), p.is(lexer.TOKEN_INTERFACE), p.is(lexer.TOKEN_QUESTION):
+		if first, err = p.parseTypeExpr(); err != nil {
+			return nil, err
+		}
+	case p.is(lexer.TOKEN_COLON):
+		return p.parseSlice(x, nil)
+	default:
+		if first, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+		if p.is(lexer.TOKEN_COLON) {
+			return p.parseSlice(x, first)
+		}
+		if !p.is(lexer.TOKEN_COMMA) {
+			p.expect(lexer.TOKEN_RBRACKET)
+			return &IndexExpr{Span: p.span(x.Pos()), Expr: x, Index: first}, nil
+		}
+	}
+
+	typ, ok := exprToType(first)
+	if !ok {
+		return nil, p.errorAt(first.Pos(), "expected type argument")
+	}
+	args := []TypeExpr{typ}
+	for p.match(lexer.TOKEN_COMMA) && !p.is(lexer.TOKEN_RBRACKET) {
+		arg, err := p.parseTypeExpr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	p.expect(lexer.TOKEN_RBRACKET)
+	return &InstanceExpr{Span: p.span(x.Pos()), Expr: x, TypeArgs: args}, nil
+}
+
+// parseSlice parses the rest of x[low:high] or x[low:high:max], from the
+// first colon to the closing bracket.
+func (p *Parser) parseSlice(x, low ASTNode) (ASTNode, error) {
+	var index [2]ASTNode
+	colons := 0
+	for colons < 2 && p.match(lexer.TOKEN_COLON) {
+		colons++
+		if p.is(lexer.TOKEN_COLON) || p.is(lexer.TOKEN_RBRACKET) {
+			continue
+		}
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		index[colons-1] = expr
+	}
+
+	slice3 := colons == 2
+	if slice3 && index[0] == nil {
+		return nil, p.errorf("middle index required in 3-index slice")
+	}
+	if slice3 && index[1] == nil {
+		return nil, p.errorf("final index required in 3-index slice")
+	}
+	p.expect(lexer.TOKEN_RBRACKET)
+	return &SliceExpr{Span: p.span(x.Pos()), Expr: x, Low: low, High: index[0], Max: index[1], Slice3: slice3}, nil
+}
+
+// isBuiltin reports whether x names one of the given builtins.
+func isBuiltin(x ASTNode, names ...string) bool {
+	ident, ok := x.(*Identifier)
+	if !ok {
+		return false
+	}
+	for _, name := range names {
+		if ident.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// exprToType converts an expression parsed where a type was meant, such
+// as the Box[int] of Box[int]{...}, to a type.
+func exprToType(x ASTNode) (TypeExpr, bool) {
+	switch e := x.(type) {
+	case TypeExpr:
+		return e, true
+	case *Identifier:
+		return &IdentType{Span: e.Span, Name: e.Name}, true
+	case *SelectorExpr:
+		if pkg, ok := e.X.(*Identifier); ok {
+			return &QualifiedType{Span: e.Span, Package: pkg.Name, Name: e.Sel.Name}, true
+		}
+	case *UnaryOp:
+		if e.Op == "*" {
+			if elem, ok := exprToType(e.Right); ok {
+				return &PointerType{Span: e.Span, Elem: elem}, true
+			}
+		}
+	case *IndexExpr:
+		base, ok := exprToType(e.Expr)
+		arg, ok2 := exprToType(e.Index)
+		if ok && ok2 {
+			return &GenericType{Span: e.Span, Base: base, Args: []TypeExpr{arg}}, true
+		}
+	case *InstanceExpr:
+		if base, ok := exprToType(e.Expr); ok {
+			return &GenericType{Span: e.Span, Base: base, Args: e.TypeArgs}, true
+		}
+	}
+	return nil, false
+}
+
 func (p *Parser) parsePrimary() (ASTNode, error) {
+	start := p.pos()
 	switch p.current.Type {
 	case lexer.TOKEN_INT:
 		value := p.current.Value
 		p.advance()
-		return &LiteralInt{Value: value}, nil
+		c, err := parseNumber(value, token.INT)
+		if err != nil {
+			return nil, p.errorAt(start, "%v", err)
+		}
+		return &LiteralInt{Span: p.span(start), Value: value, Base: numberBase(value, true), Const: c}, nil
 
 	case lexer.TOKEN_FLOAT:
-		value := p. current.Value
+		value := p.current.Value
+		p.advance()
+		c, err := parseNumber(value, token.FLOAT)
+		if err != nil {
+			return nil, p.errorAt(start, "%v", err)
+		}
+		return &LiteralFloat{Span: p.span(start), Value: value, Base: numberBase(value, false), Const: c}, nil
+
+	case lexer.TOKEN_IMAG:
+		value := p.current.Value
 		p.advance()
-		return &LiteralFloat{Value: value}, nil
+		c, err := parseNumber(value, token.IMAG)
+		if err != nil {
+			return nil, p.errorAt(start, "%v", err)
+		}
+		return &LiteralImag{Span: p.span(start), Value: value, Base: numberBase(value, false), Const: c}, nil
 
-	case lexer.TOKEN_STRING:
+	case lexer.TOKEN_STRING, lexer.TOKEN_RAW_STRING:
 		value := p.current.Value
+		raw := p.is(lexer.TOKEN_RAW_STRING)
+		p.advance()
+		return &LiteralString{Span: p.span(start), Value: value, Raw: raw}, nil
+
+	case lexer.TOKEN_CHAR:
+		value, _ := utf8.DecodeRuneInString(p.current.Value)
 		p.advance()
-		return &LiteralString{Value: value}, nil
+		return &LiteralChar{Span: p.span(start), Value: value}, nil
 
 	case lexer.TOKEN_BOOL:
 		value := p.current.Value == "true"
 		p.advance()
-		return &LiteralBool{Value: value}, nil
+		return &LiteralBool{Span: p.span(start), Value: value}, nil
 
 	case lexer.TOKEN_NULL:
 		p.advance()
-		return &LiteralNull{}, nil
+		return &LiteralNull{Span: p.span(start)}, nil
 
 	case lexer. TOKEN_IDENT:
-		name := p. current.Value
-		p.advance()
-		if p.is(lexer.TOKEN_LPAREN) {
-			p.advance()
-			args, err := p.parseArgList()
+		if p.current.Value == "map" && p.peekIs(lexer.TOKEN_LBRACKET) {
+			typ, err := p.parseTypeExpr()
 			if err != nil {
 				return nil, err
 			}
-			p.expect(lexer.TOKEN_RPAREN)
-			return &CallExpr{Func: name, Args: args}, nil
+			if !p.is(lexer.TOKEN_LBRACE) {
+				return nil, p.errorf("expected { after map type, got %s", p.found())
+			}
+			return p.parseCompositeBody(start, typ)
 		}
-		return &Identifier{Name: name}, nil
+		name := p. current.Value
+		p.advance()
+		if p.is(lexer.TOKEN_LBRACE) && p.exprLev >= 0 {
+			return p.parseCompositeBody(start, &IdentType{Span: p.span(start), Name: name})
+		}
+		return &Identifier{Span: p.span(start), Name: name}, nil
+
+	case lexer.TOKEN_FUNC:
+		p.advance()
+		sig, err := p.parseSignature(start)
+		if err != nil {
+			return nil, err
+		}
+		p.expect(lexer.TOKEN_LBRACE)
+		outer := p.exprLev
+		p.exprLev = 0
+		body, err := p.parseBlock()
+		p.exprLev = outer
+		if err != nil {
+			return nil, err
+		}
+		p.expect(lexer.TOKEN_RBRACE)
+		return &FuncLit{Span: p.span(start), Type: sig, Body: body}, nil
 
 	case lexer.TOKEN_LPAREN:
+		if p.isArrowFunc() {
+			return p.parseArrowFunc()
+		}
 		p.advance()
+		p.exprLev++
 		expr, err := p.parseExpr()
+		p.exprLev--
 		if err != nil {
 			return nil, err
 		}
@@ -924,77 +2055,462 @@ func (p *Parser) parsePrimary() (ASTNode, error) {
 
 	case lexer. TOKEN_RECOVER:
 		p.advance()
-		return &RecoverExpr{}, nil
+		if p.match(lexer.TOKEN_LPAREN) {
+			p.expect(lexer.TOKEN_RPAREN)
+		}
+		return &RecoverExpr{Span: p.span(start)}, nil
 
 	default:
-		return nil, fmt.Errorf("unexpected primary: %v", p.current. Type)
+		p.errorf("expected expression, got %s", p.found())
+		switch p.current.Type {
+		case lexer.TOKEN_SEMICOLON, lexer.TOKEN_RPAREN, lexer.TOKEN_RBRACKET,
+			lexer.TOKEN_RBRACE, lexer.TOKEN_COMMA, lexer.TOKEN_EOF:
+			// Leave closing tokens for the enclosing construct.
+		default:
+			p.advance()
+		}
+		return &BadExpr{Span: p.span(start)}, nil
 	}
 }
 
-func (p *Parser) parseArrayOrSlice() (ASTNode, error) {
-	p. expect(lexer.TOKEN_LBRACKET)
+// isArrowFunc reports whether the parenthesis at the current token opens
+// the parameters of an arrow function rather than an expression: either
+// "() ->" or "(name:".
+func (p *Parser) isArrowFunc() bool {
+	switch p.lookahead(1).Type {
+	case lexer.TOKEN_RPAREN:
+		return p.lookahead(2).Type == lexer.TOKEN_ARROW
+	case lexer.TOKEN_IDENT:
+		return p.lookahead(2).Type == lexer.TOKEN_COLON
+	}
+	return false
+}
 
-	if p.is(lexer.TOKEN_RBRACKET) {
-		p.advance()
-		elemType := p.current.Value
-		p.advance()
-		return &ArrayLiteral{Type: elemType, Elements: []ASTNode{}}, nil
+// parseArrowFunc parses (x: int) -> expr.
+func (p *Parser) parseArrowFunc() (*FuncLit, error) {
+	start := p.pos()
+	sig, err := p.parseSignature(start)
+	if err != nil {
+		return nil, err
+	}
+	p.expect(lexer.TOKEN_ARROW)
+	body, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	ret := &ReturnStmt{Span: Span{From: body.Pos(), To: body.End()}, Values: []ASTNode{body}}
+	return &FuncLit{Span: p.span(start), Type: sig, Body: []ASTNode{ret}, Arrow: true}, nil
+}
+
+// parseArrayOrSlice parses []T{...} and [N]T{...}, the untyped [a, b]
+// form, and []T alone, which is an empty slice.
+func (p *Parser) parseArrayOrSlice() (ASTNode, error) {
+	start := p.pos()
+	if p.peekIs(lexer.TOKEN_RBRACKET) {
+		typ, err := p.parseTypeExpr()
+		if err != nil {
+			return nil, err
+		}
+		if slice, ok := typ.(*SliceType); ok && !p.is(lexer.TOKEN_LBRACE) {
+			return &ArrayLiteral{Span: p.span(start), Type: slice.Elem, Elements: []ASTNode{}}, nil
+		}
+		return p.parseCompositeBody(start, typ)
 	}
 
+	p.expect(lexer.TOKEN_LBRACKET)
+	p.exprLev++
 	elements := []ASTNode{}
-	for ! p.is(lexer.TOKEN_RBRACKET) {
+	for !p.is(lexer.TOKEN_RBRACKET) && !p.is(lexer.TOKEN_EOF) {
 		expr, err := p.parseExpr()
 		if err != nil {
+			p.exprLev--
 			return nil, err
 		}
 		elements = append(elements, expr)
-		if p.is(lexer.TOKEN_COMMA) {
-			p.advance()
+		if !p.match(lexer.TOKEN_COMMA) {
+			break
 		}
 	}
+	p.exprLev--
 	p.expect(lexer. TOKEN_RBRACKET)
 
-	return &ArrayLiteral{Type: "", Elements: elements}, nil
+	// [N]T{...}: a single length followed by an element type.
+	if len(elements) == 1 && startsType(p.current.Type) && !p.is(lexer.TOKEN_QUESTION) {
+		elem, err := p.parseTypeExpr()
+		if err != nil {
+			return nil, err
+		}
+		return p.parseCompositeBody(start, &ArrayType{Span: p.span(start), Len: elements[0], Elem: elem})
+	}
+
+	return &ArrayLiteral{Span: p.span(start), Elements: elements}, nil
 }
 
+// parseMapOrStruct parses the untyped {key: value} map literal, whose
+// keys are always strings.
 func (p *Parser) parseMapOrStruct() (ASTNode, error) {
+	start := p.pos()
 	p. expect(lexer.TOKEN_LBRACE)
+	p.exprLev++
+	defer func() { p.exprLev-- }()
 
-	pairs := make(map[string]ASTNode)
-	for !p.is(lexer.TOKEN_RBRACE) {
-		key := p.current.Value
+	entries := []*KeyValueExpr{}
+	for !p.is(lexer.TOKEN_RBRACE) && !p.is(lexer.TOKEN_EOF) {
+		keyStart := p.pos()
+		key := &LiteralString{Value: p.current.Value}
 		p.advance()
+		key.Span = p.span(keyStart)
 		p.expect(lexer.TOKEN_COLON)
 		value, err := p.parseExpr()
 		if err != nil {
 			return nil, err
 		}
-		pairs[key] = value
-		if p.is(lexer. TOKEN_COMMA) {
-			p.advance()
+		entries = append(entries, &KeyValueExpr{Span: p.span(keyStart), Key: key, Value: value})
+		if !p.match(lexer.TOKEN_COMMA) {
+			break
+		}
+	}
+	p.expect(lexer.TOKEN_RBRACE)
+
+	return &MapLiteral{Span: p.span(start), Entries: entries}, nil
+}
+
+// parseCompositeBody parses the braced elements of a literal of type typ.
+// Elements that are themselves literals may omit their type, which is
+// then taken from typ.
+func (p *Parser) parseCompositeBody(start Pos, typ TypeExpr) (ASTNode, error) {
+	if ptr, ok := typ.(*PointerType); ok {
+		// An elided &T{...}.
+		lit, err := p.parseCompositeBody(start, ptr.Elem)
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryOp{Span: p.span(start), Op: "&", Right: lit}, nil
+	}
+
+	// The type of the first expression of an element: a key for maps,
+	// otherwise the value itself.
+	var keyType, elemType TypeExpr
+	switch t := typ.(type) {
+	case *SliceType:
+		keyType, elemType = t.Elem, t.Elem
+	case *ArrayType:
+		keyType, elemType = t.Elem, t.Elem
+	case *MapType:
+		keyType, elemType = t.Key, t.Value
+	}
+
+	p.expect(lexer.TOKEN_LBRACE)
+	p.exprLev++
+	defer func() { p.exprLev-- }()
+	elements := []*KeyValueExpr{}
+	for !p.is(lexer.TOKEN_RBRACE) && !p.is(lexer.TOKEN_EOF) {
+		elemStart := p.pos()
+		value, err := p.parseElement(keyType)
+		if err != nil {
+			return nil, err
+		}
+		elem := &KeyValueExpr{Value: value}
+		if p.match(lexer.TOKEN_COLON) {
+			elem.Key = value
+			if elem.Value, err = p.parseElement(elemType); err != nil {
+				return nil, err
+			}
+		}
+		elem.Span = p.span(elemStart)
+		elements = append(elements, elem)
+		if !p.match(lexer.TOKEN_COMMA) {
+			break
 		}
 	}
 	p.expect(lexer.TOKEN_RBRACE)
 
-	return &MapLiteral{Pairs: pairs}, nil
+	switch t := typ.(type) {
+	case *SliceType, *ArrayType:
+		lit := &ArrayLiteral{Span: p.span(start), Type: elemType, Elements: make([]ASTNode, len(elements))}
+		if a, ok := t.(*ArrayType); ok {
+			lit.Len = a.Len
+		}
+		for i, elem := range elements {
+			if elem.Key != nil {
+				return nil, p.errorAt(elem.Pos(), "unexpected key in slice literal")
+			}
+			lit.Elements[i] = elem.Value
+		}
+		return lit, nil
+	case *MapType:
+		for _, elem := range elements {
+			if elem.Key == nil {
+				return nil, p.errorAt(elem.Pos(), "missing key in map literal")
+			}
+		}
+		return &MapLiteral{Span: p.span(start), KeyType: keyType, ValueType: elemType, Entries: elements}, nil
+	}
+	return &StructLiteral{Span: p.span(start), Type: typ, Fields: elements}, nil
+}
+
+// parseElement parses one expression of a composite literal element,
+// where a bare {...} is a literal of the elided type typ.
+func (p *Parser) parseElement(typ TypeExpr) (ASTNode, error) {
+	if typ != nil && p.is(lexer.TOKEN_LBRACE) {
+		return p.parseCompositeBody(p.pos(), typ)
+	}
+	return p.parseExpr()
+}
+
+// parseNumber evaluates a numeric literal exactly, rejecting malformed
+// spellings such as misplaced '_' separators or 9 in an octal literal.
+func parseNumber(lit string, kind token.Token) (constant.Value, error) {
+	c := constant.MakeFromLiteral(lit, kind, 0)
+	if c.Kind() == constant.Unknown {
+		return nil, fmt.Errorf("invalid number literal: %s", lit)
+	}
+	return c, nil
+}
+
+// numberBase reports the radix a numeric literal is written in. A leading
+// zero only denotes octal for integers; 0755.5 and 0755i are decimal.
+func numberBase(lit string, isInt bool) int {
+	if len(lit) < 2 || lit[0] != '0' {
+		return 10
+	}
+	switch lit[1] {
+	case 'x', 'X':
+		return 16
+	case 'o', 'O':
+		return 8
+	case 'b', 'B':
+		return 2
+	}
+	if isInt {
+		return 8
+	}
+	return 10
 }
 
+// advance moves to the next token, gathering any comments on the way into
+// comment groups and noting lead and line comments as go/parser does.
 func (p *Parser) advance() {
-	p.pos++
-	if p.pos < len(p.tokens) {
-		p.current = p.tokens[p.pos]
-		if p.pos+1 < len(p.tokens) {
-			p.peekToken = p.tokens[p.pos+1]
+	if p.current.Type != "" {
+		p.prevEnd = Pos{File: p.Filename, Offset: p.current.EndOffset, Line: p.current.EndLine, Col: p.current.EndCol}
+	}
+	p.leadComment = nil
+	p.lineComment = nil
+	prevLine := p.current.Line
+	p.next()
+
+	if p.is(lexer.TOKEN_COMMENT) {
+		var comment *CommentGroup
+		var endline int
+
+		if p.current.Line == prevLine {
+			// The comment is on the same line as the previous token; it
+			// cannot be a lead comment but may be a line comment.
+			comment, endline = p.consumeCommentGroup(0)
+			if p.current.Line != endline || p.is(lexer.TOKEN_EOF) {
+				p.lineComment = comment
+			}
+		}
+
+		// Consume successor comments, if any
+		endline = -1
+		for p.is(lexer.TOKEN_COMMENT) {
+			comment, endline = p.consumeCommentGroup(1)
+		}
+
+		if endline+1 == p.current.Line {
+			// The next token follows on the line immediately after the
+			// group, so the group is its lead comment.
+			p.leadComment = comment
+		}
+	}
+
+}
+
+// pos returns the position of the current token.
+func (p *Parser) pos() Pos {
+	return Pos{File: p.Filename, Offset: p.current.Offset, Line: p.current.Line, Col: p.current.Col}
+}
+
+// span returns the extent from start to the end of the last token consumed.
+func (p *Parser) span(start Pos) Span {
+	return Span{From: start, To: p.prevEnd}
+}
+
+// next moves to the following token without skipping comments.
+func (p *Parser) next() {
+	if len(p.ahead) > 0 {
+		p.current = p.ahead[0]
+		p.ahead = p.ahead[:copy(p.ahead, p.ahead[1:])]
+		return
+	}
+	p.current = p.src.NextToken()
+}
+
+// lookahead returns the n-th token after the current one, not counting
+// comments, reading it from the source if necessary.
+func (p *Parser) lookahead(n int) lexer.Token {
+	for i := 0; ; i++ {
+		if i == len(p.ahead) {
+			p.ahead = append(p.ahead, p.src.NextToken())
+		}
+		tok := p.ahead[i]
+		if tok.Type == lexer.TOKEN_COMMENT {
+			continue
+		}
+		if n--; n == 0 || tok.Type == lexer.TOKEN_EOF {
+			return tok
 		}
 	}
 }
 
+// consumeCommentGroup collects adjacent comments that are at most n lines
+// apart and returns the group with the line its last comment ends on.
+func (p *Parser) consumeCommentGroup(n int) (*CommentGroup, int) {
+	group := &CommentGroup{}
+	endline := p.current.Line
+	for p.is(lexer.TOKEN_COMMENT) && p.current.Line <= endline+n {
+		c := &Comment{Text: p.current.Value, Line: p.current.Line, Col: p.current.Col, Offset: p.current.Offset}
+		group.List = append(group.List, c)
+		endline = c.Line + strings.Count(c.Text, "\n")
+		p.next()
+	}
+	p.comments = append(p.comments, group)
+	return group, endline
+}
+
 func (p *Parser) is(typ lexer.TokenType) bool {
 	return p.current.Type == typ
 }
 
 func (p *Parser) peekIs(typ lexer.TokenType) bool {
-	return p.peekToken.Type == typ
+	return p.lookahead(1).Type == typ
+}
+
+// expectSemi consumes the terminator after a statement or declaration,
+// either written or inserted at a line break by the lexer. As in Go it may
+// be omitted before a closing ")" or "}".
+func (p *Parser) expectSemi() error {
+	switch p.current.Type {
+	case lexer.TOKEN_SEMICOLON:
+		p.advance()
+		return nil
+	case lexer.TOKEN_RPAREN, lexer.TOKEN_RBRACE, lexer.TOKEN_EOF:
+		return nil
+	}
+	return p.errorf("expected ; or newline, got %s", p.found())
+}
+
+// parseTerminator consumes the terminator after a declaration or
+// statement, then attaches doc, the comment group that preceded it, and
+// any comment trailing it on the same line.
+func (p *Parser) parseTerminator(node ASTNode, doc *CommentGroup) error {
+	endsLine := p.is(lexer.TOKEN_SEMICOLON)
+	if err := p.expectSemi(); err != nil {
+		return err
+	}
+	var comment *CommentGroup
+	if endsLine {
+		comment = p.lineComment
+	}
+
+	switch n := node.(type) {
+	case *PackageDecl:
+		n.Doc, n.Comment = doc, comment
+	case *ImportDecl:
+		n.Doc, n.Comment = doc, comment
+	case *FuncDecl:
+		n.Doc, n.Comment = doc, comment
+	case *VarDecl:
+		n.Doc, n.Comment = doc, comment
+	case *ConstDecl:
+		n.Doc, n.Comment = doc, comment
+	case *TypeDecl:
+		n.Doc, n.Comment = doc, comment
+	case *StructDecl:
+		n.Doc, n.Comment = doc, comment
+	case *InterfaceDecl:
+		n.Doc, n.Comment = doc, comment
+	case *GenDecl:
+		n.Doc, n.Comment = doc, comment
+	}
+	return nil
+}
+
+// errorf records a syntax error at the current token and returns it. As
+// in go/parser only the first error on a line is kept, since any others
+// are usually knock-on effects of it.
+func (p *Parser) errorf(format string, args ...interface{}) error {
+	return p.errorAt(p.pos(), format, args...)
+}
+
+func (p *Parser) errorAt(pos Pos, format string, args ...interface{}) error {
+	err := &SyntaxError{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+	if n := len(p.errors); n == 0 || p.errors[n-1].Pos.Line != pos.Line {
+		p.errors = append(p.errors, err)
+	}
+	return err
+}
+
+// found describes the current token for error messages.
+func (p *Parser) found() string {
+	switch {
+	case p.is(lexer.TOKEN_SEMICOLON) && p.current.Value == "\n":
+		return "newline"
+	case p.is(lexer.TOKEN_IDENT):
+		return "identifier " + p.current.Value
+	}
+	return string(p.current.Type)
+}
+
+// syncStmt skips the rest of a malformed statement that began at start:
+// up to and including the next semicolon, or up to a closing brace or the
+// keyword of a following statement. It always consumes at least one token.
+func (p *Parser) syncStmt(start Pos) {
+	if p.current.Offset == start.Offset && !p.is(lexer.TOKEN_EOF) {
+		p.advance()
+	}
+	for !p.atDecl() {
+		switch p.current.Type {
+		case lexer.TOKEN_SEMICOLON:
+			p.advance()
+			return
+		case lexer.TOKEN_RBRACE, lexer.TOKEN_CASE, lexer.TOKEN_DEFAULT, lexer.TOKEN_EOF,
+			lexer.TOKEN_VAR, lexer.TOKEN_CONST, lexer.TOKEN_RETURN, lexer.TOKEN_IF,
+			lexer.TOKEN_FOR, lexer.TOKEN_DEFER, lexer.TOKEN_GO, lexer.TOKEN_SELECT,
+			lexer.TOKEN_PANIC:
+			return
+		}
+		p.advance()
+	}
+}
+
+// atDecl reports whether the current token is the keyword of a top-level
+// declaration at the start of a line. No statement starts there, so it
+// ends any block left open before it.
+func (p *Parser) atDecl() bool {
+	switch p.current.Type {
+	case lexer.TOKEN_PACKAGE, lexer.TOKEN_IMPORT, lexer.TOKEN_FUNC, lexer.TOKEN_TYPE,
+		lexer.TOKEN_VAR, lexer.TOKEN_CONST:
+		return p.current.Col == 1
+	}
+	return false
+}
+
+// syncDecl skips the rest of a malformed declaration that began at start,
+// up to the keyword of the next top-level declaration.
+func (p *Parser) syncDecl(start Pos) {
+	if p.current.Offset == start.Offset && !p.is(lexer.TOKEN_EOF) {
+		p.advance()
+	}
+	for {
+		switch p.current.Type {
+		case lexer.TOKEN_PACKAGE, lexer.TOKEN_IMPORT, lexer.TOKEN_FUNC, lexer.TOKEN_TYPE,
+			lexer.TOKEN_VAR, lexer.TOKEN_CONST, lexer.TOKEN_EOF:
+			return
+		}
+		p.advance()
+	}
 }
 
 func (p *Parser) match(typ lexer.TokenType) bool {
@@ -1007,7 +2523,7 @@ func (p *Parser) match(typ lexer.TokenType) bool {
 
 func (p *Parser) expect(typ lexer.TokenType) error {
 	if !p.is(typ) {
-		return fmt.Errorf("expected %v, got %v", typ, p.current.Type)
+		return p.errorf("expected %v, got %s", typ, p.found())
 	}
 	p.advance()
 	return nil
@@ -0,0 +1,759 @@
+package parser
+
+import (
+	"fmt"
+	"go/constant"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/MistyPigeon/lingo/pkg/lexer"
+)
+
+// parseTest is a source snippet and the dump of what it parses to.
+type parseTest struct {
+	src  string
+	want string
+}
+
+func parse(t *testing.T, src string) *Program {
+	t.Helper()
+	program, err := New(lexer.New(src).Tokenize()).Parse()
+	if err != nil {
+		t.Fatalf("%s\nunexpected error: %v", src, err)
+	}
+	return program
+}
+
+// parseBody parses src as the body of a function and dumps its statements.
+func parseBody(t *testing.T, src string) string {
+	t.Helper()
+	fn := parse(t, "func f() {\n"+src+"\n}").Items[0].(*FuncDecl)
+	stmts := make([]string, len(fn.Body))
+	for i, stmt := range fn.Body {
+		stmts[i] = dump(stmt)
+	}
+	return strings.Join(stmts, "; ")
+}
+
+// parseExpr parses src as the value of an assignment and dumps it.
+func parseExpr(t *testing.T, src string) string {
+	t.Helper()
+	fn := parse(t, "func f() {\n_ = "+src+"\n}").Items[0].(*FuncDecl)
+	return dump(fn.Body[0].(*AssignStmt).Rhs[0])
+}
+
+// parseDecl parses src as a top-level declaration and dumps it.
+func parseDecl(t *testing.T, src string) string {
+	t.Helper()
+	return dump(parse(t, src).Items[0])
+}
+
+func runParseTests(t *testing.T, parse func(*testing.T, string) string, tests []parseTest) {
+	t.Helper()
+	for _, tt := range tests {
+		if got := parse(t, tt.src); got != tt.want {
+			t.Errorf("%s\n got %s\nwant %s", tt.src, got, tt.want)
+		}
+	}
+}
+
+// runErrorTests parses each source and compares its first syntax error
+// with want.
+func runErrorTests(t *testing.T, tests []parseTest) {
+	t.Helper()
+	for _, tt := range tests {
+		_, err := New(lexer.New(tt.src).Tokenize()).Parse()
+		list, ok := err.(ErrorList)
+		if !ok || len(list) == 0 {
+			t.Errorf("%s\ngot %v, want error %q", tt.src, err, tt.want)
+			continue
+		}
+		if got := list[0].Error(); got != tt.want {
+			t.Errorf("%s\ngot error %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
+
+// dump renders a node as Go-like composite literal syntax, leaving out
+// positions, comments, zero fields and empty lists. Identifiers are written as their
+// name and type expressions as their string form.
+func dump(node interface{}) string {
+	return dumpValue(reflect.ValueOf(node))
+}
+
+func dumpValue(v reflect.Value) string {
+	if !v.IsValid() {
+		return "nil"
+	}
+	switch x := v.Interface().(type) {
+	case *Identifier:
+		if x != nil {
+			return x.Name
+		}
+	case TypeExpr:
+		if !v.IsNil() {
+			return x.String()
+		}
+	case constant.Value:
+		return x.ExactString()
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return "nil"
+		}
+		return dumpValue(v.Elem())
+	case reflect.Slice:
+		elems := make([]string, v.Len())
+		for i := range elems {
+			elems[i] = dumpValue(v.Index(i))
+		}
+		return "[" + strings.Join(elems, ", ") + "]"
+	case reflect.Struct:
+		var fields []string
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			switch f.Name {
+			case "Span", "Doc", "Comment", "Comments":
+				continue
+			}
+			if field := v.Field(i); field.IsZero() || field.Kind() == reflect.Slice && field.Len() == 0 {
+				continue
+			}
+			fields = append(fields, f.Name+": "+dumpValue(v.Field(i)))
+		}
+		return v.Type().Name() + "{" + strings.Join(fields, ", ") + "}"
+	case reflect.String:
+		return fmt.Sprintf("%q", v.String())
+	case reflect.Int32:
+		return fmt.Sprintf("%q", rune(v.Int()))
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+func TestNumericLiterals(t *testing.T) {
+	runParseTests(t, parseExpr, []parseTest{
+		{`42`, `LiteralInt{Value: "42", Base: 10, Const: 42}`},
+		{`0xFF`, `LiteralInt{Value: "0xFF", Base: 16, Const: 255}`},
+		{`0b1010`, `LiteralInt{Value: "0b1010", Base: 2, Const: 10}`},
+		{`0o755`, `LiteralInt{Value: "0o755", Base: 8, Const: 493}`},
+		{`0755`, `LiteralInt{Value: "0755", Base: 8, Const: 493}`},
+		{`1_000_000`, `LiteralInt{Value: "1_000_000", Base: 10, Const: 1000000}`},
+		{`1e9`, `LiteralFloat{Value: "1e9", Base: 10, Const: 1000000000}`},
+		{`.5`, `LiteralFloat{Value: ".5", Base: 10, Const: 1/2}`},
+		{`0x1p-2`, `LiteralFloat{Value: "0x1p-2", Base: 16, Const: 1/4}`},
+		{`2i`, `LiteralImag{Value: "2i", Base: 10, Const: (0 + 2i)}`},
+		{`-1`, `UnaryOp{Op: "-", Right: LiteralInt{Value: "1", Base: 10, Const: 1}}`},
+	})
+}
+
+func TestStringAndRuneLiterals(t *testing.T) {
+	runParseTests(t, parseExpr, []parseTest{
+		{`"a\tb"`, `LiteralString{Value: "a\tb"}`},
+		{"`a\\tb`", `LiteralString{Value: "a\\tb", Raw: true}`},
+		{`'x'`, `LiteralChar{Value: 'x'}`},
+		{`'\n'`, `LiteralChar{Value: '\n'}`},
+		{`'世'`, `LiteralChar{Value: '世'}`},
+	})
+}
+
+func TestStatementTerminators(t *testing.T) {
+	runParseTests(t, parseBody, []parseTest{
+		{"return\nf()", `ReturnStmt{}; CallExpr{Fun: f}`},
+		{"return\nx + y + z", `ReturnStmt{}; BinaryOp{Left: BinaryOp{Left: x, Op: "+", Right: y}, Op: "+", Right: z}`},
+		{"x := a\n(b)()", `ShortAssignStmt{Lhs: [x], Rhs: [a]}; CallExpr{Fun: b}`},
+		{"x := a; y := b", `ShortAssignStmt{Lhs: [x], Rhs: [a]}; ShortAssignStmt{Lhs: [y], Rhs: [b]}`},
+		{"x := a +\nb", `ShortAssignStmt{Lhs: [x], Rhs: [BinaryOp{Left: a, Op: "+", Right: b}]}`},
+		{"f(a,\nb,\n)", `CallExpr{Fun: f, Args: [a, b]}`},
+		{"if x { return }", `IfStmt{Condition: x, Then: [ReturnStmt{}]}`},
+		{";;", ``},
+	})
+	runErrorTests(t, []parseTest{
+		{"func f() {\nx := 1 y := 2\n}", "2:8: expected ; or newline, got identifier y"},
+		{"func f() {\nreturn 1 2\n}", "2:10: expected ; or newline, got INT"},
+	})
+}
+
+func TestComments(t *testing.T) {
+	src := `// Package demo does things.
+package demo
+
+// Point is a point.
+// It has two fields.
+type Point struct {
+	x: int
+	y: int
+}
+
+/* Limit is the limit. */
+const Limit = 10 // inclusive
+
+// unattached
+
+var count: int // how many
+
+// Add adds.
+func Add(a: int, b: int) int {
+	return a + b
+}
+`
+	lex := lexer.New(src)
+	lex.Mode = lexer.ScanComments
+	program, err := NewFromSource(lex).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		doc, comment string
+	}{
+		{"Package demo does things.\n", ""},
+		{"Point is a point.\nIt has two fields.\n", ""},
+		{" Limit is the limit.\n", "inclusive\n"},
+		{"", "how many\n"},
+		{"Add adds.\n", ""},
+	}
+	if len(program.Items) != len(tests) {
+		t.Fatalf("got %d items, want %d", len(program.Items), len(tests))
+	}
+	for i, tt := range tests {
+		v := reflect.ValueOf(program.Items[i]).Elem()
+		doc := v.FieldByName("Doc").Interface().(*CommentGroup)
+		comment := v.FieldByName("Comment").Interface().(*CommentGroup)
+		if doc.Text() != tt.doc || comment.Text() != tt.comment {
+			t.Errorf("item %d (%T): got doc %q, comment %q; want %q, %q",
+				i, program.Items[i], doc.Text(), comment.Text(), tt.doc, tt.comment)
+		}
+	}
+	if got := len(program.Comments); got != 7 {
+		t.Errorf("got %d comment groups, want 7", got)
+	}
+}
+
+func TestFieldComments(t *testing.T) {
+	src := `type Point struct {
+	// X is across.
+	x: int // in pixels
+	y: int
+}
+
+type Shape interface {
+	// Area returns the area.
+	Area() float64 // never negative
+}
+`
+	lex := lexer.New(src)
+	lex.Mode = lexer.ScanComments
+	program, err := NewFromSource(lex).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields := program.Items[0].(*StructDecl).Fields
+	method := program.Items[1].(*InterfaceDecl).Methods[0]
+	tests := []struct {
+		doc, comment *CommentGroup
+		wantDoc      string
+		wantComment  string
+	}{
+		{fields[0].Doc, fields[0].Comment, "X is across.\n", "in pixels\n"},
+		{fields[1].Doc, fields[1].Comment, "", ""},
+		{method.Doc, method.Comment, "Area returns the area.\n", "never negative\n"},
+	}
+	for i, tt := range tests {
+		if tt.doc.Text() != tt.wantDoc || tt.comment.Text() != tt.wantComment {
+			t.Errorf("%d: got doc %q, comment %q; want %q, %q",
+				i, tt.doc.Text(), tt.comment.Text(), tt.wantDoc, tt.wantComment)
+		}
+	}
+}
+
+// countingSource is a TokenSource that records how far it has been read.
+type countingSource struct {
+	lex  *lexer.Lexer
+	read int
+}
+
+func (s *countingSource) NextToken() lexer.Token {
+	s.read++
+	return s.lex.NextToken()
+}
+
+func TestTokenSource(t *testing.T) {
+	src := "package main\n\nfunc f(x: int) int {\n\treturn x * 2\n}\n\nvar y: int = f(1)\n"
+	want := dump(parse(t, src))
+
+	source := &countingSource{lex: lexer.NewReader(strings.NewReader(src))}
+	p := NewFromSource(source)
+	if source.read > 4 {
+		t.Errorf("NewFromSource read %d tokens ahead", source.read)
+	}
+	program, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := dump(program); got != want {
+		t.Errorf("got %s\nwant %s", got, want)
+	}
+}
+
+func TestAssignOperators(t *testing.T) {
+	runParseTests(t, parseBody, []parseTest{
+		{`x += 1`, `AssignStmt{Lhs: [x], Op: "+=", Rhs: [LiteralInt{Value: "1", Base: 10, Const: 1}]}`},
+		{`x &^= m`, `AssignStmt{Lhs: [x], Op: "&^=", Rhs: [m]}`},
+		{`a[i] <<= n`, `AssignStmt{Lhs: [IndexExpr{Expr: a, Index: i}], Op: "<<=", Rhs: [n]}`},
+		{`i++`, `IncDecStmt{X: i, Op: "++"}`},
+		{`p.n--`, `IncDecStmt{X: SelectorExpr{X: p, Sel: n}, Op: "--"}`},
+		{`ch <- v`, `ChanOp{Op: "<-", Expr: ch, Value: v}`},
+		{`f(xs...)`, `CallExpr{Fun: f, Args: [xs], Ellipsis: true}`},
+	})
+	runParseTests(t, parseExpr, []parseTest{
+		{`<-ch`, `ChanOp{Op: "<-", Expr: ch}`},
+		{`a &^ b`, `BinaryOp{Left: a, Op: "&^", Right: b}`},
+	})
+	runParseTests(t, parseDecl, []parseTest{
+		{`func f(xs: ...int) {}`, `FuncDecl{Name: "f", Params: [Param{Name: "xs", Type: int, Variadic: true}]}`},
+	})
+	runErrorTests(t, []parseTest{
+		{"func f() {\nx++ = 1\n}", "2:5: expected ; or newline, got ="},
+		{"func f(xs: ...int, y: int) {}", "1:8: can only use ... with final parameter"},
+		{"var g: func(...int, string)", "1:13: can only use ... with final parameter"},
+	})
+}
+
+func TestNullSafetyOperators(t *testing.T) {
+	runParseTests(t, parseExpr, []parseTest{
+		{`a ?: b`, `NullCheckExpr{Expr: a, Op: "?:", DefaultExpr: b}`},
+		{`a ?? b`, `NullCheckExpr{Expr: a, Op: "??", DefaultExpr: b}`},
+		{`a?.b`, `SafeNavExpr{Expr: a, Field: "b"}`},
+		{`a?.b?.c`, `SafeNavExpr{Expr: SafeNavExpr{Expr: a, Field: "b"}, Field: "c"}`},
+		{`a?`, `NullableExpr{Expr: a}`},
+		{`a ?: b ?: c`, `NullCheckExpr{Expr: a, Op: "?:", DefaultExpr: NullCheckExpr{Expr: b, Op: "?:", DefaultExpr: c}}`},
+	})
+	runParseTests(t, parseDecl, []parseTest{
+		{`var x: ?string = null`, `VarDecl{Name: "x", Type: string, Value: LiteralNull{}, IsNullable: true}`},
+		{`var x: ? string`, `VarDecl{Name: "x", Type: string, IsNullable: true}`},
+		{`func f(s: ?string) ?int {}`, `FuncDecl{Name: "f", Params: [Param{Name: "s", Type: ?string}], Returns: [?int]}`},
+	})
+}
+
+func TestPositions(t *testing.T) {
+	src := "func f(a: int) int {\n\tx := a + 10\n\treturn f(x)\n}\n"
+	p := New(lexer.New(src).Tokenize())
+	p.Filename = "f.lingo"
+	program, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := program.Items[0].(*FuncDecl)
+	assign := fn.Body[0].(*ShortAssignStmt)
+	sum := assign.Rhs[0].(*BinaryOp)
+	ret := fn.Body[1].(*ReturnStmt)
+	call := ret.Values[0].(*CallExpr)
+
+	tests := []struct {
+		node     ASTNode
+		pos, end string
+	}{
+		{fn, "f.lingo:1:1", "f.lingo:4:2"},
+		{assign, "f.lingo:2:2", "f.lingo:2:13"},
+		{assign.Lhs[0], "f.lingo:2:2", "f.lingo:2:3"},
+		{sum, "f.lingo:2:7", "f.lingo:2:13"},
+		{sum.Right, "f.lingo:2:11", "f.lingo:2:13"},
+		{ret, "f.lingo:3:2", "f.lingo:3:13"},
+		{call, "f.lingo:3:9", "f.lingo:3:13"},
+		{call.Args[0], "f.lingo:3:11", "f.lingo:3:12"},
+	}
+	for _, tt := range tests {
+		if got := tt.node.Pos().String(); got != tt.pos {
+			t.Errorf("%T: Pos() = %s, want %s", tt.node, got, tt.pos)
+		}
+		if got := tt.node.End().String(); got != tt.end {
+			t.Errorf("%T: End() = %s, want %s", tt.node, got, tt.end)
+		}
+	}
+	if off := sum.Right.Pos().Offset; src[off:sum.Right.End().Offset] != "10" {
+		t.Errorf("offsets of %T cover %q", sum.Right, src[off:sum.Right.End().Offset])
+	}
+}
+
+// TestAllPositions checks that every node of a program using most of the
+// syntax has a position, and lies within its parent.
+func TestAllPositions(t *testing.T) {
+	src := `package demo
+
+import "strings"
+
+type Shape interface {
+	Area() float64
+}
+
+type Point struct {
+	x: int
+	y: ?int
+}
+
+const (
+	A = iota
+	B
+)
+
+func (p: *Point) Sum(xs: ...int) int {
+	total := p.x
+	for i, x := range xs {
+		total += x * i
+	}
+	switch {
+	case total > 10:
+		fallthrough
+	default:
+		total--
+	}
+	f := (n: int) -> n * 2
+	m := map[string]int{"a": 1}
+	s := []int{1, 2, 3}[1:2]
+	var ch: chan int = make(chan int, 1)
+	select {
+	case ch <- 1:
+	default:
+	}
+	v, ok := m["a"]
+	if ok {
+		return f(v) + len(s) + (p.y ?: 0)
+	}
+	return strings.Count("a", "")
+}
+`
+	program := parse(t, src)
+	var walk func(v reflect.Value, parent ASTNode)
+	walk = func(v reflect.Value, parent ASTNode) {
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Interface:
+			if v.IsNil() {
+				return
+			}
+			if node, ok := v.Interface().(ASTNode); ok && v.Kind() == reflect.Ptr {
+				if !node.Pos().IsValid() || !node.End().IsValid() {
+					t.Errorf("%T has no position", node)
+				} else if parent != nil && (node.Pos().Offset < parent.Pos().Offset || node.End().Offset > parent.End().Offset) {
+					t.Errorf("%T at %s-%s lies outside %T at %s-%s",
+						node, node.Pos(), node.End(), parent, parent.Pos(), parent.End())
+				}
+				parent = node
+			}
+			walk(v.Elem(), parent)
+		case reflect.Slice:
+			for i := 0; i < v.Len(); i++ {
+				walk(v.Index(i), parent)
+			}
+		case reflect.Struct:
+			for i := 0; i < v.NumField(); i++ {
+				if v.Type().Field(i).IsExported() {
+					walk(v.Field(i), parent)
+				}
+			}
+		}
+	}
+	walk(reflect.ValueOf(program), nil)
+}
+
+func TestTypeExprs(t *testing.T) {
+	tests := []struct {
+		src, node, want string
+	}{
+		{`int`, "*parser.IdentType", "int"},
+		{`strings.Builder`, "*parser.QualifiedType", "strings.Builder"},
+		{`*[]T`, "*parser.PointerType", "*[]T"},
+		{`[][]int`, "*parser.SliceType", "[][]int"},
+		{`[4]byte`, "*parser.ArrayType", "[4]byte"},
+		{`[N * 2]int`, "*parser.ArrayType", "[?]int"},
+		{`map[string][]int`, "*parser.MapType", "map[string][]int"},
+		{`chan int`, "*parser.ChanType", "chan int"},
+		{`chan<- int`, "*parser.ChanType", "chan<- int"},
+		{`<-chan int`, "*parser.ChanType", "<-chan int"},
+		{`chan (<-chan int)`, "*parser.ChanType", "chan (<-chan int)"},
+		{`chan <-chan int`, "*parser.ChanType", "chan<- chan int"},
+		{`func(int) error`, "*parser.FuncType", "func(int) error"},
+		{`func(a: int, b: ...string) (int, error)`, "*parser.FuncType", "func(int, ...string) (int, error)"},
+		{`struct { x: int }`, "*parser.StructType", "struct{x int}"},
+		{`interface{}`, "*parser.InterfaceType", "interface{}"},
+		{`?*Node`, "*parser.NullableType", "?*Node"},
+		{`List[int]`, "*parser.GenericType", "List[int]"},
+		{`Pair[string, []int]`, "*parser.GenericType", "Pair[string, []int]"},
+	}
+	for _, tt := range tests {
+		fn := parse(t, "func f(x: "+tt.src+") {}").Items[0].(*FuncDecl)
+		typ := fn.Params[0].Type
+		if node := fmt.Sprintf("%T", typ); node != tt.node {
+			t.Errorf("%s: got %s, want %s", tt.src, node, tt.node)
+		}
+		if got := typ.String(); got != tt.want {
+			t.Errorf("%s: String() = %q, want %q", tt.src, got, tt.want)
+		}
+	}
+
+	runErrorTests(t, []parseTest{
+		{"var x: map[string", "1:18: expected ], got newline"},
+		{"var x: [4", "1:10: expected ], got newline"},
+		{"var x: func(int", "1:16: expected ), got newline"},
+	})
+}
+
+func TestStructDecls(t *testing.T) {
+	runParseTests(t, parseDecl, []parseTest{
+		{"type User struct {\n\tid: int\n\tname: string `json:\"name\"`\n\temail: ?string\n\t*Base\n\tio.Reader\n}",
+			`StructDecl{Name: "User", Fields: [StructField{Name: "id", Type: int}, ` +
+				`StructField{Name: "name", Type: string, Tag: "json:\"name\""}, ` +
+				`StructField{Name: "email", Type: string, IsNullable: true}, ` +
+				`StructField{Type: *Base}, StructField{Type: io.Reader}]}`},
+		{`type Empty struct {}`, `StructDecl{Name: "Empty"}`},
+		{`type P struct { x: int; y: int }`, `StructDecl{Name: "P", Fields: [StructField{Name: "x", Type: int}, StructField{Name: "y", Type: int}]}`},
+		{`type P struct { tag: string "plain" }`, `StructDecl{Name: "P", Fields: [StructField{Name: "tag", Type: string, Tag: "plain"}]}`},
+	})
+	runErrorTests(t, []parseTest{
+		{"type P struct { x: int y: int }", "1:24: expected ; or newline after struct field, got identifier y"},
+		{"type P struct { x: }", "1:20: expected type, got }"},
+	})
+}
+
+func TestInterfaceDecls(t *testing.T) {
+	runParseTests(t, parseDecl, []parseTest{
+		{"type Reader interface {\n\tRead(p: []byte) (int, error)\n\tio.Closer\n}",
+			`InterfaceDecl{Name: "Reader", Methods: [InterfaceMethod{Name: "Read", Type: func([]byte) (int, error)}], Embeds: [io.Closer]}`},
+		{`type Stringer interface { String() string; Len() int }`,
+			`InterfaceDecl{Name: "Stringer", Methods: [InterfaceMethod{Name: "String", Type: func() string}, InterfaceMethod{Name: "Len", Type: func() int}]}`},
+		{`type Empty interface {}`, `InterfaceDecl{Name: "Empty"}`},
+		{`type Number interface { ~int | ~float64 }`, `InterfaceDecl{Name: "Number", Embeds: [~int | ~float64]}`},
+	})
+	runErrorTests(t, []parseTest{
+		{"type R interface { Read( }", "1:26: expected type, got }"},
+		{"type R interface { 42 }", "1:20: expected type, got INT"},
+	})
+}
+
+func TestForLoops(t *testing.T) {
+	runParseTests(t, parseBody, []parseTest{
+		{`for i := 0; i < 10; i++ { continue }`,
+			`ForStmt{Init: ShortAssignStmt{Lhs: [i], Rhs: [LiteralInt{Value: "0", Base: 10, Const: 0}]}, ` +
+				`Condition: BinaryOp{Left: i, Op: "<", Right: LiteralInt{Value: "10", Base: 10, Const: 10}}, ` +
+				`Post: IncDecStmt{X: i, Op: "++"}, Body: [BranchStmt{Tok: "continue"}]}`},
+		{`for x < 10 { break }`, `ForStmt{Condition: BinaryOp{Left: x, Op: "<", Right: LiteralInt{Value: "10", Base: 10, Const: 10}}, Body: [BranchStmt{Tok: "break"}]}`},
+		{`for { }`, `ForStmt{}`},
+		{`for ;; { }`, `ForStmt{}`},
+		{`for k, v := range m { }`, `ForRangeStmt{Key: "k", Value: "v", Define: true, Expr: m}`},
+		{`for k = range m { }`, `ForRangeStmt{Key: "k", Expr: m}`},
+		{`for i := range 10 { }`, `ForRangeStmt{Key: "i", Define: true, Expr: LiteralInt{Value: "10", Base: 10, Const: 10}}`},
+		{`for range ch { }`, `ForRangeStmt{Expr: ch}`},
+	})
+	runErrorTests(t, []parseTest{
+		{"func f() { for i := 0; i < 10 { } }", "1:31: expected ;, got {"},
+	})
+}
+
+func TestSwitches(t *testing.T) {
+	runParseTests(t, parseBody, []parseTest{
+		{`switch x { case 1, 2: f(); fallthrough; case 3: default: g() }`,
+			`SwitchStmt{Tag: x, Body: [CaseClause{List: [LiteralInt{Value: "1", Base: 10, Const: 1}, LiteralInt{Value: "2", Base: 10, Const: 2}], ` +
+				`Body: [CallExpr{Fun: f}, BranchStmt{Tok: "fallthrough"}]}, CaseClause{List: [LiteralInt{Value: "3", Base: 10, Const: 3}]}, ` +
+				`CaseClause{Body: [CallExpr{Fun: g}]}]}`},
+		{`switch { case x > 1: }`, `SwitchStmt{Body: [CaseClause{List: [BinaryOp{Left: x, Op: ">", Right: LiteralInt{Value: "1", Base: 10, Const: 1}}]}]}`},
+		{`switch y := f(); y { }`, `SwitchStmt{Init: ShortAssignStmt{Lhs: [y], Rhs: [CallExpr{Fun: f}]}, Tag: y}`},
+		{`switch v := x.(type) { case int, string: case null: default: }`,
+			`TypeSwitchStmt{Binding: "v", X: x, Body: [CaseClause{List: [int, string]}, CaseClause{List: [LiteralNull{}]}, CaseClause{}]}`},
+		{`switch x.(type) { }`, `TypeSwitchStmt{X: x}`},
+	})
+	runErrorTests(t, []parseTest{
+		{"func f() { switch x { case 1 f() } }", "1:30: expected :, got identifier f"},
+		{"func f() { switch x { foo: } }", "1:23: expected case or default, got identifier foo"},
+	})
+}
+
+func TestMultiAssign(t *testing.T) {
+	runParseTests(t, parseBody, []parseTest{
+		{`a, b := f()`, `ShortAssignStmt{Lhs: [a, b], Rhs: [CallExpr{Fun: f}]}`},
+		{`v, ok := m[k]`, `ShortAssignStmt{Lhs: [v, ok], Rhs: [IndexExpr{Expr: m, Index: k}]}`},
+		{`v, ok := x.(int)`, `ShortAssignStmt{Lhs: [v, ok], Rhs: [TypeAssertExpr{Expr: x, Type: int}]}`},
+		{`v, ok := <-ch`, `ShortAssignStmt{Lhs: [v, ok], Rhs: [ChanOp{Op: "<-", Expr: ch}]}`},
+		{`x, err = g()`, `AssignStmt{Lhs: [x, err], Op: "=", Rhs: [CallExpr{Fun: g}]}`},
+		{`a, b = b, a`, `AssignStmt{Lhs: [a, b], Op: "=", Rhs: [b, a]}`},
+		{`a[i], p.x, _ = 1, 2, 3`,
+			`AssignStmt{Lhs: [IndexExpr{Expr: a, Index: i}, SelectorExpr{X: p, Sel: x}, _], Op: "=", ` +
+				`Rhs: [LiteralInt{Value: "1", Base: 10, Const: 1}, LiteralInt{Value: "2", Base: 10, Const: 2}, LiteralInt{Value: "3", Base: 10, Const: 3}]}`},
+	})
+	runErrorTests(t, []parseTest{
+		{"func f() { a, 1 := f() }", "1:15: expected identifier on left side of :="},
+		{"func f() { a, b := }", "1:20: expected expression, got }"},
+	})
+}
+
+func TestFuncLits(t *testing.T) {
+	double := `BinaryOp{Left: x, Op: "*", Right: LiteralInt{Value: "2", Base: 10, Const: 2}}`
+	runParseTests(t, parseExpr, []parseTest{
+		{`func(x: int) int { return x * 2 }`, `FuncLit{Type: func(int) int, Body: [ReturnStmt{Values: [` + double + `]}]}`},
+		{`(x: int) -> x * 2`, `FuncLit{Type: func(int), Body: [ReturnStmt{Values: [` + double + `]}], Arrow: true}`},
+		{`(a: int, b: int) int -> a + b`, `FuncLit{Type: func(int, int) int, Body: [ReturnStmt{Values: [BinaryOp{Left: a, Op: "+", Right: b}]}], Arrow: true}`},
+		{`() -> 1`, `FuncLit{Type: func(), Body: [ReturnStmt{Values: [LiteralInt{Value: "1", Base: 10, Const: 1}]}], Arrow: true}`},
+		{`(x + 1) * 2`, `BinaryOp{Left: BinaryOp{Left: x, Op: "+", Right: LiteralInt{Value: "1", Base: 10, Const: 1}}, Op: "*", Right: LiteralInt{Value: "2", Base: 10, Const: 2}}`},
+	})
+	runParseTests(t, parseBody, []parseTest{
+		{`defer func() { recover() }()`, `DeferStmt{Call: CallExpr{Fun: FuncLit{Type: func(), Body: [RecoverExpr{}]}}}`},
+		{`go func(n: int) { ch <- n }(1)`,
+			`GoStmt{Call: CallExpr{Fun: FuncLit{Type: func(int), Body: [ChanOp{Op: "<-", Expr: ch, Value: n}]}, Args: [LiteralInt{Value: "1", Base: 10, Const: 1}]}}`},
+	})
+	runErrorTests(t, []parseTest{
+		{"func f() { g := (x: int) -> }", "1:29: expected expression, got }"},
+	})
+}
+
+func TestCompositeLiterals(t *testing.T) {
+	one, two := `LiteralInt{Value: "1", Base: 10, Const: 1}`, `LiteralInt{Value: "2", Base: 10, Const: 2}`
+	runParseTests(t, parseExpr, []parseTest{
+		{`User{name: "x", email: null}`,
+			`StructLiteral{Type: User, Fields: [KeyValueExpr{Key: name, Value: LiteralString{Value: "x"}}, KeyValueExpr{Key: email, Value: LiteralNull{}}]}`},
+		{`Point{1, 2}`, `StructLiteral{Type: Point, Fields: [KeyValueExpr{Value: ` + one + `}, KeyValueExpr{Value: ` + two + `}]}`},
+		{`[]int{1, 2}`, `ArrayLiteral{Type: int, Elements: [` + one + `, ` + two + `]}`},
+		{`[3]string{"a"}`, `ArrayLiteral{Type: string, Len: LiteralInt{Value: "3", Base: 10, Const: 3}, Elements: [LiteralString{Value: "a"}]}`},
+		{`[1, 2]`, `ArrayLiteral{Elements: [` + one + `, ` + two + `]}`},
+		{`map[string]int{"b": 2, "a": 1}`,
+			`MapLiteral{KeyType: string, ValueType: int, Entries: [KeyValueExpr{Key: LiteralString{Value: "b"}, Value: ` + two + `}, ` +
+				`KeyValueExpr{Key: LiteralString{Value: "a"}, Value: ` + one + `}]}`},
+		{`[]Point{{1, 2}, {x: 1}}`,
+			`ArrayLiteral{Type: Point, Elements: [StructLiteral{Type: Point, Fields: [KeyValueExpr{Value: ` + one + `}, KeyValueExpr{Value: ` + two + `}]}, ` +
+				`StructLiteral{Type: Point, Fields: [KeyValueExpr{Key: x, Value: ` + one + `}]}]}`},
+		{`map[string][]int{"a": {1}}`,
+			`MapLiteral{KeyType: string, ValueType: []int, Entries: [KeyValueExpr{Key: LiteralString{Value: "a"}, Value: ArrayLiteral{Type: int, Elements: [` + one + `]}}]}`},
+	})
+	runParseTests(t, parseBody, []parseTest{
+		{`*p = v`, `AssignStmt{Lhs: [UnaryOp{Op: "*", Right: p}], Op: "=", Rhs: [v]}`},
+		{`*p++`, `IncDecStmt{X: UnaryOp{Op: "*", Right: p}, Op: "++"}`},
+		{`*p.x, *q = 1, 2`,
+			`AssignStmt{Lhs: [UnaryOp{Op: "*", Right: SelectorExpr{X: p, Sel: x}}, UnaryOp{Op: "*", Right: q}], Op: "=", Rhs: [` + one + `, ` + two + `]}`},
+	})
+	runErrorTests(t, []parseTest{
+		{"func f() { x := User{name: } }", "1:28: expected expression, got }"},
+	})
+}
+
+func TestGroupedDecls(t *testing.T) {
+	runParseTests(t, parseDecl, []parseTest{
+		{"import (\n\t\"os\"\n\tstr \"strings\"\n\t. \"math\"\n\t_ \"embed\"\n)",
+			`GenDecl{Tok: "import", Specs: [ImportDecl{Path: "os"}, ImportDecl{Path: "strings", Alias: "str"}, ` +
+				`ImportDecl{Path: "math", Alias: "."}, ImportDecl{Path: "embed", Alias: "_"}]}`},
+		{"const (\n\tA = iota\n\tB\n\tC = 1 << iota\n\tD\n)",
+			`GenDecl{Tok: "const", Specs: [ConstDecl{Name: "A", Value: iota}, ConstDecl{Name: "B", Iota: 1}, ` +
+				`ConstDecl{Name: "C", Value: BinaryOp{Left: LiteralInt{Value: "1", Base: 10, Const: 1}, Op: "<<", Right: iota}, Iota: 2}, ` +
+				`ConstDecl{Name: "D", Iota: 3}]}`},
+		{"var (\n\tx: int = 1\n\ty = \"a\"\n)",
+			`GenDecl{Tok: "var", Specs: [VarDecl{Name: "x", Type: int, Value: LiteralInt{Value: "1", Base: 10, Const: 1}}, VarDecl{Name: "y", Value: LiteralString{Value: "a"}}]}`},
+		{"type (\n\tID int\n\tPair struct { a: int }\n)",
+			`GenDecl{Tok: "type", Specs: [TypeDecl{Name: "ID", Type: int}, StructDecl{Name: "Pair", Fields: [StructField{Name: "a", Type: int}]}]}`},
+		{`const ()`, `GenDecl{Tok: "const"}`},
+		{"import `x/y`", `ImportDecl{Path: "x/y"}`},
+		{`import t "a\tb"`, `ImportDecl{Path: "a\tb", Alias: "t"}`},
+	})
+	runErrorTests(t, []parseTest{
+		{"const (\n\tA =\n)", "3:1: expected expression, got )"},
+		{"import (\n\tos\n)", "2:4: expected import path, got newline"},
+	})
+}
+
+func TestGenerics(t *testing.T) {
+	runParseTests(t, parseDecl, []parseTest{
+		{`func Map[T, U any](xs: []T, f: func(T) U) []U { return null }`,
+			`FuncDecl{Name: "Map", TypeParams: [TypeParam{Name: "T", Constraint: any}, TypeParam{Name: "U", Constraint: any}], ` +
+				`Params: [Param{Name: "xs", Type: []T}, Param{Name: "f", Type: func(T) U}], Returns: [[]U], Body: [ReturnStmt{Values: [LiteralNull{}]}]}`},
+		{`func Sum[T int | float64](xs: ...T) T { return 0 }`,
+			`FuncDecl{Name: "Sum", TypeParams: [TypeParam{Name: "T", Constraint: int | float64}], Params: [Param{Name: "xs", Type: T, Variadic: true}], ` +
+				`Returns: [T], Body: [ReturnStmt{Values: [LiteralInt{Value: "0", Base: 10, Const: 0}]}]}`},
+		{`type List[T any] struct { head: T }`,
+			`StructDecl{Name: "List", TypeParams: [TypeParam{Name: "T", Constraint: any}], Fields: [StructField{Name: "head", Type: T}]}`},
+		{`type Pair[K, V any] map[K]V`,
+			`TypeDecl{Name: "Pair", TypeParams: [TypeParam{Name: "K", Constraint: any}, TypeParam{Name: "V", Constraint: any}], Type: map[K]V}`},
+		{`type Num[T ~int | ~float64] []T`, `TypeDecl{Name: "Num", TypeParams: [TypeParam{Name: "T", Constraint: ~int | ~float64}], Type: []T}`},
+		{`type S[T []int] T`, `TypeDecl{Name: "S", TypeParams: [TypeParam{Name: "T", Constraint: []int}], Type: T}`},
+		{`type F[T interface{ M() }] T`, `TypeDecl{Name: "F", TypeParams: [TypeParam{Name: "T", Constraint: interface{M()}}], Type: T}`},
+		// Array lengths, not type parameters.
+		{`type A [N]int`, `TypeDecl{Name: "A", Type: [N]int}`},
+		{`type A [N * 2]int`, `TypeDecl{Name: "A", Type: [?]int}`},
+		{`type A [N + M]int`, `TypeDecl{Name: "A", Type: [?]int}`},
+	})
+	runParseTests(t, parseExpr, []parseTest{
+		{`Map[int, string](xs, f)`, `CallExpr{Fun: InstanceExpr{Expr: Map, TypeArgs: [int, string]}, Args: [xs, f]}`},
+		{`xs[i]`, `IndexExpr{Expr: xs, Index: i}`},
+		{`Box[int]{v: 1}`, `StructLiteral{Type: Box[int], Fields: [KeyValueExpr{Key: v, Value: LiteralInt{Value: "1", Base: 10, Const: 1}}]}`},
+	})
+	runErrorTests(t, []parseTest{
+		{"func F[T](x: T) {}", "1:9: expected type, got ]"},
+	})
+
+	decl := parse(t, "type A [N * 2]int").Items[0].(*TypeDecl)
+	if got, want := dump(decl.Type.(*ArrayType).Len), `BinaryOp{Left: N, Op: "*", Right: LiteralInt{Value: "2", Base: 10, Const: 2}}`; got != want {
+		t.Errorf("array length = %s, want %s", got, want)
+	}
+}
+
+func TestChannels(t *testing.T) {
+	one := `LiteralInt{Value: "1", Base: 10, Const: 1}`
+	runParseTests(t, parseBody, []parseTest{
+		{"select {\ncase v := <-ch:\n\tf(v)\ncase v, ok := <-ch:\n\tf(v, ok)\ncase ch <- 1:\ncase <-done:\n\treturn\ndefault:\n}",
+			`SelectStmt{Cases: [SelectCase{Comm: ShortAssignStmt{Lhs: [v], Rhs: [ChanOp{Op: "<-", Expr: ch}]}, Body: [CallExpr{Fun: f, Args: [v]}]}, ` +
+				`SelectCase{Comm: ShortAssignStmt{Lhs: [v, ok], Rhs: [ChanOp{Op: "<-", Expr: ch}]}, Body: [CallExpr{Fun: f, Args: [v, ok]}]}, ` +
+				`SelectCase{Comm: ChanOp{Op: "<-", Expr: ch, Value: ` + one + `}}, ` +
+				`SelectCase{Comm: ChanOp{Op: "<-", Expr: done}, Body: [ReturnStmt{}]}, SelectCase{}]}`},
+		{`ch <- x`, `ChanOp{Op: "<-", Expr: ch, Value: x}`},
+		{`v, ok := <-ch`, `ShortAssignStmt{Lhs: [v, ok], Rhs: [ChanOp{Op: "<-", Expr: ch}]}`},
+	})
+	runParseTests(t, parseExpr, []parseTest{
+		{`make(chan int, 1)`, `CallExpr{Fun: make, Args: [chan int, ` + one + `]}`},
+		{`append(xs, ys...)`, `CallExpr{Fun: append, Args: [xs, ys], Ellipsis: true}`},
+	})
+	runErrorTests(t, []parseTest{
+		{"func f() { select { case x: } }", "1:26: select case must be receive, send or assign recv"},
+	})
+}
+
+func TestLabels(t *testing.T) {
+	runParseTests(t, parseBody, []parseTest{
+		{"outer:\n\tfor {\n\t\tfor {\n\t\t\tcontinue outer\n\t\t}\n\t}",
+			`LabeledStmt{Label: "outer", Stmt: ForStmt{Body: [ForStmt{Body: [BranchStmt{Tok: "continue", Label: "outer"}]}]}}`},
+		{`break`, `BranchStmt{Tok: "break"}`},
+		{`break L`, `BranchStmt{Tok: "break", Label: "L"}`},
+		{"goto end\nend:", `BranchStmt{Tok: "goto", Label: "end"}; LabeledStmt{Label: "end"}`},
+		{`switch x { case 1: fallthrough; default: }`,
+			`SwitchStmt{Tag: x, Body: [CaseClause{List: [LiteralInt{Value: "1", Base: 10, Const: 1}], Body: [BranchStmt{Tok: "fallthrough"}]}, CaseClause{}]}`},
+	})
+	runErrorTests(t, []parseTest{
+		{"func f() { goto }", "1:17: expected label after goto, got }"},
+		{"func f() { break 1 }", "1:18: expected ; or newline, got INT"},
+	})
+}
+
+func TestSelectors(t *testing.T) {
+	zero := `LiteralInt{Value: "0", Base: 10, Const: 0}`
+	runParseTests(t, parseExpr, []parseTest{
+		{`a.b().c[0].d()`,
+			`CallExpr{Fun: SelectorExpr{X: IndexExpr{Expr: SelectorExpr{X: CallExpr{Fun: SelectorExpr{X: a, Sel: b}}, Sel: c}, Index: ` + zero + `}, Sel: d}}`},
+		{`fmt.Println(x)`, `CallExpr{Fun: SelectorExpr{X: fmt, Sel: Println}, Args: [x]}`},
+		{`f()()`, `CallExpr{Fun: CallExpr{Fun: f}}`},
+		{`p.q.r`, `SelectorExpr{X: SelectorExpr{X: p, Sel: q}, Sel: r}`},
+		{`xs[0].name`, `SelectorExpr{X: IndexExpr{Expr: xs, Index: ` + zero + `}, Sel: name}`},
+	})
+}
+
+func TestSliceExprs(t *testing.T) {
+	runParseTests(t, parseExpr, []parseTest{
+		{`s[1:]`, `SliceExpr{Expr: s, Low: LiteralInt{Value: "1", Base: 10, Const: 1}}`},
+		{`s[:n]`, `SliceExpr{Expr: s, High: n}`},
+		{`s[:]`, `SliceExpr{Expr: s}`},
+		{`s[a:b:c]`, `SliceExpr{Expr: s, Low: a, High: b, Max: c, Slice3: true}`},
+		{`s[:b:c]`, `SliceExpr{Expr: s, High: b, Max: c, Slice3: true}`},
+		{`f()[i:][0]`, `IndexExpr{Expr: SliceExpr{Expr: CallExpr{Fun: f}, Low: i}, Index: LiteralInt{Value: "0", Base: 10, Const: 0}}`},
+	})
+	runErrorTests(t, []parseTest{
+		{"func f() { x := s[a::c] }", "1:23: middle index required in 3-index slice"},
+		{"func f() { x := s[a:b:] }", "1:23: final index required in 3-index slice"},
+		{"func f() { x := s[::c] }", "1:22: middle index required in 3-index slice"},
+	})
+}
@@ -31,7 +31,11 @@ func SafeCall(obj interface{}, method string, args ... interface{}) interface{}
 		return nil
 	}
 
-	return m. Call(nil). Interface()
+	results := m.Call(nil)
+	if len(results) == 0 {
+		return nil
+	}
+	return results[0].Interface()
 }
 
 // SafeAccess safely accesses a field, returning nil if it doesn't exist
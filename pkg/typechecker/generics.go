@@ -0,0 +1,535 @@
+package typechecker
+
+import (
+	"strings"
+
+	"github.com/MistyPigeon/lingo/pkg/parser"
+)
+
+// declareTypeParams brings the type parameters of a generic function or
+// method into scope for its body.
+func (tc *TypeChecker) declareTypeParams(params []*parser.TypeParam) error {
+	for _, param := range params {
+		if _, ok := tc.typeParams[param.Name]; ok {
+			return &Error{Pos: param.Pos(), Msg: param.Name + " redeclared"}
+		}
+		tc.typeParams[param.Name] = param.Constraint
+	}
+	return nil
+}
+
+// receiverTypeParams returns the type parameters a method declares through
+// its receiver, as T in func (b: Box[T]) Get() T, with the constraints of
+// the receiver type's own parameters.
+func (tc *TypeChecker) receiverTypeParams(recv *parser.Param) []*parser.TypeParam {
+	t := recv.Type
+	if ptr, ok := t.(*parser.PointerType); ok {
+		t = ptr.Elem
+	}
+	generic, ok := t.(*parser.GenericType)
+	if !ok {
+		return nil
+	}
+	decl := tc.structs[typeName(generic.Base)]
+	var params []*parser.TypeParam
+	for i, arg := range generic.Args {
+		param := &parser.TypeParam{Span: parser.Span{From: arg.Pos(), To: arg.End()}, Name: typeName(arg)}
+		if decl != nil && i < len(decl.TypeParams) {
+			param.Constraint = decl.TypeParams[i].Constraint
+		}
+		params = append(params, param)
+	}
+	return params
+}
+
+// genericFunc returns the generic function that x instantiates, as in
+// Map[int, string], with its explicit type arguments. A plain reference
+// to a generic function has none.
+func (tc *TypeChecker) genericFunc(x parser.ASTNode) (fn *parser.FuncDecl, explicit []string, ok bool) {
+	switch e := x.(type) {
+	case *parser.InstanceExpr:
+		x = e.Expr
+		for _, arg := range e.TypeArgs {
+			explicit = append(explicit, typeName(arg))
+		}
+	case *parser.IndexExpr:
+		x = e.Expr
+		explicit = []string{typeArgName(e.Index)}
+	}
+	ident, ok := x.(*parser.Identifier)
+	if !ok || tc.lookupVar(ident.Name) != "" {
+		return nil, nil, false
+	}
+	fn, ok = tc.funcs[ident.Name]
+	if !ok || len(fn.TypeParams) == 0 {
+		return nil, nil, false
+	}
+	return fn, explicit, true
+}
+
+// typeArgName returns the type named by an index expression that is used
+// as a type argument.
+func typeArgName(x parser.ASTNode) string {
+	switch e := x.(type) {
+	case *parser.Identifier:
+		return e.Name
+	case *parser.SelectorExpr:
+		return typeArgName(e.X) + "." + e.Sel.Name
+	case *parser.UnaryOp:
+		if e.Op == "*" {
+			return "*" + typeArgName(e.Right)
+		}
+	}
+	return ""
+}
+
+// checkGenericCall checks a call of the generic function fn, inferring
+// the type arguments that are not given explicitly, and returns its
+// instantiated results.
+func (tc *TypeChecker) checkGenericCall(call *parser.CallExpr, fn *parser.FuncDecl, explicit []string) ([]parser.TypeExpr, bool, error) {
+	bind, err := tc.inferTypeArgs(call, fn.Name, fn.TypeParams, explicit, fn.Params, call.Args, call.Ellipsis)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := tc.checkArgs(call, fn.Name, substParams(fn.Params, bind), call.Args, call.Ellipsis); err != nil {
+		return nil, false, err
+	}
+	return substTypes(fn.Returns, bind), true, nil
+}
+
+// inferInstanceType types a generic function used as a value. All of its
+// type arguments must be given, as there are no arguments to infer them
+// from.
+func (tc *TypeChecker) inferInstanceType(x parser.ASTNode, fn *parser.FuncDecl, explicit []string) (string, error) {
+	bind, err := tc.inferTypeArgs(x, fn.Name, fn.TypeParams, explicit, nil, nil, false)
+	if err != nil {
+		return "", err
+	}
+	sig := &parser.FuncType{Params: substParams(fn.Params, bind), Results: substTypes(fn.Returns, bind)}
+	return sig.String(), nil
+}
+
+// inferTypeArgs binds the type parameters of the generic function name to
+// the explicit type arguments, then infers the rest by unifying the
+// parameter types with the types of args. Untyped constant arguments are
+// considered last, so that they take their type from the other arguments
+// where they can.
+func (tc *TypeChecker) inferTypeArgs(call parser.ASTNode, name string, tparams []*parser.TypeParam, explicit []string, params []*parser.Param, args []parser.ASTNode, ellipsis bool) (map[string]string, error) {
+	if len(explicit) > len(tparams) {
+		return nil, errorf(call, "got %d type arguments but %s has %d type parameters", len(explicit), name, len(tparams))
+	}
+
+	bind := make(map[string]string)
+	isParam := make(map[string]bool)
+	for i, tp := range tparams {
+		isParam[tp.Name] = true
+		if i < len(explicit) {
+			bind[tp.Name] = explicit[i]
+		}
+	}
+
+	for _, untyped := range []bool{false, true} {
+		for i, arg := range args {
+			if len(params) == 0 || i >= len(params) && !params[len(params)-1].Variadic {
+				break
+			}
+			if _, isConst := constValue(arg); isConst != untyped {
+				continue
+			}
+			argType, err := tc.inferExprType(arg)
+			if err != nil {
+				return nil, err
+			}
+			if argType == "nil" {
+				continue
+			}
+			if i < len(params) && !params[i].Variadic {
+				unify(params[i].Type, argType, isParam, bind)
+				continue
+			}
+			variadic := params[len(params)-1].Type
+			if ellipsis {
+				variadic = &parser.SliceType{Elem: variadic}
+			}
+			unify(variadic, argType, isParam, bind)
+		}
+	}
+
+	for _, tp := range tparams {
+		typ, ok := bind[tp.Name]
+		if !ok {
+			return nil, errorf(call, "cannot infer %s in call to %s", tp.Name, name)
+		}
+		if !tc.satisfies(typ, tp.Constraint) {
+			return nil, errorf(call, "%s does not satisfy %s", typ, typeName(tp.Constraint))
+		}
+	}
+	return bind, nil
+}
+
+// unify matches the parameter type t against the argument type arg,
+// binding any type parameters of t that are not yet bound. Mismatches are
+// left for the argument checks to report.
+func unify(t parser.TypeExpr, arg string, isParam map[string]bool, bind map[string]string) {
+	switch t := t.(type) {
+	case *parser.IdentType:
+		if _, ok := bind[t.Name]; isParam[t.Name] && !ok {
+			bind[t.Name] = arg
+		}
+	case *parser.NullableType:
+		unify(t.Elem, arg, isParam, bind)
+	case *parser.PointerType:
+		if strings.HasPrefix(arg, "*") {
+			unify(t.Elem, arg[1:], isParam, bind)
+		}
+	case *parser.SliceType:
+		if strings.HasPrefix(arg, "[]") {
+			unify(t.Elem, arg[2:], isParam, bind)
+		}
+	case *parser.ArrayType:
+		if i := strings.Index(arg, "]"); strings.HasPrefix(arg, "[") && i > 1 {
+			unify(t.Elem, arg[i+1:], isParam, bind)
+		}
+	case *parser.MapType:
+		if !strings.HasPrefix(arg, "map[") {
+			return
+		}
+		if key, value, ok := splitMapType(arg); ok {
+			unify(t.Key, key, isParam, bind)
+			unify(t.Value, value, isParam, bind)
+		}
+	case *parser.ChanType:
+		if elem, _ := chanElem(arg); elem != "" {
+			unify(t.Elem, elem, isParam, bind)
+		}
+	case *parser.FuncType:
+		params, results, ok := funcTypeSignature(arg)
+		if !ok || len(params) != len(t.Params) || len(results) != len(t.Results) {
+			return
+		}
+		for i, p := range t.Params {
+			unify(p.Type, typeName(params[i].Type), isParam, bind)
+		}
+		for i, r := range t.Results {
+			unify(r, typeName(results[i]), isParam, bind)
+		}
+	case *parser.GenericType:
+		base, args := typeArgs(arg)
+		if base != typeName(t.Base) || len(args) != len(t.Args) {
+			return
+		}
+		for i, a := range t.Args {
+			unify(a, args[i], isParam, bind)
+		}
+	}
+}
+
+// substType returns t with each type parameter replaced by its binding.
+func substType(t parser.TypeExpr, bind map[string]string) parser.TypeExpr {
+	if len(bind) == 0 {
+		return t
+	}
+	switch t := t.(type) {
+	case *parser.IdentType:
+		if b, ok := bind[t.Name]; ok {
+			return &parser.IdentType{Span: t.Span, Name: b}
+		}
+	case *parser.NullableType:
+		return &parser.NullableType{Span: t.Span, Elem: substType(t.Elem, bind)}
+	case *parser.PointerType:
+		return &parser.PointerType{Span: t.Span, Elem: substType(t.Elem, bind)}
+	case *parser.SliceType:
+		return &parser.SliceType{Span: t.Span, Elem: substType(t.Elem, bind)}
+	case *parser.ArrayType:
+		return &parser.ArrayType{Span: t.Span, Len: t.Len, Elem: substType(t.Elem, bind)}
+	case *parser.MapType:
+		return &parser.MapType{Span: t.Span, Key: substType(t.Key, bind), Value: substType(t.Value, bind)}
+	case *parser.ChanType:
+		return &parser.ChanType{Span: t.Span, Dir: t.Dir, Elem: substType(t.Elem, bind)}
+	case *parser.FuncType:
+		return &parser.FuncType{Span: t.Span, Params: substParams(t.Params, bind), Results: substTypes(t.Results, bind)}
+	case *parser.GenericType:
+		return &parser.GenericType{Span: t.Span, Base: t.Base, Args: substTypes(t.Args, bind)}
+	}
+	return t
+}
+
+func substTypes(types []parser.TypeExpr, bind map[string]string) []parser.TypeExpr {
+	out := make([]parser.TypeExpr, len(types))
+	for i, t := range types {
+		out[i] = substType(t, bind)
+	}
+	return out
+}
+
+func substParams(params []*parser.Param, bind map[string]string) []*parser.Param {
+	out := make([]*parser.Param, len(params))
+	for i, p := range params {
+		out[i] = &parser.Param{Span: p.Span, Name: p.Name, Type: substType(p.Type, bind), Variadic: p.Variadic}
+	}
+	return out
+}
+
+// typeArgs splits an instantiated type name such as "Box[int]" into its
+// generic type and type arguments. Other types have no arguments.
+func typeArgs(typ string) (base string, args []string) {
+	typ = strings.TrimPrefix(typ, "*")
+	i := strings.Index(typ, "[")
+	if i <= 0 || !strings.HasSuffix(typ, "]") || typ[:i] == "map" || strings.ContainsAny(typ[:i], " ()*[]") {
+		return typ, nil
+	}
+	return typ[:i], splitTypeList(typ[i+1 : len(typ)-1])
+}
+
+// instanceBindings binds the type parameters of the generic struct that
+// typ instantiates to its type arguments.
+func (tc *TypeChecker) instanceBindings(typ string) map[string]string {
+	base, args := typeArgs(typ)
+	decl, ok := tc.structs[base]
+	if !ok || len(args) != len(decl.TypeParams) {
+		return nil
+	}
+	bind := make(map[string]string)
+	for i, tp := range decl.TypeParams {
+		bind[tp.Name] = args[i]
+	}
+	return bind
+}
+
+// methodBindings binds the type parameters named by the receiver of the
+// method fn to the type arguments of recvType.
+func methodBindings(fn *parser.FuncDecl, recvType string) map[string]string {
+	t := fn.Receiver.Type
+	if ptr, ok := t.(*parser.PointerType); ok {
+		t = ptr.Elem
+	}
+	generic, ok := t.(*parser.GenericType)
+	_, args := typeArgs(recvType)
+	if !ok || len(args) != len(generic.Args) {
+		return nil
+	}
+	bind := make(map[string]string)
+	for i, arg := range generic.Args {
+		bind[typeName(arg)] = args[i]
+	}
+	return bind
+}
+
+// checkInstance checks the instantiations of generic types within t: each
+// generic type needs one type argument per parameter, and each argument
+// must satisfy its constraint. Constraint interfaces may not be used as
+// ordinary types.
+func (tc *TypeChecker) checkInstance(t parser.TypeExpr) error {
+	switch t := t.(type) {
+	case *parser.IdentType:
+		if decl, ok := tc.structs[t.Name]; ok && len(decl.TypeParams) > 0 {
+			return errorf(t, "cannot use generic type %s without instantiation", t.Name)
+		}
+		if tc.isConstraint(t.Name) {
+			return errorf(t, "cannot use type %s outside a type constraint: interface contains type constraints", t.Name)
+		}
+	case *parser.GenericType:
+		decl, ok := tc.structs[typeName(t.Base)]
+		if !ok {
+			return nil
+		}
+		if len(t.Args) != len(decl.TypeParams) {
+			return errorf(t, "got %d type arguments but %s has %d type parameters", len(t.Args), decl.Name, len(decl.TypeParams))
+		}
+		for i, arg := range t.Args {
+			if err := tc.checkInstance(arg); err != nil {
+				return err
+			}
+			if !tc.satisfies(typeName(arg), decl.TypeParams[i].Constraint) {
+				return errorf(arg, "%s does not satisfy %s", typeName(arg), typeName(decl.TypeParams[i].Constraint))
+			}
+		}
+	case *parser.NullableType:
+		return tc.checkInstance(t.Elem)
+	case *parser.PointerType:
+		return tc.checkInstance(t.Elem)
+	case *parser.SliceType:
+		return tc.checkInstance(t.Elem)
+	case *parser.ArrayType:
+		return tc.checkInstance(t.Elem)
+	case *parser.ChanType:
+		return tc.checkInstance(t.Elem)
+	case *parser.MapType:
+		if err := tc.checkInstance(t.Key); err != nil {
+			return err
+		}
+		return tc.checkInstance(t.Value)
+	}
+	return nil
+}
+
+// isConstraint reports whether the named interface has a type set
+// restricted by type terms, and so may only be used as a constraint.
+func (tc *TypeChecker) isConstraint(name string) bool {
+	decl, ok := tc.interfaces[name]
+	if !ok {
+		return false
+	}
+	for _, embed := range decl.Embeds {
+		switch embed.(type) {
+		case *parser.UnionType, *parser.TildeType:
+			return true
+		}
+		if tc.isConstraint(typeName(embed)) {
+			return true
+		}
+	}
+	return false
+}
+
+// satisfies reports whether typ satisfies constraint. A type parameter
+// satisfies a constraint when every type in its own type set does.
+func (tc *TypeChecker) satisfies(typ string, constraint parser.TypeExpr) bool {
+	if constraint == nil {
+		return true
+	}
+	if own, ok := tc.typeParams[typ]; ok {
+		if typeName(own) == typeName(constraint) || isAny(constraint) {
+			return true
+		}
+		terms := tc.typeTerms(own)
+		if len(terms) == 0 {
+			return false
+		}
+		for _, term := range terms {
+			if !tc.satisfies(typeName(term), constraint) {
+				return false
+			}
+		}
+		return true
+	}
+
+	switch c := constraint.(type) {
+	case *parser.IdentType:
+		switch {
+		case isAny(c):
+			return true
+		case c.Name == "comparable":
+			return isComparable(typ)
+		case tc.interfaces[c.Name] == nil:
+			if tc.isInterface(c.Name) {
+				name, _ := tc.missingMethod(typ, c.Name)
+				return name == ""
+			}
+			// A type term.
+			return typ == c.Name
+		}
+		decl := tc.interfaces[c.Name]
+		for _, embed := range decl.Embeds {
+			if !tc.satisfies(typ, embed) {
+				return false
+			}
+		}
+		if len(decl.Methods) > 0 {
+			name, _ := tc.missingMethod(typ, c.Name)
+			return name == ""
+		}
+		return true
+	case *parser.InterfaceType:
+		for _, embed := range c.Embeds {
+			if !tc.satisfies(typ, embed) {
+				return false
+			}
+		}
+		return true
+	case *parser.UnionType:
+		for _, term := range c.Terms {
+			if tc.satisfies(typ, term) {
+				return true
+			}
+		}
+		return false
+	case *parser.TildeType:
+		elem := typeName(c.Elem)
+		return typ == elem || tc.lookupVar(typ) == elem
+	}
+	return typ == typeName(constraint)
+}
+
+// typeTerms returns the type terms that restrict a constraint, or none
+// when any type may satisfy it.
+func (tc *TypeChecker) typeTerms(constraint parser.TypeExpr) []parser.TypeExpr {
+	switch c := constraint.(type) {
+	case *parser.UnionType:
+		var terms []parser.TypeExpr
+		for _, term := range c.Terms {
+			terms = append(terms, tc.typeTerms(term)...)
+		}
+		return terms
+	case *parser.TildeType:
+		return []parser.TypeExpr{c.Elem}
+	case *parser.InterfaceType:
+		for _, embed := range c.Embeds {
+			if terms := tc.typeTerms(embed); len(terms) > 0 {
+				return terms
+			}
+		}
+		return nil
+	case *parser.IdentType:
+		if decl, ok := tc.interfaces[c.Name]; ok {
+			for _, embed := range decl.Embeds {
+				if terms := tc.typeTerms(embed); len(terms) > 0 {
+					return terms
+				}
+			}
+			return nil
+		}
+		if isAny(c) || c.Name == "comparable" || tc.isInterface(c.Name) {
+			return nil
+		}
+	}
+	return []parser.TypeExpr{constraint}
+}
+
+// checkTypeParamOperands checks an arithmetic or bitwise operator whose
+// left operand has the type parameter typ: it must be defined on every
+// type in the parameter's type set.
+func (tc *TypeChecker) checkTypeParamOperands(node parser.ASTNode, op, typ, rightType string, right parser.ASTNode) error {
+	constraint := tc.typeParams[typ]
+	if op != "<<" && op != ">>" && rightType != typ {
+		if _, ok := constValue(right); !ok {
+			return errorf(node, "type mismatch in binary operation: %s %s %s", typ, op, rightType)
+		}
+	}
+	terms := tc.typeTerms(constraint)
+	if len(terms) == 0 {
+		return errorf(node, "operator %s not defined on %s constrained by %s", op, typ, typeName(constraint))
+	}
+	for _, term := range terms {
+		if err := tc.checkOperands(node, op, typeName(term), typeName(term), nil); err != nil {
+			return errorf(node, "operator %s not defined on %s constrained by %s", op, typ, typeName(constraint))
+		}
+	}
+	return nil
+}
+
+func isArithmetic(op string) bool {
+	switch op {
+	case "+", "-", "*", "/", "%", "&", "|", "^", "&^", "<<", ">>":
+		return true
+	}
+	return false
+}
+
+func isAny(t parser.TypeExpr) bool {
+	switch typeName(t) {
+	case "any", "interface{}":
+		return true
+	}
+	return false
+}
+
+// isComparable reports whether values of typ may be compared with ==.
+func isComparable(typ string) bool {
+	for _, prefix := range []string{"[]", "map[", "func("} {
+		if strings.HasPrefix(typ, prefix) {
+			return false
+		}
+	}
+	return true
+}
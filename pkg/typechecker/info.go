@@ -0,0 +1,56 @@
+package typechecker
+
+import (
+	"strings"
+
+	"github.com/MistyPigeon/lingo/pkg/parser"
+)
+
+// Info is what the checker learns about a program that the code generator
+// needs to translate it to Go.
+type Info struct {
+	// Types holds the type of each expression checked.
+	Types map[parser.ASTNode]string
+
+	// Pointers holds the nullable values represented by pointers: those
+	// of a nullable type ?T whose element type cannot hold nil in Go.
+	Pointers map[parser.ASTNode]bool
+
+	// Deref holds the Pointers used as values of their element type,
+	// which must be dereferenced.
+	Deref map[parser.ASTNode]bool
+
+	// Boxed holds the non-null values stored in a nullable type that is
+	// represented by a pointer, by element type: a pointer to a copy of
+	// the value must be stored instead.
+	Boxed map[parser.ASTNode]string
+
+	interfaces map[string]*parser.InterfaceDecl
+}
+
+func newInfo(interfaces map[string]*parser.InterfaceDecl) *Info {
+	return &Info{
+		Types:      make(map[parser.ASTNode]string),
+		Pointers:   make(map[parser.ASTNode]bool),
+		Deref:      make(map[parser.ASTNode]bool),
+		Boxed:      make(map[parser.ASTNode]string),
+		interfaces: interfaces,
+	}
+}
+
+// PointerNullable reports whether the nullable type ?elem is represented
+// by the pointer type *elem, which it is unless values of elem may be nil
+// in Go: pointers, slices, maps, channels, functions and interfaces.
+func (info *Info) PointerNullable(elem string) bool {
+	for _, prefix := range []string{"*", "[]", "map[", "chan ", "chan<- ", "<-chan ", "func(", "interface"} {
+		if strings.HasPrefix(elem, prefix) {
+			return false
+		}
+	}
+	switch elem {
+	case "any", "error", "nil":
+		return false
+	}
+	_, ok := info.interfaces[elem]
+	return !ok
+}
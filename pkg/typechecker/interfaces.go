@@ -0,0 +1,433 @@
+package typechecker
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/MistyPigeon/lingo/pkg/parser"
+)
+
+// errorMethods is the method set of the predeclared error interface.
+var errorMethods = map[string]*parser.FuncType{
+	"Error": {Results: []parser.TypeExpr{&parser.IdentType{Name: "string"}}},
+}
+
+// declareInterface registers an interface type and checks that its own
+// methods are unique.
+func (tc *TypeChecker) declareInterface(decl *parser.InterfaceDecl) error {
+	if tc.isInterface(decl.Name) || tc.structs[decl.Name] != nil {
+		return errorf(decl, "type %s redeclared", decl.Name)
+	}
+
+	seen := make(map[string]bool)
+	for _, m := range decl.Methods {
+		if seen[m.Name] {
+			return errorf(m.Type, "duplicate method %s in interface %s", m.Name, decl.Name)
+		}
+		seen[m.Name] = true
+	}
+
+	tc.interfaces[decl.Name] = decl
+	return nil
+}
+
+// checkInterface checks the embedded interfaces of decl, which may only
+// be checked once every type has been declared.
+func (tc *TypeChecker) checkInterface(decl *parser.InterfaceDecl) error {
+	for _, embed := range decl.Embeds {
+		switch embed.(type) {
+		case *parser.QualifiedType:
+			// Interfaces from other packages cannot be checked here.
+			continue
+		case *parser.UnionType, *parser.TildeType:
+			// Type terms of a constraint.
+			continue
+		}
+		if !tc.isInterface(typeName(embed)) {
+			return errorf(embed, "cannot embed non-interface type %s in interface %s", typeName(embed), decl.Name)
+		}
+	}
+	_, err := tc.interfaceMethods(decl.Name, make(map[string]bool))
+	return err
+}
+
+func (tc *TypeChecker) isInterface(typ string) bool {
+	return typ == "error" || tc.interfaces[typ] != nil
+}
+
+// interfaceMethods returns the method set of the named interface,
+// including the methods of the interfaces it embeds. seen guards against
+// embedding cycles.
+func (tc *TypeChecker) interfaceMethods(name string, seen map[string]bool) (map[string]*parser.FuncType, error) {
+	if name == "error" {
+		return errorMethods, nil
+	}
+	decl := tc.interfaces[name]
+	if seen[name] {
+		return nil, errorf(decl, "invalid recursive interface %s", name)
+	}
+	seen[name] = true
+	defer delete(seen, name)
+
+	methods := make(map[string]*parser.FuncType)
+	for _, m := range decl.Methods {
+		methods[m.Name] = m.Type
+	}
+	for _, embed := range decl.Embeds {
+		if !tc.isInterface(typeName(embed)) {
+			continue
+		}
+		embedded, err := tc.interfaceMethods(typeName(embed), seen)
+		if err != nil {
+			return nil, err
+		}
+		for mname, sig := range embedded {
+			if prev, ok := methods[mname]; ok && prev.String() != sig.String() {
+				return nil, errorf(embed, "duplicate method %s in interface %s", mname, name)
+			}
+			methods[mname] = sig
+		}
+	}
+	return methods, nil
+}
+
+// embedsForeign reports whether the named interface embeds, directly or
+// not, an interface from another package, whose methods are unknown.
+func (tc *TypeChecker) embedsForeign(name string, seen map[string]bool) bool {
+	decl := tc.interfaces[name]
+	if decl == nil || seen[name] {
+		return false
+	}
+	seen[name] = true
+	for _, embed := range decl.Embeds {
+		if _, ok := embed.(*parser.QualifiedType); ok || tc.embedsForeign(typeName(embed), seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// methodSet returns the methods of typ. As in Go, the method set of T
+// holds the methods with value receivers and that of *T holds all of
+// them; methods of embedded fields are promoted.
+func (tc *TypeChecker) methodSet(typ string) map[string]*parser.FuncType {
+	if tc.isInterface(typ) {
+		methods, _ := tc.interfaceMethods(typ, make(map[string]bool))
+		return methods
+	}
+	methods := make(map[string]*parser.FuncType)
+	tc.collectMethods(typ, methods, make(map[string]bool))
+	return methods
+}
+
+func (tc *TypeChecker) collectMethods(typ string, methods map[string]*parser.FuncType, seen map[string]bool) {
+	base := baseTypeName(typ)
+	if seen[base] {
+		return
+	}
+	seen[base] = true
+
+	isPtr := strings.HasPrefix(typ, "*")
+	for name, fn := range tc.methods[base] {
+		if _, ok := methods[name]; ok {
+			continue
+		}
+		if _, ptrRecv := fn.Receiver.Type.(*parser.PointerType); ptrRecv && !isPtr {
+			continue
+		}
+		methods[name] = &parser.FuncType{Params: fn.Params, Results: fn.Returns}
+	}
+
+	decl, ok := tc.structs[base]
+	if !ok {
+		return
+	}
+	for _, f := range decl.Fields {
+		if f.Name != "" {
+			continue
+		}
+		embedded := typeName(f.Type)
+		if isPtr && !strings.HasPrefix(embedded, "*") {
+			embedded = "*" + embedded
+		}
+		tc.collectMethods(embedded, methods, seen)
+	}
+}
+
+// missingMethod reports the first method of iface that typ lacks or has
+// with the wrong signature; name is "" if typ implements iface.
+func (tc *TypeChecker) missingMethod(typ, iface string) (name string, wrongType bool) {
+	want := tc.methodSet(iface)
+	have := tc.methodSet(typ)
+
+	names := make([]string, 0, len(want))
+	for name := range want {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		sig, ok := have[name]
+		if !ok {
+			return name, false
+		}
+		if sig.String() != want[name].String() {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// implementsDetail explains why source cannot be assigned to target when
+// target is an interface, for appending to a mismatch error.
+func (tc *TypeChecker) implementsDetail(target, source string) string {
+	if !tc.isInterface(target) {
+		return ""
+	}
+	name, wrongType := tc.missingMethod(source, target)
+	switch {
+	case name == "":
+		return ""
+	case wrongType:
+		return ": " + source + " does not implement " + target + " (wrong type for method " + name + ")"
+	}
+	return ": " + source + " does not implement " + target + " (missing method " + name + ")"
+}
+
+// inferCallType types a call used as a value, which must return exactly
+// one result. Calls to unknown functions are untyped.
+func (tc *TypeChecker) inferCallType(call *parser.CallExpr) (string, error) {
+	results, known, err := tc.checkCall(call)
+	if err != nil || !known {
+		return "interface{}", err
+	}
+	switch len(results) {
+	case 0:
+		return "", errorf(call, "%s (no value) used as value", callName(call))
+	case 1:
+		if _, ok := results[0].(*parser.NullableType); ok {
+			tc.nullCalls[call] = true
+		}
+		return valueType(results[0]), nil
+	}
+	return "", errorf(call, "multiple-value %s in single-value context", callName(call))
+}
+
+// checkCall checks the arguments of a call and returns the results of
+// the callee; known is false if the callee is not declared in this file.
+func (tc *TypeChecker) checkCall(call *parser.CallExpr) (results []parser.TypeExpr, known bool, err error) {
+	name := strings.TrimSuffix(callName(call), "()")
+	switch fun := call.Fun.(type) {
+	case *parser.FuncLit:
+		sig, err := tc.checkFuncLit(fun)
+		if err != nil {
+			return nil, false, err
+		}
+		if err := tc.checkArgs(call, name, sig.Params, call.Args, call.Ellipsis); err != nil {
+			return nil, false, err
+		}
+		return sig.Results, true, nil
+	case *parser.Identifier:
+		if tc.lookupVar(fun.Name) != "" {
+			break
+		}
+		fn, ok := tc.funcs[fun.Name]
+		if !ok {
+			return tc.checkBuiltin(call, fun.Name)
+		}
+		if len(fn.TypeParams) > 0 {
+			return tc.checkGenericCall(call, fn, nil)
+		}
+		if err := tc.checkArgs(call, name, fn.Params, call.Args, call.Ellipsis); err != nil {
+			return nil, false, err
+		}
+		return fn.Returns, true, nil
+	case *parser.SelectorExpr:
+		if tc.isPackage(fun.X) {
+			// A function from another package, which is not known:
+			// only its arguments can be checked.
+			for _, arg := range call.Args {
+				if _, err := tc.inferExprType(arg); err != nil {
+					return nil, false, err
+				}
+			}
+			return nil, false, nil
+		}
+		xType, err := tc.inferExprType(fun.X)
+		if err != nil {
+			return nil, false, err
+		}
+		sig, ok, err := tc.selectedMethod(fun, xType)
+		if err != nil {
+			return nil, false, err
+		}
+		if ok {
+			if err := tc.checkArgs(call, name, sig.Params, call.Args, call.Ellipsis); err != nil {
+				return nil, false, err
+			}
+			return sig.Results, true, nil
+		}
+	}
+
+	if fn, explicit, ok := tc.genericFunc(call.Fun); ok {
+		return tc.checkGenericCall(call, fn, explicit)
+	}
+	funType, err := tc.inferExprType(call.Fun)
+	if err != nil {
+		return nil, false, err
+	}
+	params, results, ok := funcTypeSignature(funType)
+	if !ok {
+		return nil, false, nil
+	}
+	if err := tc.checkArgs(call, name, params, call.Args, call.Ellipsis); err != nil {
+		return nil, false, err
+	}
+	return results, true, nil
+}
+
+// funcTypeSignature recovers the parameters and results of a function
+// type from its name, such as "func(int, ...string) (int, error)".
+func funcTypeSignature(typ string) (params []*parser.Param, results []parser.TypeExpr, ok bool) {
+	if !strings.HasPrefix(typ, "func(") {
+		return nil, nil, false
+	}
+	end := closingParen(typ, len("func"))
+	if end < 0 {
+		return nil, nil, false
+	}
+
+	for _, p := range splitTypeList(typ[len("func("):end]) {
+		variadic := strings.HasPrefix(p, "...")
+		params = append(params, &parser.Param{Type: &parser.IdentType{Name: strings.TrimPrefix(p, "...")}, Variadic: variadic})
+	}
+
+	rest := strings.TrimSpace(typ[end+1:])
+	if strings.HasPrefix(rest, "(") {
+		rest = rest[1 : len(rest)-1]
+	}
+	results = []parser.TypeExpr{}
+	for _, r := range splitTypeList(rest) {
+		results = append(results, &parser.IdentType{Name: r})
+	}
+	return params, results, true
+}
+
+// closingParen returns the index of the parenthesis closing the one at
+// open, or -1.
+func closingParen(s string, open int) int {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// splitTypeList splits a comma-separated list of type names, ignoring
+// commas nested in brackets.
+func splitTypeList(s string) []string {
+	var list []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				list = append(list, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if last := strings.TrimSpace(s[start:]); last != "" {
+		list = append(list, last)
+	}
+	return list
+}
+
+// callName is how a call is referred to in errors, as in f() or x.m().
+func callName(call *parser.CallExpr) string {
+	if _, ok := call.Fun.(*parser.FuncLit); ok {
+		return "func literal"
+	}
+	return exprName(call.Fun) + "()"
+}
+
+// exprName renders the expressions that name functions, as in a.b().c,
+// for errors.
+func exprName(x parser.ASTNode) string {
+	switch e := x.(type) {
+	case *parser.Identifier:
+		return e.Name
+	case *parser.SelectorExpr:
+		return exprName(e.X) + "." + e.Sel.Name
+	case *parser.CallExpr:
+		return callName(e)
+	case *parser.IndexExpr:
+		return exprName(e.Expr) + "[...]"
+	case *parser.InstanceExpr:
+		return exprName(e.Expr)
+	case *parser.FuncLit:
+		return "func literal"
+	}
+	return "func value"
+}
+
+// checkArgs checks the arguments of a call to name against params.
+func (tc *TypeChecker) checkArgs(call parser.ASTNode, name string, params []*parser.Param, args []parser.ASTNode, ellipsis bool) error {
+	variadic := len(params) > 0 && params[len(params)-1].Variadic
+	if ellipsis && !variadic {
+		return errorf(call, "cannot use ... in call to non-variadic %s", name)
+	}
+	if len(args) < len(params) && !(variadic && len(args) == len(params)-1) {
+		return errorf(call, "not enough arguments in call to %s", name)
+	}
+	if len(args) > len(params) && !variadic {
+		return errorf(call, "too many arguments in call to %s", name)
+	}
+
+	for i, arg := range args {
+		argType, err := tc.inferExprType(arg)
+		if err != nil {
+			return err
+		}
+
+		param := params[len(params)-1]
+		if i < len(params)-1 || !variadic {
+			param = params[i]
+		}
+		paramType := valueType(param.Type)
+		if variadic && ellipsis && param == params[len(params)-1] {
+			paramType = "[]" + paramType
+		} else if _, ok := param.Type.(*parser.NullableType); ok {
+			paramType = "?" + paramType
+		}
+
+		if !tc.isCompatible(paramType, argType) && !isUntypedNumeric(arg, strings.TrimPrefix(paramType, "?")) {
+			return errorf(arg, "cannot use %s as %s in argument to %s%s", argType, paramType, name, tc.implementsDetail(paramType, argType))
+		}
+		if n, ok := param.Type.(*parser.NullableType); ok && !ellipsis {
+			tc.storeNullable(arg, typeName(n.Elem))
+		}
+	}
+	return nil
+}
+
+// valueType is the type of values of t; nullability is tracked
+// separately from types.
+func valueType(t parser.TypeExpr) string {
+	if n, ok := t.(*parser.NullableType); ok {
+		return typeName(n.Elem)
+	}
+	return typeName(t)
+}
@@ -0,0 +1,193 @@
+package typechecker
+
+import (
+	"github.com/MistyPigeon/lingo/pkg/parser"
+)
+
+// labelBlock is a list of statements in which labels may be declared.
+// index is the position in the parent block of the statement holding it.
+type labelBlock struct {
+	parent *labelBlock
+	index  int
+	stmts  []parser.ASTNode
+}
+
+type label struct {
+	stmt  *parser.LabeledStmt
+	block *labelBlock
+	index int
+	used  bool
+}
+
+// branch is a labeled break, continue or goto, with the labeled
+// statements enclosing it.
+type branch struct {
+	stmt      *parser.BranchStmt
+	block     *labelBlock
+	index     int
+	enclosing []*parser.LabeledStmt
+}
+
+// labelChecker collects the labels of a function body and the branches
+// that refer to them. Labels are scoped to the function, so a label may
+// be used before it is declared.
+type labelChecker struct {
+	labels    map[string]*label
+	branches  []branch
+	enclosing []*parser.LabeledStmt
+}
+
+// checkLabels checks the labels of a function body: each must be
+// declared once and used, break and continue must name an enclosing
+// statement they can leave, and goto may neither jump into a block nor
+// over a variable declaration.
+func checkLabels(body []parser.ASTNode) error {
+	lc := &labelChecker{labels: make(map[string]*label)}
+	if err := lc.walk(&labelBlock{stmts: body}); err != nil {
+		return err
+	}
+
+	for _, b := range lc.branches {
+		l, ok := lc.labels[b.stmt.Label]
+		if !ok {
+			return errorf(b.stmt, "label %s not defined", b.stmt.Label)
+		}
+		l.used = true
+
+		if b.stmt.Tok == "goto" {
+			if err := checkGoto(b, l); err != nil {
+				return err
+			}
+			continue
+		}
+		if !encloses(b.enclosing, l.stmt) || !isBranchTarget(b.stmt.Tok, l.stmt.Stmt) {
+			return errorf(b.stmt, "invalid %s label %s", b.stmt.Tok, b.stmt.Label)
+		}
+	}
+
+	return checkUnusedLabels(lc.labels)
+}
+
+func (lc *labelChecker) walk(block *labelBlock) error {
+	for i, stmt := range block.stmts {
+		if err := lc.walkStmt(block, i, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (lc *labelChecker) walkStmt(block *labelBlock, i int, stmt parser.ASTNode) error {
+	nested := func(stmts []parser.ASTNode) error {
+		return lc.walk(&labelBlock{parent: block, index: i, stmts: stmts})
+	}
+
+	switch s := stmt.(type) {
+	case *parser.LabeledStmt:
+		if prev, ok := lc.labels[s.Label]; ok {
+			return errorf(s, "label %s already defined at %s", s.Label, prev.stmt.Pos())
+		}
+		lc.labels[s.Label] = &label{stmt: s, block: block, index: i}
+		lc.enclosing = append(lc.enclosing, s)
+		defer func() { lc.enclosing = lc.enclosing[:len(lc.enclosing)-1] }()
+		return lc.walkStmt(block, i, s.Stmt)
+	case *parser.BranchStmt:
+		if s.Label != "" {
+			enclosing := append([]*parser.LabeledStmt(nil), lc.enclosing...)
+			lc.branches = append(lc.branches, branch{stmt: s, block: block, index: i, enclosing: enclosing})
+		}
+	case *parser.IfStmt:
+		if err := nested(s.Then); err != nil {
+			return err
+		}
+		return nested(s.Else)
+	case *parser.ForStmt:
+		return nested(s.Body)
+	case *parser.ForRangeStmt:
+		return nested(s.Body)
+	case *parser.SwitchStmt:
+		for _, clause := range s.Body {
+			if err := nested(clause.Body); err != nil {
+				return err
+			}
+		}
+	case *parser.TypeSwitchStmt:
+		for _, clause := range s.Body {
+			if err := nested(clause.Body); err != nil {
+				return err
+			}
+		}
+	case *parser.SelectStmt:
+		for _, c := range s.Cases {
+			if err := nested(c.Body); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkGoto checks that the goto b may jump to l: the label must be in
+// the block of the goto or one enclosing it, and a forward jump must not
+// skip a variable declaration in that block.
+func checkGoto(b branch, l *label) error {
+	block, index := b.block, b.index
+	for block != l.block {
+		if block.parent == nil {
+			return errorf(b.stmt, "goto %s jumps into block", b.stmt.Label)
+		}
+		block, index = block.parent, block.index
+	}
+	for i := index + 1; i < l.index; i++ {
+		if declaresVar(block.stmts[i]) {
+			return errorf(b.stmt, "goto %s jumps over variable declaration at %s", b.stmt.Label, block.stmts[i].Pos())
+		}
+	}
+	return nil
+}
+
+func declaresVar(stmt parser.ASTNode) bool {
+	switch s := stmt.(type) {
+	case *parser.VarDecl, *parser.ShortAssignStmt:
+		return true
+	case *parser.GenDecl:
+		return s.Tok == "var"
+	case *parser.LabeledStmt:
+		return declaresVar(s.Stmt)
+	}
+	return false
+}
+
+func encloses(enclosing []*parser.LabeledStmt, stmt *parser.LabeledStmt) bool {
+	for _, s := range enclosing {
+		if s == stmt {
+			return true
+		}
+	}
+	return false
+}
+
+// isBranchTarget reports whether a break or continue may leave stmt.
+func isBranchTarget(tok string, stmt parser.ASTNode) bool {
+	switch stmt.(type) {
+	case *parser.ForStmt, *parser.ForRangeStmt:
+		return true
+	case *parser.SwitchStmt, *parser.TypeSwitchStmt, *parser.SelectStmt:
+		return tok == "break"
+	}
+	return false
+}
+
+// checkUnusedLabels reports the first unused label, in source order.
+func checkUnusedLabels(labels map[string]*label) error {
+	var first *label
+	for _, l := range labels {
+		if !l.used && (first == nil || l.stmt.Pos().Offset < first.stmt.Pos().Offset) {
+			first = l
+		}
+	}
+	if first != nil {
+		return errorf(first.stmt, "label %s defined and not used", first.stmt.Label)
+	}
+	return nil
+}
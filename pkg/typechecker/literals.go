@@ -0,0 +1,180 @@
+package typechecker
+
+import (
+	"go/constant"
+	"strconv"
+
+	"github.com/MistyPigeon/lingo/pkg/parser"
+)
+
+// checkArrayLiteral types a slice or array literal. An untyped [a, b]
+// literal takes the type of its elements when they all agree.
+func (tc *TypeChecker) checkArrayLiteral(lit *parser.ArrayLiteral) (string, error) {
+	if lit.Type == nil {
+		elemType := ""
+		for _, elem := range lit.Elements {
+			typ, err := tc.inferExprType(elem)
+			if err != nil {
+				return "", err
+			}
+			if elemType == "" {
+				elemType = typ
+			} else if typ != elemType {
+				elemType = "interface{}"
+			}
+		}
+		if elemType == "" || elemType == "nil" {
+			return "[]interface{}", nil
+		}
+		return "[]" + elemType, nil
+	}
+
+	elemType := typeName(lit.Type)
+	typ := "[]" + elemType
+	if lit.Len != nil {
+		typ = (&parser.ArrayType{Len: lit.Len, Elem: lit.Type}).String()
+		if c, ok := constValue(lit.Len); ok {
+			if n, exact := constant.Int64Val(constant.ToInt(c)); exact && int64(len(lit.Elements)) > n {
+				return "", errorf(lit.Elements[n], "array index %d out of bounds [0:%d]", n, n)
+			}
+		}
+	}
+	for _, elem := range lit.Elements {
+		if err := tc.checkElement(elem, elemType, "slice"); err != nil {
+			return "", err
+		}
+	}
+	return typ, nil
+}
+
+// checkMapLiteral types a map literal and rejects duplicate constant keys.
+func (tc *TypeChecker) checkMapLiteral(lit *parser.MapLiteral) (string, error) {
+	keyType, valueType := "string", "interface{}"
+	if lit.KeyType != nil {
+		keyType, valueType = typeName(lit.KeyType), typeName(lit.ValueType)
+	}
+
+	seen := make(map[string]bool)
+	for _, entry := range lit.Entries {
+		if err := tc.checkElement(entry.Key, keyType, "map key"); err != nil {
+			return "", err
+		}
+		if key, ok := constKey(entry.Key); ok {
+			if seen[key] {
+				return "", errorf(entry.Key, "duplicate key %s in map literal", key)
+			}
+			seen[key] = true
+		}
+		if err := tc.checkElement(entry.Value, valueType, "map"); err != nil {
+			return "", err
+		}
+	}
+	return "map[" + keyType + "]" + valueType, nil
+}
+
+// checkStructLiteral types T{...}. The fields of a struct declared in this
+// program are checked by name or position, with the type arguments of a
+// generic struct substituted; those of other types are not known, so only
+// their values are checked.
+func (tc *TypeChecker) checkStructLiteral(lit *parser.StructLiteral) (string, error) {
+	typ := typeName(lit.Type)
+	if tc.isInterface(typ) {
+		return "", errorf(lit, "invalid composite literal type %s", typ)
+	}
+	if err := tc.checkInstance(lit.Type); err != nil {
+		return "", err
+	}
+	decl, ok := tc.structs[baseTypeName(typ)]
+	if !ok {
+		for _, f := range lit.Fields {
+			if _, err := tc.inferExprType(f.Value); err != nil {
+				return "", err
+			}
+		}
+		return typ, nil
+	}
+
+	bind := tc.instanceBindings(typ)
+	keyed := len(lit.Fields) > 0 && lit.Fields[0].Key != nil
+	seen := make(map[string]bool)
+	for i, f := range lit.Fields {
+		if (f.Key != nil) != keyed {
+			return "", errorf(f, "mixture of field:value and value elements in struct literal")
+		}
+
+		var field *parser.StructField
+		if keyed {
+			ident, ok := f.Key.(*parser.Identifier)
+			if !ok {
+				return "", errorf(f.Key, "invalid field name in struct literal")
+			}
+			for _, candidate := range decl.Fields {
+				if fieldName(candidate) == ident.Name {
+					field = candidate
+				}
+			}
+			if field == nil {
+				return "", errorf(f.Key, "unknown field %s in struct literal of type %s", ident.Name, typ)
+			}
+			if seen[ident.Name] {
+				return "", errorf(f.Key, "duplicate field name %s in struct literal", ident.Name)
+			}
+			seen[ident.Name] = true
+		} else {
+			if i >= len(decl.Fields) {
+				return "", errorf(f.Value, "too many values in struct literal of type %s", typ)
+			}
+			field = decl.Fields[i]
+		}
+
+		if _, ok := f.Value.(*parser.LiteralNull); ok {
+			if !field.IsNullable {
+				return "", errorf(f.Value, "cannot use null as value of non-nullable field %s", fieldName(field))
+			}
+			tc.info.Types[f.Value] = "nil"
+			continue
+		}
+		fieldType := typeName(substType(field.Type, bind))
+		if err := tc.checkElement(f.Value, fieldType, "struct"); err != nil {
+			return "", err
+		}
+		if field.IsNullable {
+			tc.storeNullable(f.Value, fieldType)
+		}
+	}
+	if !keyed && len(lit.Fields) > 0 && len(lit.Fields) < len(decl.Fields) {
+		return "", errorf(lit, "too few values in struct literal of type %s", typ)
+	}
+	return typ, nil
+}
+
+// checkElement checks that elem may be used as a value of typ in a
+// literal of the given kind.
+func (tc *TypeChecker) checkElement(elem parser.ASTNode, typ, kind string) error {
+	elemType, err := tc.inferExprType(elem)
+	if err != nil {
+		return err
+	}
+	if _, ok := constValue(elem); ok && isNumericType(typ) {
+		return tc.checkConstantFits(elem, typ)
+	}
+	if !tc.isCompatible(typ, elemType) {
+		return errorf(elem, "cannot use %s as %s value in %s literal%s", elemType, typ, kind, tc.implementsDetail(typ, elemType))
+	}
+	return nil
+}
+
+// constKey returns a canonical form of a constant map key, used to find
+// duplicates.
+func constKey(key parser.ASTNode) (string, bool) {
+	switch k := key.(type) {
+	case *parser.LiteralString:
+		return strconv.Quote(k.Value), true
+	case *parser.LiteralBool:
+		return strconv.FormatBool(k.Value), true
+	}
+	if c, ok := constValue(key); ok {
+		return c.ExactString(), true
+	}
+	return "", false
+}
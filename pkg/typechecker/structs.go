@@ -0,0 +1,243 @@
+package typechecker
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/MistyPigeon/lingo/pkg/parser"
+)
+
+// declareStruct registers a struct type and its field set.
+func (tc *TypeChecker) declareStruct(decl *parser.StructDecl) error {
+	if _, ok := tc.structs[decl.Name]; ok {
+		return errorf(decl, "struct %s redeclared", decl.Name)
+	}
+	if tc.isInterface(decl.Name) {
+		return errorf(decl, "type %s redeclared", decl.Name)
+	}
+
+	seen := make(map[string]bool)
+	for _, f := range decl.Fields {
+		name := fieldName(f)
+		if seen[name] {
+			return errorf(f.Type, "duplicate field %s in struct %s", name, decl.Name)
+		}
+		seen[name] = true
+	}
+
+	tc.structs[decl.Name] = decl
+	return nil
+}
+
+// declareMethod records fn in the method set of its receiver's base type.
+func (tc *TypeChecker) declareMethod(fn *parser.FuncDecl) error {
+	if fn.Receiver == nil {
+		return nil
+	}
+	base := baseTypeName(typeName(fn.Receiver.Type))
+	if tc.methods[base] == nil {
+		tc.methods[base] = make(map[string]*parser.FuncDecl)
+	}
+	if _, ok := tc.methods[base][fn.Name]; ok {
+		return errorf(fn, "method %s.%s redeclared", base, fn.Name)
+	}
+	if decl, ok := tc.structs[base]; ok {
+		for _, f := range decl.Fields {
+			if fieldName(f) == fn.Name {
+				return errorf(fn, "field and method with the same name %s", fn.Name)
+			}
+		}
+	}
+	tc.methods[base][fn.Name] = fn
+	return nil
+}
+
+// inferSelectorType types x.f: a field or method of a struct, or a name
+// from another package.
+func (tc *TypeChecker) inferSelectorType(sel *parser.SelectorExpr) (string, error) {
+	if tc.isPackage(sel.X) {
+		// A package-qualified name such as time.Second.
+		return "interface{}", nil
+	}
+
+	xType, err := tc.inferExprType(sel.X)
+	if err != nil {
+		return "", err
+	}
+	name := sel.Sel.Name
+	if sig, ok, err := tc.selectedMethod(sel, xType); err != nil || ok {
+		if err != nil {
+			return "", err
+		}
+		return sig.String(), nil
+	}
+
+	base := baseTypeName(xType)
+	if tc.isInterface(xType) {
+		if tc.embedsForeign(xType, make(map[string]bool)) {
+			return "interface{}", nil
+		}
+		return "", errorf(sel.Sel, "%s has no field or method %s", xType, name)
+	}
+	if _, ok := tc.structs[base]; !ok {
+		// A named type has the fields of the struct it is declared with.
+		if u := baseTypeName(tc.underlying(base)); tc.structs[u] != nil {
+			base = u
+		} else if tc.membersUnknown(xType) {
+			return "interface{}", nil
+		} else {
+			return "", errorf(sel.Sel, "%s has no field or method %s", xType, name)
+		}
+	}
+	if f := tc.lookupField(base, name, make(map[string]bool)); f != nil {
+		return typeName(substType(f.Type, tc.instanceBindings(xType))), nil
+	}
+	return "", errorf(sel.Sel, "%s has no field or method %s", xType, name)
+}
+
+// membersUnknown reports whether the fields and methods of typ are not
+// known to the checker, as for the types of other packages, type
+// parameters, struct type literals and values of unknown type.
+func (tc *TypeChecker) membersUnknown(typ string) bool {
+	seen := make(map[string]bool)
+	for !seen[typ] {
+		seen[typ] = true
+		base := baseTypeName(typ)
+		if base == "interface{}" || strings.HasPrefix(base, "struct") || strings.Contains(base, ".") {
+			return true
+		}
+		if _, ok := tc.typeParams[base]; ok {
+			return true
+		}
+		typ = tc.underlying(base)
+	}
+	return false
+}
+
+// selectedMethod returns the signature of the method selected by x.f,
+// where x has type xType, with the type arguments of a generic receiver
+// substituted. ok is false if f is not a method of xType.
+func (tc *TypeChecker) selectedMethod(sel *parser.SelectorExpr, xType string) (sig *parser.FuncType, ok bool, err error) {
+	name := sel.Sel.Name
+	if tc.isInterface(xType) {
+		sig, ok = tc.methodSet(xType)[name]
+		return sig, ok, nil
+	}
+
+	base := baseTypeName(xType)
+	if sig, ok = tc.methodSet(xType)[name]; !ok {
+		// Pointer methods may be called on addressable values.
+		if sig, ok = tc.methodSet("*" + base)[name]; ok && !isAddressable(sel.X) {
+			return nil, false, errorf(sel.Sel, "cannot call pointer method %s on %s", name, xType)
+		}
+	}
+	if !ok {
+		return nil, false, nil
+	}
+	if fn := tc.methods[base][name]; fn != nil {
+		bind := methodBindings(fn, xType)
+		sig = &parser.FuncType{Params: substParams(sig.Params, bind), Results: substTypes(sig.Results, bind)}
+	}
+	return sig, true, nil
+}
+
+// declareImport records the name an import makes visible: its alias, or
+// else the last element of its path that is not a major version such as
+// v2. Blank and dot imports declare no name.
+func (tc *TypeChecker) declareImport(imp *parser.ImportDecl) {
+	name := imp.Alias
+	if name == "" {
+		elems := strings.Split(imp.Path, "/")
+		name = elems[len(elems)-1]
+		if len(elems) > 1 && isMajorVersion(name) {
+			name = elems[len(elems)-2]
+		}
+	}
+	if name != "_" && name != "." {
+		tc.packages[name] = true
+	}
+}
+
+// isMajorVersion reports whether a path element is a major version
+// suffix such as v2.
+func isMajorVersion(elem string) bool {
+	if len(elem) < 2 || elem[0] != 'v' {
+		return false
+	}
+	_, err := strconv.Atoi(elem[1:])
+	return err == nil
+}
+
+// isPackage reports whether x names an imported package rather than a
+// variable.
+func (tc *TypeChecker) isPackage(x parser.ASTNode) bool {
+	ident, ok := x.(*parser.Identifier)
+	return ok && tc.packages[ident.Name] && tc.lookupVar(ident.Name) == ""
+}
+
+// isAddressable reports whether x denotes a variable, whose address may
+// be taken.
+func isAddressable(x parser.ASTNode) bool {
+	switch e := x.(type) {
+	case *parser.Identifier, *parser.IndexExpr:
+		return true
+	case *parser.SelectorExpr:
+		return isAddressable(e.X)
+	case *parser.UnaryOp:
+		return e.Op == "*"
+	}
+	return false
+}
+
+// selectedField returns the struct field selected by x.f, if any.
+func (tc *TypeChecker) selectedField(sel *parser.SelectorExpr) *parser.StructField {
+	xType, err := tc.inferExprType(sel.X)
+	if err != nil {
+		return nil
+	}
+	return tc.lookupField(baseTypeName(xType), sel.Sel.Name, make(map[string]bool))
+}
+
+// lookupField finds a field of the named struct, including fields promoted
+// from embedded structs. seen guards against embedding cycles.
+func (tc *TypeChecker) lookupField(structName, name string, seen map[string]bool) *parser.StructField {
+	decl, ok := tc.structs[structName]
+	if !ok || seen[structName] {
+		return nil
+	}
+	seen[structName] = true
+
+	for _, f := range decl.Fields {
+		if fieldName(f) == name {
+			return f
+		}
+	}
+	for _, f := range decl.Fields {
+		if f.Name != "" {
+			continue
+		}
+		if promoted := tc.lookupField(baseTypeName(typeName(f.Type)), name, seen); promoted != nil {
+			return promoted
+		}
+	}
+	return nil
+}
+
+// fieldName returns the name of a struct field; an embedded field is
+// named after its type.
+func fieldName(f *parser.StructField) string {
+	if f.Name != "" {
+		return f.Name
+	}
+	name := baseTypeName(typeName(f.Type))
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
+
+// baseTypeName strips any pointer and type arguments from a type name.
+func baseTypeName(typ string) string {
+	base, _ := typeArgs(typ)
+	return base
+}
@@ -2,23 +2,107 @@ package typechecker
 
 import (
 	"fmt"
+	"go/constant"
+	"go/token"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/MistyPigeon/lingo/pkg/parser"
 )
 
+// Error is a type error at a position in the source.
+type Error struct {
+	Pos parser.Pos
+	Msg string
+}
+
+func (e *Error) Error() string {
+	if !e.Pos.IsValid() {
+		return e.Msg
+	}
+	return e.Pos.String() + ": " + e.Msg
+}
+
+func errorf(node parser.ASTNode, format string, args ...interface{}) error {
+	return &Error{Pos: node.Pos(), Msg: fmt.Sprintf(format, args...)}
+}
+
 type TypeChecker struct {
-	scopes       []map[string]string
-	nullableVars map[string]bool
+	scopes       []map[string]string // variable types, "?T" if nullable
+	nullableVars map[string]bool     // nullable named types
+	structs      map[string]*parser.StructDecl
+	interfaces   map[string]*parser.InterfaceDecl
+	funcs        map[string]*parser.FuncDecl
+	methods      map[string]map[string]*parser.FuncDecl // by receiver base type
+	narrowed     map[string]bool                        // nullability of variables narrowed by a null check
+	derefs       []parser.ASTNode                       // nullable values dereferenced, to check once their use is known
+	loopDepth    int                                    // enclosing loops, for continue
+	breakDepth   int                                    // enclosing loops and switches, for break
+	consts       map[string]constant.Value              // values of untyped constants
+	iota         int                                    // value of iota, or -1 outside a constant
+	typeParams   map[string]parser.TypeExpr             // constraints of the type parameters in scope
+	results      []parser.TypeExpr                      // results of the function being checked
+	nullCalls    map[*parser.CallExpr]bool              // calls returning a nullable value
+	packages     map[string]bool                        // names of imported packages
+	info         *Info
 }
 
 func New() *TypeChecker {
+	interfaces := make(map[string]*parser.InterfaceDecl)
 	return &TypeChecker{
 		scopes:       []map[string]string{make(map[string]string)},
 		nullableVars: make(map[string]bool),
+		structs:      make(map[string]*parser.StructDecl),
+		interfaces:   interfaces,
+		funcs:        make(map[string]*parser.FuncDecl),
+		methods:      make(map[string]map[string]*parser.FuncDecl),
+		narrowed:     make(map[string]bool),
+		consts:       make(map[string]constant.Value),
+		iota:         -1,
+		typeParams:   make(map[string]parser.TypeExpr),
+		nullCalls:    make(map[*parser.CallExpr]bool),
+		packages:     map[string]bool{"fmt": true}, // fmt needs no import
+		info:         newInfo(interfaces),
 	}
 }
 
+// Info returns what the checker has learnt about the program checked.
+func (tc *TypeChecker) Info() *Info {
+	return tc.info
+}
+
 func (tc *TypeChecker) Check(program *parser.Program) error {
+	// Declare named types and methods first so that they may be used
+	// before their declaration.
+	for _, item := range program.Items {
+		switch node := item.(type) {
+		case *parser.StructDecl, *parser.InterfaceDecl:
+			if err := tc.declareType(node); err != nil {
+				return err
+			}
+		case *parser.ImportDecl:
+			tc.declareImport(node)
+		case *parser.GenDecl:
+			for _, spec := range node.Specs {
+				if imp, ok := spec.(*parser.ImportDecl); ok {
+					tc.declareImport(imp)
+				}
+				if err := tc.declareType(spec); err != nil {
+					return err
+				}
+			}
+		case *parser.FuncDecl:
+			if node.Receiver == nil {
+				tc.funcs[node.Name] = node
+			}
+			if err := tc.declareMethod(node); err != nil {
+				return err
+			}
+		}
+	}
+
 	for _, item := range program.Items {
 		switch node := item.(type) {
 		case *parser.FuncDecl:
@@ -37,6 +121,55 @@ func (tc *TypeChecker) Check(program *parser.Program) error {
 			if err := tc.checkType(node); err != nil {
 				return err
 			}
+		case *parser.InterfaceDecl:
+			if err := tc.checkInterface(node); err != nil {
+				return err
+			}
+		case *parser.GenDecl:
+			if err := tc.checkGenDecl(node); err != nil {
+				return err
+			}
+		}
+		if err := tc.checkDerefs(0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// declareType registers a struct or interface declared by node, which
+// may be any declaration.
+func (tc *TypeChecker) declareType(node parser.ASTNode) error {
+	switch n := node.(type) {
+	case *parser.StructDecl:
+		return tc.declareStruct(n)
+	case *parser.InterfaceDecl:
+		return tc.declareInterface(n)
+	}
+	return nil
+}
+
+// checkGenDecl checks each declaration of a group. A constant without a
+// value repeats the type and value of the constant before it.
+func (tc *TypeChecker) checkGenDecl(decl *parser.GenDecl) error {
+	var prev *parser.ConstDecl
+	for _, spec := range decl.Specs {
+		var err error
+		switch s := spec.(type) {
+		case *parser.ConstDecl:
+			if s.Value != nil {
+				prev = s
+			}
+			err = tc.checkConstSpec(s, prev.Type, prev.Value)
+		case *parser.VarDecl:
+			err = tc.checkVar(s)
+		case *parser.TypeDecl:
+			err = tc.checkType(s)
+		case *parser.InterfaceDecl:
+			err = tc.checkInterface(s)
+		}
+		if err != nil {
+			return err
 		}
 	}
 	return nil
@@ -46,56 +179,157 @@ func (tc *TypeChecker) checkFunc(fn *parser.FuncDecl) error {
 	tc.pushScope()
 	defer tc.popScope()
 
-	for _, param := range fn.Params {
-		tc.defineVar(param.Name, param.Type)
+	typeParams := fn.TypeParams
+	if fn.Receiver != nil {
+		typeParams = tc.receiverTypeParams(fn.Receiver)
 	}
+	if err := tc.declareTypeParams(typeParams); err != nil {
+		return err
+	}
+	defer func() { tc.typeParams = make(map[string]parser.TypeExpr) }()
 
-	for _, stmt := range fn.Body {
-		if err := tc.checkStatement(stmt); err != nil {
+	tc.results = fn.Returns
+	defer func() { tc.results = nil }()
+
+	if fn.Receiver != nil {
+		tc.defineVar(fn.Receiver.Name, typeName(fn.Receiver.Type))
+	}
+	for _, param := range fn.Params {
+		if err := tc.checkInstance(param.Type); err != nil {
 			return err
 		}
 	}
+	tc.defineParams(fn.Params)
 
-	return nil
+	if err := checkLabels(fn.Body); err != nil {
+		return err
+	}
+
+	return tc.checkStatements(fn.Body)
+}
+
+func (tc *TypeChecker) defineParams(params []*parser.Param) {
+	for _, param := range params {
+		if param.Variadic {
+			tc.defineVar(param.Name, "[]"+typeName(param.Type))
+			continue
+		}
+		tc.defineVar(param.Name, typeName(param.Type))
+	}
+}
+
+// checkFuncLit checks a function literal, which sees the variables of
+// the enclosing scopes, and returns its type. An arrow function gets the
+// type of its expression as its result type.
+func (tc *TypeChecker) checkFuncLit(lit *parser.FuncLit) (*parser.FuncType, error) {
+	tc.pushScope()
+	defer tc.popScope()
+
+	// break and continue cannot leave a function.
+	loopDepth, breakDepth, results := tc.loopDepth, tc.breakDepth, tc.results
+	defer func() { tc.loopDepth, tc.breakDepth, tc.results = loopDepth, breakDepth, results }()
+
+	tc.defineParams(lit.Type.Params)
+
+	// An arrow lambda without a result type returns the type of its
+	// expression. The AST is left alone; codegen reads the type back
+	// from Info.Types.
+	sig := *lit.Type
+	if lit.Arrow && len(sig.Results) == 0 {
+		expr := lit.Body[0].(*parser.ReturnStmt).Values[0]
+		typ, err := tc.inferExprType(expr)
+		if err != nil {
+			return nil, err
+		}
+		if typ == "nil" {
+			typ = "interface{}"
+		}
+		sig.Results = []parser.TypeExpr{&parser.IdentType{Span: parser.Span{From: expr.Pos(), To: expr.End()}, Name: typ}}
+	}
+	tc.loopDepth, tc.breakDepth, tc.results = 0, 0, sig.Results
+
+	if err := checkLabels(lit.Body); err != nil {
+		return nil, err
+	}
+
+	if err := tc.checkStatements(lit.Body); err != nil {
+		return nil, err
+	}
+	return &sig, nil
 }
 
 func (tc *TypeChecker) checkVar(v *parser.VarDecl) error {
+	if err := tc.checkInstance(v.Type); err != nil {
+		return err
+	}
 	if v.Value != nil {
 		exprType, err := tc.inferExprType(v.Value)
 		if err != nil {
 			return err
 		}
 
-		if v.Type != "" && v.Type != exprType && !tc.isCompatible(v.Type, exprType) {
-			return fmt. Errorf("type mismatch for var %s: expected %s, got %s", v.Name, v.Type, exprType)
+		if declType := typeName(v.Type); declType != "" {
+			if err := tc.checkConstantFits(v.Value, declType); err != nil {
+				return err
+			}
+			target := declType
+			if v.IsNullable {
+				target = "?" + declType
+			}
+			if declType != exprType && !tc.isCompatible(target, exprType) && !tc.isUntypedConst(v.Value, exprType, declType) {
+				return errorf(v, "type mismatch for var %s: expected %s, got %s%s", v.Name, target, exprType, tc.implementsDetail(declType, exprType))
+			}
+			exprType = declType
 		}
 
 		if v.IsNullable {
-			tc.nullableVars[v.Name] = true
+			tc.storeNullable(v.Value, exprType)
+			exprType = "?" + exprType
 		}
 
 		tc.defineVar(v.Name, exprType)
-	} else if v.Type != "" {
+	} else if v.Type != nil {
+		varType := typeName(v.Type)
 		if v.IsNullable {
-			tc.nullableVars[v.Name] = true
+			varType = "?" + varType
 		}
-		tc.defineVar(v. Name, v.Type)
+		tc.defineVar(v. Name, varType)
 	}
 
 	return nil
 }
 
 func (tc *TypeChecker) checkConst(c *parser. ConstDecl) error {
-	exprType, err := tc.inferExprType(c.Value)
+	return tc.checkConstSpec(c, c.Type, c.Value)
+}
+
+// checkConstSpec checks the constant c with the given type and value,
+// which it may have repeated from an earlier constant of its group.
+// Untyped constants whose value is known are recorded for use in later
+// constant expressions.
+func (tc *TypeChecker) checkConstSpec(c *parser.ConstDecl, typ parser.TypeExpr, value parser.ASTNode) error {
+	tc.iota = c.Iota
+	defer func() { tc.iota = -1 }()
+
+	exprType, err := tc.inferExprType(value)
 	if err != nil {
 		return err
 	}
 
-	if c.Type != "" && c.Type != exprType && !tc.isCompatible(c.Type, exprType) {
-		return fmt. Errorf("type mismatch for const %s: expected %s, got %s", c.Name, c.Type, exprType)
+	if declType := typeName(typ); declType != "" {
+		if err := tc.checkConstantFits(value, declType); err != nil {
+			return err
+		}
+		if declType != exprType && !tc.isCompatible(declType, exprType) && !tc.isUntypedConst(value, exprType, declType) {
+			return errorf(c, "type mismatch for const %s: expected %s, got %s", c.Name, declType, exprType)
+		}
+		exprType = declType
 	}
 
 	tc.defineVar(c.Name, exprType)
+	if val, ok := tc.constEval(value); ok && typ == nil {
+		tc.consts[c.Name] = val
+	}
 	return nil
 }
 
@@ -103,60 +337,230 @@ func (tc *TypeChecker) checkType(t *parser.TypeDecl) error {
 	if t.IsNullable {
 		tc. nullableVars[t.Name] = true
 	}
-	tc.defineVar(t. Name, t.Type)
+	tc.defineVar(t. Name, typeName(t.Type))
+	return nil
+}
+
+// checkStatements checks a list of statements. After an if statement
+// that leaves the function or loop when a variable is null, as in
+// "if x == null { return }", the variable is non-null for the rest of
+// the list.
+func (tc *TypeChecker) checkStatements(body []parser.ASTNode) error {
+	var restore []func()
+	defer func() {
+		for i := len(restore) - 1; i >= 0; i-- {
+			restore[i]()
+		}
+	}()
+
+	for _, stmt := range body {
+		if err := tc.checkStatement(stmt); err != nil {
+			return err
+		}
+		if ifStmt, ok := stmt.(*parser.IfStmt); ok && len(ifStmt.Else) == 0 && terminates(ifStmt.Then) {
+			for _, name := range nullTests(ifStmt.Condition, "==") {
+				restore = append(restore, tc.narrow(name, false))
+			}
+		}
+	}
 	return nil
 }
 
+// checkStatement checks a statement, then that the nullable values it
+// dereferences are known to be non-null.
 func (tc *TypeChecker) checkStatement(stmt interface{}) error {
+	mark := len(tc.derefs)
+	if err := tc.checkStmt(stmt); err != nil {
+		tc.derefs = tc.derefs[:mark]
+		return err
+	}
+	return tc.checkDerefs(mark)
+}
+
+// checkDerefs reports the first nullable value recorded since mark that
+// is used as a value of its element type without being narrowed to
+// non-null, which would dereference a nil pointer if it were null.
+func (tc *TypeChecker) checkDerefs(mark int) error {
+	derefs := tc.derefs[mark:]
+	tc.derefs = tc.derefs[:mark]
+	for _, node := range derefs {
+		if tc.info.Deref[node] {
+			typ := tc.info.Types[node]
+			return errorf(node, "cannot use nullable ?%s as %s value without a null check", typ, typ)
+		}
+	}
+	return nil
+}
+
+func (tc *TypeChecker) checkStmt(stmt interface{}) error {
 	switch s := stmt.(type) {
 	case *parser.VarDecl:
 		return tc.checkVar(s)
 	case *parser.ConstDecl:
 		return tc.checkConst(s)
+	case *parser.GenDecl:
+		return tc.checkGenDecl(s)
 	case *parser.ReturnStmt:
 		return tc.checkReturn(s)
 	case *parser. IfStmt:
 		return tc.checkIf(s)
 	case *parser.ForStmt:
 		return tc. checkFor(s)
+	case *parser.ForRangeStmt:
+		return tc.checkForRange(s)
+	case *parser.SwitchStmt:
+		return tc.checkSwitch(s)
+	case *parser.TypeSwitchStmt:
+		return tc.checkTypeSwitch(s)
+	case *parser.BranchStmt:
+		return tc.checkBranch(s)
+	case *parser.LabeledStmt:
+		if s.Stmt == nil {
+			return nil
+		}
+		return tc.checkStatement(s.Stmt)
 	case *parser.CallExpr:
-		_, err := tc.inferExprType(s)
+		_, _, err := tc.checkCall(s)
+		return err
+	case *parser.GoStmt:
+		_, _, err := tc.checkCall(s.Call)
+		return err
+	case *parser.DeferStmt:
+		_, _, err := tc.checkCall(s.Call)
 		return err
 	case *parser.AssignStmt:
 		return tc.checkAssign(s)
+	case *parser.ShortAssignStmt:
+		return tc.checkShortAssign(s)
+	case *parser.IncDecStmt:
+		return tc.checkIncDec(s)
+	case *parser.SelectStmt:
+		return tc.checkSelect(s)
+	case *parser.ChanOp:
+		if s.Value != nil {
+			return tc.checkSend(s)
+		}
+		_, err := tc.inferExprType(s)
+		return err
+	case *parser.PanicStmt:
+		_, err := tc.inferExprType(s.Expr)
+		return err
+	case *parser.RecoverExpr, *parser.BadStmt, nil:
+		return nil
+	case parser.ASTNode:
+		// Any other expression computes a value only to drop it.
+		typ, err := tc.inferExprType(s)
+		if err != nil {
+			return err
+		}
+		return errorf(s, "%s of type %s is not used", describe(s), typ)
 	}
 	return nil
 }
 
+// checkReturn checks that a return statement gives the results of the
+// function being checked: a value for each, or a call returning them all.
 func (tc *TypeChecker) checkReturn(ret *parser.ReturnStmt) error {
-	for _, val := range ret.Values {
-		_, err := tc.inferExprType(val)
+	want := len(tc.results)
+	if call, ok := singleCall(ret.Values); ok && want > 1 {
+		results, known, err := tc.checkCall(call)
+		if err != nil || !known {
+			return err
+		}
+		if len(results) != want {
+			return errorf(ret, "%s return values: %s returns %s, want %d", tooManyOrFew(len(results), want), callName(call), count(len(results), "value"), want)
+		}
+		for i, result := range results {
+			if err := tc.checkResult(call, valueType(result), i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if len(ret.Values) != want {
+		return errorf(ret, "%s return values: have %d, want %d", tooManyOrFew(len(ret.Values), want), len(ret.Values), want)
+	}
+	for i, val := range ret.Values {
+		typ, err := tc.inferExprType(val)
 		if err != nil {
 			return err
 		}
+		if err := tc.checkResult(val, typ, i); err != nil {
+			return err
+		}
+		if n, ok := tc.results[i].(*parser.NullableType); ok {
+			tc.storeNullable(val, typeName(n.Elem))
+		}
+	}
+	return nil
+}
+
+// checkResult checks that val, of type typ, may be returned as the i'th
+// result of the function being checked. A value of type interface{} is
+// let through, as it is also the type of values the checker does not
+// know the type of, such as conversions and calls into other packages.
+func (tc *TypeChecker) checkResult(val parser.ASTNode, typ string, i int) error {
+	if typ == "interface{}" {
+		return nil
+	}
+	elem := valueType(tc.results[i])
+	target := elem
+	if _, ok := tc.results[i].(*parser.NullableType); ok {
+		target = "?" + elem
+	}
+	if err := tc.checkConstantFits(val, elem); err != nil {
+		return err
+	}
+	if typ != elem && !tc.isCompatible(target, typ) && !tc.isUntypedConst(val, typ, elem) {
+		return errorf(val, "cannot use %s as %s value in return statement%s", typ, target, tc.implementsDetail(elem, typ))
 	}
 	return nil
 }
 
+// singleCall returns the call that is the only one of values, if it is.
+func singleCall(values []parser.ASTNode) (*parser.CallExpr, bool) {
+	if len(values) != 1 {
+		return nil, false
+	}
+	call, ok := values[0].(*parser.CallExpr)
+	return call, ok
+}
+
+func tooManyOrFew(have, want int) string {
+	if have > want {
+		return "too many"
+	}
+	return "not enough"
+}
+
+// checkIf checks an if statement. A condition testing variables against
+// null narrows them to non-null in the branch where the test excludes
+// null.
 func (tc *TypeChecker) checkIf(ifStmt *parser.IfStmt) error {
 	_, err := tc.inferExprType(ifStmt.Condition)
 	if err != nil {
 		return err
 	}
 
-	for _, stmt := range ifStmt.Then {
-		if err := tc. checkStatement(stmt); err != nil {
-			return err
-		}
+	restore := tc.narrowAll(nullTests(ifStmt.Condition, "!="))
+	err = tc.checkBlock(ifStmt.Then)
+	restore()
+	if err != nil {
+		return err
 	}
 
-	for _, stmt := range ifStmt. Else {
-		if err := tc.checkStatement(stmt); err != nil {
-			return err
-		}
-	}
+	restore = tc.narrowAll(nullTests(ifStmt.Condition, "=="))
+	defer restore()
+	return tc.checkBlock(ifStmt.Else)
+}
 
-	return nil
+// checkBlock checks a list of statements in a scope of its own.
+func (tc *TypeChecker) checkBlock(body []parser.ASTNode) error {
+	tc.pushScope()
+	defer tc.popScope()
+
+	return tc.checkStatements(body)
 }
 
 func (tc *TypeChecker) checkFor(forStmt *parser.ForStmt) error {
@@ -170,163 +574,1649 @@ func (tc *TypeChecker) checkFor(forStmt *parser.ForStmt) error {
 	}
 
 	if forStmt.Condition != nil {
-		_, err := tc. inferExprType(forStmt.Condition)
+		condType, err := tc. inferExprType(forStmt.Condition)
 		if err != nil {
 			return err
 		}
+		if condType != "bool" && condType != "interface{}" {
+			return errorf(forStmt.Condition, "non-boolean condition in for statement: %s", condType)
+		}
 	}
 
-	for _, stmt := range forStmt.Body {
-		if err := tc.checkStatement(stmt); err != nil {
+	if forStmt.Post != nil {
+		if _, ok := forStmt.Post.(*parser.ShortAssignStmt); ok {
+			return errorf(forStmt.Post, "cannot declare in post statement of for loop")
+		}
+		if err := tc.checkStatement(forStmt.Post); err != nil {
 			return err
 		}
 	}
 
-	return nil
+	return tc.checkLoopBody(forStmt.Body)
 }
 
-func (tc *TypeChecker) checkAssign(assign *parser.AssignStmt) error {
-	varType := tc.lookupVar(assign.Name)
-	if varType == "" {
-		return fmt.Errorf("undefined variable: %s", assign.Name)
-	}
+func (tc *TypeChecker) checkForRange(loop *parser.ForRangeStmt) error {
+	tc.pushScope()
+	defer tc.popScope()
 
-	exprType, err := tc.inferExprType(assign.Value)
+	exprType, err := tc.inferExprType(loop.Expr)
 	if err != nil {
 		return err
 	}
-
-	if ! tc.isCompatible(varType, exprType) {
-		return fmt.Errorf("cannot assign %s to %s", exprType, varType)
+	keyType, valueType, err := rangeTypes(loop.Expr, tc.underlying(exprType))
+	if err != nil {
+		return err
+	}
+	if loop.Value != "" && valueType == "" {
+		return errorf(loop, "range over %s permits only one iteration variable", exprType)
 	}
 
-	return nil
-}
-
-func (tc *TypeChecker) inferExprType(expr interface{}) (string, error) {
-	switch e := expr.(type) {
-	case *parser.LiteralInt:
-		return "int", nil
-	case *parser.LiteralFloat:
-		return "float64", nil
-	case *parser. LiteralString:
-		return "string", nil
-	case *parser.LiteralBool:
-		return "bool", nil
-	case *parser.LiteralNull:
-		return "nil", nil
-	case *parser. Identifier:
-		varType := tc.lookupVar(e.Name)
-		if varType == "" {
-			return "", fmt.Errorf("undefined variable: %s", e.Name)
+	vars := []struct{ name, typ string }{{loop.Key, keyType}, {loop.Value, valueType}}
+	for _, v := range vars {
+		if v.name == "" || v.name == "_" {
+			continue
 		}
-		return varType, nil
-	case *parser. BinaryOp:
-		return tc.inferBinaryOpType(e)
-	case *parser.UnaryOp:
-		return tc.inferUnaryOpType(e)
-	case *parser.CallExpr:
-		return "interface{}", nil
-	case *parser. IndexExpr:
-		return "interface{}", nil
-	case *parser.NullCheckExpr:
-		exprType, err := tc.inferExprType(e.Expr)
-		if err != nil {
-			return "", err
+		if loop.Define {
+			tc.defineVar(v.name, v.typ)
+			continue
 		}
-		if ! tc.nullableVars[exprType] {
-			return "", fmt.Errorf("cannot use null coalescing on non-nullable type: %s", exprType)
+		varType := tc.lookupVar(v.name)
+		if varType == "" {
+			return errorf(loop, "undefined variable: %s", v.name)
 		}
-		return exprType, nil
-	case *parser.NullableExpr:
-		return tc.inferExprType(e.Expr)
-	case *parser.ArrayLiteral:
-		if e.Type != "" {
-			return "[]" + e.Type, nil
+		if !tc.isCompatible(varType, v.typ) {
+			return errorf(loop, "cannot assign %s to %s in range", v.typ, varType)
 		}
-		return "[]interface{}", nil
-	case *parser.MapLiteral:
-		return "map[string]interface{}", nil
-	default:
-		return "interface{}", nil
 	}
+
+	return tc.checkLoopBody(loop.Body)
 }
 
-func (tc *TypeChecker) inferBinaryOpType(expr *parser.BinaryOp) (string, error) {
-	leftType, err := tc.inferExprType(expr.Left)
-	if err != nil {
-		return "", err
-	}
+// checkLoopBody checks a loop body in its own scope, where break and
+// continue are allowed.
+func (tc *TypeChecker) checkLoopBody(body []parser.ASTNode) error {
+	tc.loopDepth++
+	tc.breakDepth++
+	defer func() {
+		tc.loopDepth--
+		tc.breakDepth--
+	}()
 
-	rightType, err := tc.inferExprType(expr.Right)
-	if err != nil {
-		return "", err
-	}
+	return tc.checkBlock(body)
+}
 
-	if expr.Op == "+" || expr.Op == "-" || expr.Op == "*" || expr. Op == "/" {
-		if leftType != rightType {
-			return "", fmt. Errorf("type mismatch in binary operation: %s %s %s", leftType, expr.Op, rightType)
+func (tc *TypeChecker) checkBranch(stmt *parser.BranchStmt) error {
+	switch stmt.Tok {
+	case "break":
+		if tc.breakDepth == 0 {
+			return errorf(stmt, "break is not in a loop, switch, or select")
 		}
-		return leftType, nil
+	case "continue":
+		if tc.loopDepth == 0 {
+			return errorf(stmt, "continue is not in a loop")
+		}
+	case "fallthrough":
+		// A valid fallthrough is consumed by checkCaseBody.
+		return errorf(stmt, "fallthrough statement out of place")
 	}
+	// Labels are checked by checkLabels.
+	return nil
+}
 
-	if expr.Op == "==" || expr.Op == "! =" || expr.Op == "<" || expr.Op == "<=" || expr. Op == ">" || expr.Op == ">=" {
-		return "bool", nil
-	}
+func (tc *TypeChecker) checkSwitch(sw *parser.SwitchStmt) error {
+	tc.pushScope()
+	defer tc.popScope()
 
-	if expr.Op == "&&" || expr.Op == "||" {
-		if leftType != "bool" || rightType != "bool" {
-			return "", fmt.Errorf("logical operator requires bool operands")
+	if sw.Init != nil {
+		if err := tc.checkStatement(sw.Init); err != nil {
+			return err
 		}
-		return "bool", nil
 	}
 
-	return "interface{}", nil
-}
+	tagType := "bool"
+	if sw.Tag != nil {
+		var err error
+		if tagType, err = tc.inferExprType(sw.Tag); err != nil {
+			return err
+		}
+	}
+	if err := checkDefaults(sw.Body); err != nil {
+		return err
+	}
 
-func (tc *TypeChecker) inferUnaryOpType(expr *parser.UnaryOp) (string, error) {
-	operandType, err := tc.inferExprType(expr.Right)
-	if err != nil {
-		return "", err
+	// A switch on a variable with a null case narrows the variable to
+	// non-null in every other clause.
+	tagVar, _ := sw.Tag.(*parser.Identifier)
+	hasNull := hasNullCase(sw.Body)
+	if hasNull {
+		delete(tc.info.Deref, sw.Tag)
 	}
 
-	if expr.Op == "!" {
-		if operandType != "bool" {
-			return "", fmt.Errorf("logical not requires bool operand")
+	for i, clause := range sw.Body {
+		isNull := false
+		for _, item := range clause.List {
+			if _, ok := item.(*parser.LiteralNull); ok {
+				if sw.Tag == nil || !tc.isNullable(sw.Tag, tagType) {
+					return errorf(item, "invalid case null in switch on non-nullable %s", tagType)
+				}
+				isNull = true
+				continue
+			}
+			itemType, err := tc.inferExprType(item)
+			if err != nil {
+				return err
+			}
+			if sw.Tag == nil {
+				if itemType != "bool" && itemType != "interface{}" {
+					return errorf(item, "invalid case in switch (mismatched types %s and bool)", itemType)
+				}
+				continue
+			}
+			if !tc.isCompatible(tagType, itemType) && !tc.isCompatible(itemType, tagType) && !isUntypedNumeric(item, tagType) {
+				return errorf(item, "invalid case in switch on %s (mismatched types %s and %s)", tagType, itemType, tagType)
+			}
 		}
-		return "bool", nil
-	}
 
-	if expr.Op == "-" || expr.Op == "+" {
-		if operandType != "int" && operandType != "float64" {
-			return "", fmt.Errorf("unary %s requires numeric operand", expr.Op)
+		restore := func() {}
+		if tagVar != nil && hasNull {
+			restore = tc.narrow(tagVar.Name, isNull)
+		}
+		err := tc.checkCaseBody(clause, i == len(sw.Body)-1, true)
+		restore()
+		if err != nil {
+			return err
 		}
-		return operandType, nil
 	}
-
+	return nil
+}
+
+// checkTypeSwitch checks a type switch. In a clause listing exactly one
+// type the bound variable has that type, and otherwise the type of the
+// switched expression. A null case narrows like in an expression switch.
+func (tc *TypeChecker) checkTypeSwitch(sw *parser.TypeSwitchStmt) error {
+	tc.pushScope()
+	defer tc.popScope()
+
+	if sw.Init != nil {
+		if err := tc.checkStatement(sw.Init); err != nil {
+			return err
+		}
+	}
+
+	xType, err := tc.inferExprType(sw.X)
+	if err != nil {
+		return err
+	}
+	if xType != "interface{}" && !tc.isInterface(xType) {
+		return errorf(sw.X, "cannot type switch on non-interface type %s", xType)
+	}
+	if err := checkDefaults(sw.Body); err != nil {
+		return err
+	}
+
+	xVar, _ := sw.X.(*parser.Identifier)
+	hasNull := hasNullCase(sw.Body)
+
+	for i, clause := range sw.Body {
+		bound := xType
+		isNull := false
+		for _, item := range clause.List {
+			if _, ok := item.(*parser.LiteralNull); ok {
+				isNull = true
+				continue
+			}
+			typ := typeName(item.(parser.TypeExpr))
+			if tc.isInterface(xType) && !tc.isInterface(typ) {
+				if name, _ := tc.missingMethod(typ, xType); name != "" {
+					return errorf(item, "impossible type switch case: %s cannot have dynamic type %s (missing method %s)", xType, typ, name)
+				}
+			}
+			if len(clause.List) == 1 {
+				bound = typ
+			}
+		}
+
+		tc.pushScope()
+		var restore []func()
+		if sw.Binding != "" {
+			tc.defineVar(sw.Binding, bound)
+			if hasNull {
+				restore = append(restore, tc.narrow(sw.Binding, isNull))
+			}
+		}
+		if xVar != nil && hasNull {
+			restore = append(restore, tc.narrow(xVar.Name, isNull))
+		}
+		err := tc.checkCaseBody(clause, i == len(sw.Body)-1, false)
+		for _, r := range restore {
+			r()
+		}
+		tc.popScope()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkCaseBody checks the statements of a switch clause, where break is
+// allowed and fallthrough may end any but the last clause.
+func (tc *TypeChecker) checkCaseBody(clause *parser.CaseClause, last, canFallthrough bool) error {
+	tc.pushScope()
+	defer tc.popScope()
+	tc.breakDepth++
+	defer func() { tc.breakDepth-- }()
+
+	body := clause.Body
+	if n := len(body); n > 0 {
+		if b, ok := body[n-1].(*parser.BranchStmt); ok && b.Tok == "fallthrough" {
+			if !canFallthrough {
+				return errorf(b, "cannot fallthrough in type switch")
+			}
+			if last {
+				return errorf(b, "cannot fallthrough final case in switch")
+			}
+			body = body[:n-1]
+		}
+	}
+
+	return tc.checkStatements(body)
+}
+
+// narrow overrides the nullability of the variable name until the
+// returned function is called.
+func (tc *TypeChecker) narrow(name string, nullable bool) (restore func()) {
+	prev, had := tc.narrowed[name]
+	tc.narrowed[name] = nullable
+	return func() {
+		if had {
+			tc.narrowed[name] = prev
+		} else {
+			delete(tc.narrowed, name)
+		}
+	}
+}
+
+// narrowAll narrows the variables names to non-null until the returned
+// function is called.
+func (tc *TypeChecker) narrowAll(names []string) (restore func()) {
+	restores := make([]func(), len(names))
+	for i, name := range names {
+		restores[i] = tc.narrow(name, false)
+	}
+	return func() {
+		for i := len(restores) - 1; i >= 0; i-- {
+			restores[i]()
+		}
+	}
+}
+
+// nullTests returns the variables that cond, when true, shows to be
+// non-null if op is "!=", or when false if op is "==": those compared
+// with null by op, joined by && or || respectively.
+func nullTests(cond parser.ASTNode, op string) []string {
+	bin, ok := cond.(*parser.BinaryOp)
+	if !ok {
+		return nil
+	}
+	join := "&&"
+	if op == "==" {
+		join = "||"
+	}
+	switch bin.Op {
+	case join:
+		return append(nullTests(bin.Left, op), nullTests(bin.Right, op)...)
+	case op:
+		if _, ok := bin.Right.(*parser.LiteralNull); ok {
+			if ident, ok := bin.Left.(*parser.Identifier); ok {
+				return []string{ident.Name}
+			}
+		}
+		if _, ok := bin.Left.(*parser.LiteralNull); ok {
+			if ident, ok := bin.Right.(*parser.Identifier); ok {
+				return []string{ident.Name}
+			}
+		}
+	}
+	return nil
+}
+
+// terminates reports whether a block ends with a statement that leaves
+// it: a return, panic, break, continue or goto.
+func terminates(body []parser.ASTNode) bool {
+	if len(body) == 0 {
+		return false
+	}
+	switch s := body[len(body)-1].(type) {
+	case *parser.ReturnStmt, *parser.PanicStmt:
+		return true
+	case *parser.BranchStmt:
+		return s.Tok != "fallthrough"
+	}
+	return false
+}
+
+func checkDefaults(clauses []*parser.CaseClause) error {
+	seen := false
+	for _, clause := range clauses {
+		if clause.List != nil {
+			continue
+		}
+		if seen {
+			return errorf(clause, "multiple defaults in switch")
+		}
+		seen = true
+	}
+	return nil
+}
+
+func hasNullCase(clauses []*parser.CaseClause) bool {
+	for _, clause := range clauses {
+		for _, item := range clause.List {
+			if _, ok := item.(*parser.LiteralNull); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// rangeTypes returns the types of the iteration variables when ranging
+// over a value of type typ; valueType is "" if only a key is produced.
+func rangeTypes(expr parser.ASTNode, typ string) (keyType, valueType string, err error) {
+	switch {
+	case typ == "interface{}":
+		return typ, typ, nil
+	case typ == "string":
+		return "int", "rune", nil
+	case isIntegerType(typ):
+		return typ, "", nil
+	case strings.HasPrefix(typ, "[]"):
+		return "int", typ[2:], nil
+	case strings.HasPrefix(typ, "["):
+		if i := strings.Index(typ, "]"); i > 0 {
+			return "int", typ[i+1:], nil
+		}
+	case strings.HasPrefix(typ, "map["):
+		if key, value, ok := splitMapType(typ); ok {
+			return key, value, nil
+		}
+	}
+	if elem, dir := chanElem(typ); dir != "" {
+		if dir == "chan<-" {
+			return "", "", errorf(expr, "cannot range over send-only channel %s", typ)
+		}
+		return elem, "", nil
+	}
+	return "", "", errorf(expr, "cannot range over %s", typ)
+}
+
+// splitMapType splits "map[K]V" into K and V.
+func splitMapType(typ string) (key, value string, ok bool) {
+	depth := 0
+	for i := len("map"); i < len(typ); i++ {
+		switch typ[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				return typ[len("map["):i], typ[i+1:], true
+			}
+		}
+	}
+	return "", "", false
+}
+
+func (tc *TypeChecker) checkAssign(assign *parser.AssignStmt) error {
+	if assign.Op != "" && assign.Op != "=" {
+		if len(assign.Lhs) != 1 || len(assign.Rhs) != 1 {
+			return errorf(assign, "assignment operation %s requires single-valued expressions", assign.Op)
+		}
+		varType, err := tc.lhsType(assign.Lhs[0])
+		if err != nil {
+			return err
+		}
+		if tc.declaredNullable(assign.Lhs[0]) {
+			return errorf(assign, "invalid operation %s on nullable type ?%s", assign.Op, varType)
+		}
+		exprType, err := tc.inferExprType(assign.Rhs[0])
+		if err != nil {
+			return err
+		}
+		op := strings.TrimSuffix(assign.Op, "=")
+		if _, ok := tc.typeParams[varType]; ok {
+			return tc.checkTypeParamOperands(assign, op, varType, exprType, assign.Rhs[0])
+		}
+		return tc.checkOperands(assign, op, varType, exprType, assign.Rhs[0])
+	}
+
+	valueTypes, err := tc.inferValueTypes(assign, assign.Rhs, len(assign.Lhs))
+	if err != nil {
+		return err
+	}
+
+	for i, x := range assign.Lhs {
+		if isBlank(x) {
+			continue
+		}
+		varType, err := tc.lhsType(x)
+		if err != nil {
+			return err
+		}
+		target := varType
+		if tc.declaredNullable(x) {
+			target = "?" + varType
+		}
+		if err := tc.checkAssignable(assign, assign.Rhs, i, target, valueTypes[i]); err != nil {
+			return err
+		}
+		if tc.declaredNullable(x) {
+			delete(tc.info.Deref, x)
+			single := len(assign.Rhs) == len(assign.Lhs)
+			if single {
+				tc.storeNullable(assign.Rhs[i], varType)
+			}
+			// A variable narrowed to non-null may be null again.
+			if ident, ok := x.(*parser.Identifier); ok {
+				if _, narrowed := tc.narrowed[ident.Name]; narrowed {
+					tc.narrowed[ident.Name] = !single || tc.isNullable(assign.Rhs[i], valueTypes[i])
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (tc *TypeChecker) checkShortAssign(assign *parser.ShortAssignStmt) error {
+	valueTypes, err := tc.inferValueTypes(assign, assign.Rhs, len(assign.Lhs))
+	if err != nil {
+		return err
+	}
+
+	// At least one variable must be new; the others are assigned to.
+	scope := tc.scopes[len(tc.scopes)-1]
+	seen := make(map[string]bool)
+	isNew := false
+	for i, ident := range assign.Lhs {
+		if ident.Name == "_" {
+			continue
+		}
+		if seen[ident.Name] {
+			return errorf(ident, "%s repeated on left side of :=", ident.Name)
+		}
+		seen[ident.Name] = true
+
+		single := len(assign.Rhs) == len(assign.Lhs)
+		if varType, ok := scope[ident.Name]; ok {
+			elem := strings.TrimPrefix(varType, "?")
+			if err := tc.checkAssignable(assign, assign.Rhs, i, varType, valueTypes[i]); err != nil {
+				return err
+			}
+			if elem != varType && single {
+				tc.storeNullable(assign.Rhs[i], elem)
+			}
+			continue
+		}
+		isNew = true
+
+		// A variable takes the nullability of the value it is declared
+		// with, unless a switch has narrowed it to non-null.
+		if single && tc.declaredNullable(assign.Rhs[i]) && tc.isNullable(assign.Rhs[i], valueTypes[i]) {
+			delete(tc.info.Deref, assign.Rhs[i])
+			tc.defineVar(ident.Name, "?"+valueTypes[i])
+			continue
+		}
+		tc.defineVar(ident.Name, valueTypes[i])
+	}
+	if !isNew {
+		return errorf(assign, "no new variables on left side of :=")
+	}
+	return nil
+}
+
+// inferValueTypes types the right-hand side of an assignment to n
+// variables: either n single values, one call returning n results, or a
+// comma-ok form (map index, type assertion or receive) for two variables.
+func (tc *TypeChecker) inferValueTypes(assign parser.ASTNode, rhs []parser.ASTNode, n int) ([]string, error) {
+	if len(rhs) == n {
+		types := make([]string, n)
+		for i, expr := range rhs {
+			typ, err := tc.inferExprType(expr)
+			if err != nil {
+				return nil, err
+			}
+			types[i] = typ
+		}
+		return types, nil
+	}
+
+	if len(rhs) == 1 {
+		switch expr := rhs[0].(type) {
+		case *parser.CallExpr:
+			results, known, err := tc.checkCall(expr)
+			if err != nil {
+				return nil, err
+			}
+			if !known {
+				types := make([]string, n)
+				for i := range types {
+					types[i] = "interface{}"
+				}
+				return types, nil
+			}
+			if len(results) != n {
+				return nil, errorf(assign, "assignment mismatch: %s but %s returns %s", count(n, "variable"), callName(expr), count(len(results), "value"))
+			}
+			types := make([]string, n)
+			for i, result := range results {
+				types[i] = valueType(result)
+			}
+			return types, nil
+		}
+
+		ok, err := tc.isCommaOk(rhs[0])
+		if err != nil {
+			return nil, err
+		}
+		if ok && n == 2 {
+			typ, err := tc.inferExprType(rhs[0])
+			if err != nil {
+				return nil, err
+			}
+			return []string{typ, "bool"}, nil
+		}
+	}
+
+	return nil, errorf(assign, "assignment mismatch: %s but %s", count(n, "variable"), count(len(rhs), "value"))
+}
+
+// count formats n and noun, pluralising the noun as needed.
+func count(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// isCommaOk reports whether expr may yield a second, boolean result.
+func (tc *TypeChecker) isCommaOk(expr parser.ASTNode) (bool, error) {
+	switch e := expr.(type) {
+	case *parser.IndexExpr:
+		xType, err := tc.inferExprType(e.Expr)
+		if err != nil {
+			return false, err
+		}
+		return strings.HasPrefix(xType, "map[") || xType == "interface{}", nil
+	case *parser.TypeAssertExpr:
+		return e.Type != nil, nil
+	case *parser.ChanOp:
+		return e.Value == nil, nil
+	}
+	return false, nil
+}
+
+// checkAssignable checks the i'th value assigned by assign to a variable
+// of type varType, which is ?T if it is nullable. Untyped constants are
+// only recognised when values are listed one by one.
+func (tc *TypeChecker) checkAssignable(assign parser.ASTNode, rhs []parser.ASTNode, i int, varType, valueType string) error {
+	node := assign
+	if len(rhs) > i {
+		node = rhs[i]
+		if elem := strings.TrimPrefix(varType, "?"); isUntypedNumeric(node, elem) {
+			return tc.checkConstantFits(node, elem)
+		}
+	}
+	if !tc.isCompatible(varType, valueType) {
+		return errorf(node, "cannot assign %s to %s%s", valueType, varType, tc.implementsDetail(varType, valueType))
+	}
+	return nil
+}
+
+// lhsType returns the type of an assignable expression.
+func (tc *TypeChecker) lhsType(x parser.ASTNode) (string, error) {
+	switch e := x.(type) {
+	case *parser.Identifier:
+		varType := tc.lookupVar(e.Name)
+		if varType == "" {
+			return "", errorf(e, "undefined variable: %s", e.Name)
+		}
+		return varType, nil
+	case *parser.IndexExpr:
+		return tc.inferExprType(e)
+	case *parser.SelectorExpr:
+		return tc.inferExprType(e)
+	case *parser.UnaryOp:
+		if e.Op == "*" {
+			return tc.inferExprType(e)
+		}
+	}
+	return "", errorf(x, "cannot assign to %s", describe(x))
+}
+
+// inferIndexType types x[i] from the type of x, which like slicing and
+// range resolves a named type to its underlying type.
+func (tc *TypeChecker) inferIndexType(index *parser.IndexExpr) (string, error) {
+	xType, err := tc.inferExprType(index.Expr)
+	if err != nil {
+		return "", err
+	}
+	if _, err := tc.inferExprType(index.Index); err != nil {
+		return "", err
+	}
+
+	underlying := tc.underlying(xType)
+	switch {
+	case underlying == "string":
+		return "byte", nil
+	case strings.HasPrefix(underlying, "map["):
+		if _, value, ok := splitMapType(underlying); ok {
+			return value, nil
+		}
+	case strings.HasPrefix(underlying, "["), strings.HasPrefix(underlying, "*["):
+		array := strings.TrimPrefix(underlying, "*")
+		if i := strings.Index(array, "]"); i > 0 {
+			return array[i+1:], nil
+		}
+	}
+	return "interface{}", nil
+}
+
+// inferSliceType types x[low:high:max]. Slicing a string or slice gives a
+// value of the same type and slicing an array, or a pointer to one, gives
+// a slice of its elements. Named types are sliced by their underlying
+// type.
+func (tc *TypeChecker) inferSliceType(slice *parser.SliceExpr) (string, error) {
+	xType, err := tc.inferExprType(slice.Expr)
+	if err != nil {
+		return "", err
+	}
+
+	result, length := xType, int64(-1)
+	switch underlying := tc.underlying(xType); {
+	case underlying == "interface{}":
+	case underlying == "string":
+		if slice.Slice3 {
+			return "", errorf(slice, "invalid operation: 3-index slice of string")
+		}
+	case strings.HasPrefix(underlying, "[]"):
+	case strings.HasPrefix(underlying, "["), strings.HasPrefix(underlying, "*["):
+		if !strings.HasPrefix(underlying, "*") && !isAddressable(slice.Expr) {
+			return "", errorf(slice, "cannot slice unaddressable value of type %s", xType)
+		}
+		array := strings.TrimPrefix(underlying, "*")
+		i := strings.Index(array, "]")
+		result = "[]" + array[i+1:]
+		if n, err := strconv.ParseInt(array[1:i], 10, 64); err == nil {
+			length = n
+		} else if c, ok := tc.consts[array[1:i]]; ok {
+			length, _ = constant.Int64Val(constant.ToInt(c))
+		}
+	default:
+		return "", errorf(slice.Expr, "cannot slice value of type %s", xType)
+	}
+
+	var prev int64 = -1
+	for _, index := range []parser.ASTNode{slice.Low, slice.High, slice.Max} {
+		if index == nil {
+			continue
+		}
+		indexType, err := tc.inferExprType(index)
+		if err != nil {
+			return "", err
+		}
+		c, isConst := constValue(index)
+		if !isConst {
+			if !isIntegerType(indexType) && indexType != "interface{}" {
+				return "", errorf(index, "invalid slice index of type %s", indexType)
+			}
+			continue
+		}
+		n, exact := constant.Int64Val(constant.ToInt(c))
+		switch {
+		case !exact:
+			return "", errorf(index, "slice index %s must be integer", c)
+		case n < 0:
+			return "", errorf(index, "invalid slice index %d (index must be non-negative)", n)
+		case length >= 0 && n > length:
+			return "", errorf(index, "slice index %d out of bounds [0:%d]", n, length+1)
+		case n < prev:
+			return "", errorf(index, "invalid slice indices: %d < %d", n, prev)
+		}
+		prev = n
+	}
+	return result, nil
+}
+
+func isBlank(x parser.ASTNode) bool {
+	ident, ok := x.(*parser.Identifier)
+	return ok && ident.Name == "_"
+}
+
+// describe names the kind of an expression for error messages.
+func describe(x parser.ASTNode) string {
+	switch x.(type) {
+	case *parser.CallExpr:
+		return "function call"
+	case *parser.LiteralInt, *parser.LiteralFloat, *parser.LiteralImag, *parser.LiteralString,
+		*parser.LiteralChar, *parser.LiteralBool, *parser.LiteralNull:
+		return "literal"
+	}
+	return "expression"
+}
+
+func (tc *TypeChecker) checkIncDec(stmt *parser.IncDecStmt) error {
+	xType, err := tc.inferExprType(stmt.X)
+	if err != nil {
+		return err
+	}
+	if tc.declaredNullable(stmt.X) {
+		return errorf(stmt, "invalid operation %s on nullable type ?%s", stmt.Op, xType)
+	}
+	if xType != "interface{}" && !isNumericType(xType) {
+		return errorf(stmt, "invalid operation %s on non-numeric type %s", stmt.Op, xType)
+	}
+	return nil
+}
+
+// checkSelect checks each case of a select. The variables a case
+// declares from a receive are scoped to that case.
+func (tc *TypeChecker) checkSelect(sel *parser.SelectStmt) error {
+	seen := false
+	for _, c := range sel.Cases {
+		if c.Comm != nil {
+			continue
+		}
+		if seen {
+			return errorf(c, "multiple defaults in select")
+		}
+		seen = true
+	}
+
+	for _, c := range sel.Cases {
+		if err := tc.checkSelectCase(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tc *TypeChecker) checkSelectCase(c *parser.SelectCase) error {
+	tc.pushScope()
+	defer tc.popScope()
+	tc.breakDepth++
+	defer func() { tc.breakDepth-- }()
+
+	if c.Comm != nil {
+		if err := tc.checkStatement(c.Comm); err != nil {
+			return err
+		}
+	}
+	for _, stmt := range c.Body {
+		if err := tc.checkStatement(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tc *TypeChecker) checkSend(send *parser.ChanOp) error {
+	chanType, err := tc.inferExprType(send.Expr)
+	if err != nil {
+		return err
+	}
+	valueType, err := tc.inferExprType(send.Value)
+	if err != nil {
+		return err
+	}
+	if chanType == "interface{}" {
+		return nil
+	}
+
+	elem, dir := chanElem(chanType)
+	if elem == "" {
+		return errorf(send, "cannot send to non-channel type %s", chanType)
+	}
+	if dir == "<-chan" {
+		return errorf(send, "cannot send to receive-only channel type %s", chanType)
+	}
+	if !tc.isCompatible(elem, valueType) && !isUntypedNumeric(send.Value, elem) {
+		return errorf(send.Value, "cannot send %s on %s", valueType, chanType)
+	}
+	return nil
+}
+
+func (tc *TypeChecker) inferRecvType(recv *parser.ChanOp) (string, error) {
+	chanType, err := tc.inferExprType(recv.Expr)
+	if err != nil {
+		return "", err
+	}
+	if chanType == "interface{}" {
+		return chanType, nil
+	}
+
+	elem, dir := chanElem(chanType)
+	if elem == "" {
+		return "", errorf(recv, "cannot receive from non-channel type %s", chanType)
+	}
+	if dir == "chan<-" {
+		return "", errorf(recv, "cannot receive from send-only channel type %s", chanType)
+	}
+	return elem, nil
+}
+
+// checkBuiltin checks a call of a builtin whose result depends on its
+// arguments; known is false for other callees.
+func (tc *TypeChecker) checkBuiltin(call *parser.CallExpr, name string) (results []parser.TypeExpr, known bool, err error) {
+	switch name {
+	case "make":
+		return tc.checkMake(call)
+	case "append":
+		return tc.checkAppend(call)
+	case "new":
+		if len(call.Args) != 1 {
+			return nil, false, errorf(call, "wrong number of arguments to new: expected 1, found %d", len(call.Args))
+		}
+		typ, ok := call.Args[0].(parser.TypeExpr)
+		if !ok {
+			return nil, false, errorf(call.Args[0], "new expects a type")
+		}
+		return []parser.TypeExpr{&parser.PointerType{Span: call.Span, Elem: typ}}, true, nil
+	case "close":
+		if len(call.Args) != 1 {
+			return nil, false, errorf(call, "wrong number of arguments to close: expected 1, found %d", len(call.Args))
+		}
+		chanType, err := tc.inferExprType(call.Args[0])
+		if err != nil {
+			return nil, false, err
+		}
+		if chanType == "interface{}" {
+			return []parser.TypeExpr{}, true, nil
+		}
+		elem, dir := chanElem(chanType)
+		if elem == "" {
+			return nil, false, errorf(call.Args[0], "cannot close non-channel type %s", chanType)
+		}
+		if dir == "<-chan" {
+			return nil, false, errorf(call.Args[0], "cannot close receive-only channel type %s", chanType)
+		}
+		return []parser.TypeExpr{}, true, nil
+	}
+
+	if !builtins[name] && !tc.isTypeName(name) {
+		return nil, false, errorf(call.Fun, "undefined: %s", name)
+	}
+
+	// Other builtins and conversions are not typed: only their arguments
+	// are checked.
+	for _, arg := range call.Args {
+		if _, err := tc.inferExprType(arg); err != nil {
+			return nil, false, err
+		}
+	}
+	return nil, false, nil
+}
+
+// builtins are the names of Go's builtin functions.
+var builtins = map[string]bool{
+	"append": true, "cap": true, "clear": true, "close": true, "complex": true, "copy": true,
+	"delete": true, "imag": true, "len": true, "make": true, "max": true, "min": true,
+	"new": true, "panic": true, "print": true, "println": true, "real": true, "recover": true,
+}
+
+// isTypeName reports whether name denotes a type, which may be called to
+// convert a value to it.
+func (tc *TypeChecker) isTypeName(name string) bool {
+	if isNumericType(name) || tc.isInterface(name) || tc.structs[name] != nil {
+		return true
+	}
+	switch name {
+	case "bool", "string", "any":
+		return true
+	}
+	_, ok := tc.typeParams[name]
+	return ok
+}
+
+// underlying returns the type a named type is declared with, or typ
+// itself.
+func (tc *TypeChecker) underlying(typ string) string {
+	if u := tc.lookupVar(typ); u != "" {
+		return u
+	}
+	return typ
+}
+
+// checkAppend checks append(s, x...), whose result has the type of s and
+// whose other arguments must be elements of s, or a slice of them when
+// spread with "...".
+func (tc *TypeChecker) checkAppend(call *parser.CallExpr) ([]parser.TypeExpr, bool, error) {
+	if len(call.Args) == 0 {
+		return nil, false, errorf(call, "not enough arguments in call to append")
+	}
+	sliceType, err := tc.inferExprType(call.Args[0])
+	if err != nil {
+		return nil, false, err
+	}
+	args := call.Args[1:]
+	if sliceType == "interface{}" || sliceType == "nil" {
+		for _, arg := range args {
+			if _, err := tc.inferExprType(arg); err != nil {
+				return nil, false, err
+			}
+		}
+		return nil, false, nil
+	}
+	underlying := tc.underlying(sliceType)
+	if !strings.HasPrefix(underlying, "[]") {
+		return nil, false, errorf(call.Args[0], "first argument to append must be a slice, got %s", sliceType)
+	}
+	elem := underlying[2:]
+
+	if call.Ellipsis {
+		if len(args) != 1 {
+			return nil, false, errorf(call, "can only use ... with final argument in call to append")
+		}
+		argType, err := tc.inferExprType(args[0])
+		if err != nil {
+			return nil, false, err
+		}
+		if !tc.isCompatible(underlying, tc.underlying(argType)) && !(elem == "byte" && argType == "string") {
+			return nil, false, errorf(args[0], "cannot use %s as %s value in argument to append", argType, underlying)
+		}
+	} else {
+		for _, arg := range args {
+			argType, err := tc.inferExprType(arg)
+			if err != nil {
+				return nil, false, err
+			}
+			if _, ok := constValue(arg); ok && isNumericType(elem) {
+				if err := tc.checkConstantFits(arg, elem); err != nil {
+					return nil, false, err
+				}
+				continue
+			}
+			if !tc.isCompatible(elem, argType) {
+				return nil, false, errorf(arg, "cannot use %s as %s value in argument to append%s", argType, elem, tc.implementsDetail(elem, argType))
+			}
+		}
+	}
+	return []parser.TypeExpr{&parser.IdentType{Span: call.Span, Name: sliceType}}, true, nil
+}
+
+// checkMake checks make(T, size...). A slice needs a length and may have
+// a capacity; a map or channel may have a size.
+func (tc *TypeChecker) checkMake(call *parser.CallExpr) ([]parser.TypeExpr, bool, error) {
+	if len(call.Args) == 0 {
+		return nil, false, errorf(call, "not enough arguments in call to make")
+	}
+	typ, ok := call.Args[0].(parser.TypeExpr)
+	if !ok {
+		return nil, false, errorf(call.Args[0], "make expects a type")
+	}
+	name := typeName(typ)
+	underlying := tc.underlying(name)
+
+	min := 1
+	switch elem, _ := chanElem(underlying); {
+	case strings.HasPrefix(underlying, "[]"):
+		min = 2
+	case strings.HasPrefix(underlying, "map["), elem != "":
+	default:
+		return nil, false, errorf(typ, "cannot make %s; type must be slice, map, or channel", name)
+	}
+	if n := len(call.Args); n < min || n > min+1 {
+		return nil, false, errorf(call, "make(%s) expects %d or %d arguments; found %d", name, min, min+1, n)
+	}
+
+	var sizes []int64
+	for _, arg := range call.Args[1:] {
+		argType, err := tc.inferExprType(arg)
+		if err != nil {
+			return nil, false, err
+		}
+		c, isConst := constValue(arg)
+		if !isConst && !isIntegerType(argType) && argType != "interface{}" {
+			return nil, false, errorf(arg, "cannot use %s as size argument in make(%s)", argType, name)
+		}
+		if !isConst {
+			continue
+		}
+		size, exact := constant.Int64Val(constant.ToInt(c))
+		if !exact {
+			return nil, false, errorf(arg, "size argument %s in make(%s) is not an integer", c, name)
+		}
+		if size < 0 {
+			return nil, false, errorf(arg, "negative size argument in make(%s)", name)
+		}
+		sizes = append(sizes, size)
+	}
+	if len(sizes) == 2 && sizes[0] > sizes[1] {
+		return nil, false, errorf(call.Args[1], "length and capacity swapped in make(%s)", name)
+	}
+	return []parser.TypeExpr{typ}, true, nil
+}
+
+// chanElem splits a channel type into its element type and direction
+// ("chan", "<-chan" or "chan<-"); elem is empty for other types.
+func chanElem(typ string) (elem, dir string) {
+	for _, prefix := range []string{"<-chan", "chan<-", "chan"} {
+		if strings.HasPrefix(typ, prefix+" ") {
+			return strings.TrimPrefix(typ, prefix+" "), prefix
+		}
+	}
+	return "", ""
+}
+
+// inferExprType types expr, recording its type for the code generator,
+// and whether it is a nullable value represented by a pointer, which is
+// dereferenced unless the context expects a nullable value.
+func (tc *TypeChecker) inferExprType(expr interface{}) (string, error) {
+	typ, err := tc.inferType(expr)
+	if err != nil {
+		return "", err
+	}
+	if node, ok := expr.(parser.ASTNode); ok {
+		tc.info.Types[node] = typ
+		if tc.declaredNullable(node) && tc.info.PointerNullable(typ) {
+			tc.info.Pointers[node] = true
+			tc.info.Deref[node] = true
+			if tc.isNullable(node, typ) {
+				tc.derefs = append(tc.derefs, node)
+			}
+		}
+	}
+	return typ, nil
+}
+
+func (tc *TypeChecker) inferType(expr interface{}) (string, error) {
+	switch e := expr.(type) {
+	case *parser.LiteralInt:
+		return "int", nil
+	case *parser.LiteralFloat:
+		return "float64", nil
+	case *parser.LiteralImag:
+		return "complex128", nil
+	case *parser. LiteralString:
+		return "string", nil
+	case *parser.LiteralChar:
+		return "rune", nil
+	case *parser.LiteralBool:
+		return "bool", nil
+	case *parser.LiteralNull:
+		return "nil", nil
+	case *parser. Identifier:
+		if e.Name == "iota" && tc.iota >= 0 {
+			return "int", nil
+		}
+		varType := tc.lookupVar(e.Name)
+		if varType != "" {
+			return varType, nil
+		}
+		// A function used as a value has its signature as its type.
+		if fn, ok := tc.funcs[e.Name]; ok {
+			if len(fn.TypeParams) > 0 {
+				return "", errorf(e, "cannot use generic function %s without instantiation", e.Name)
+			}
+			return (&parser.FuncType{Params: fn.Params, Results: fn.Returns}).String(), nil
+		}
+		return "", errorf(e, "undefined variable: %s", e.Name)
+	case *parser. BinaryOp:
+		return tc.inferBinaryOpType(e)
+	case *parser.UnaryOp:
+		return tc.inferUnaryOpType(e)
+	case *parser.CallExpr:
+		return tc.inferCallType(e)
+	case *parser.SelectorExpr:
+		return tc.inferSelectorType(e)
+	case *parser.ChanOp:
+		return tc.inferRecvType(e)
+	case *parser. IndexExpr:
+		if fn, explicit, ok := tc.genericFunc(e); ok {
+			return tc.inferInstanceType(e, fn, explicit)
+		}
+		return tc.inferIndexType(e)
+	case *parser.SliceExpr:
+		return tc.inferSliceType(e)
+	case *parser.InstanceExpr:
+		if fn, explicit, ok := tc.genericFunc(e); ok {
+			return tc.inferInstanceType(e, fn, explicit)
+		}
+		return "interface{}", nil
+	case *parser.NullCheckExpr:
+		exprType, err := tc.inferExprType(e.Expr)
+		if err != nil {
+			return "", err
+		}
+		if !tc.isNullable(e.Expr, exprType) {
+			return "", errorf(e, "cannot use %s on non-nullable type: %s", e.Op, exprType)
+		}
+		delete(tc.info.Deref, e.Expr)
+		defType, err := tc.inferExprType(e.DefaultExpr)
+		if err != nil {
+			return "", err
+		}
+		if !tc.isCompatible(exprType, defType) && !isUntypedNumeric(e.DefaultExpr, exprType) {
+			return "", errorf(e.DefaultExpr, "mismatched types %s and %s in %s", exprType, defType, e.Op)
+		}
+		return exprType, nil
+	case *parser.SafeNavExpr:
+		if _, err := tc.inferExprType(e.Expr); err != nil {
+			return "", err
+		}
+		delete(tc.info.Deref, e.Expr)
+		return "interface{}", nil
+	case *parser.NullableExpr:
+		return tc.inferExprType(e.Expr)
+	case *parser.FuncLit:
+		sig, err := tc.checkFuncLit(e)
+		if err != nil {
+			return "", err
+		}
+		return sig.String(), nil
+	case *parser.TypeAssertExpr:
+		if e.Type == nil {
+			return "", errorf(e, "use of .(type) outside type switch")
+		}
+		xType, err := tc.inferExprType(e.Expr)
+		if err != nil {
+			return "", err
+		}
+		if xType != "interface{}" && !tc.isInterface(xType) {
+			return "", errorf(e.Expr, "invalid operation: %s is not an interface", xType)
+		}
+		return typeName(e.Type), nil
+	case *parser.ArrayLiteral:
+		return tc.checkArrayLiteral(e)
+	case *parser.MapLiteral:
+		return tc.checkMapLiteral(e)
+	case *parser.StructLiteral:
+		return tc.checkStructLiteral(e)
+	default:
+		return "interface{}", nil
+	}
+}
+
+func (tc *TypeChecker) inferBinaryOpType(expr *parser.BinaryOp) (string, error) {
+	leftType, err := tc.inferExprType(expr.Left)
+	if err != nil {
+		return "", err
+	}
+
+	// The right operand of && is only evaluated if the left is true, and
+	// that of || if it is false, which may exclude null.
+	restore := func() {}
+	switch expr.Op {
+	case "&&":
+		restore = tc.narrowAll(nullTests(expr.Left, "!="))
+	case "||":
+		restore = tc.narrowAll(nullTests(expr.Left, "=="))
+	}
+	rightType, err := tc.inferExprType(expr.Right)
+	restore()
+	if err != nil {
+		return "", err
+	}
+
+	if _, ok := tc.typeParams[leftType]; ok && isArithmetic(expr.Op) {
+		if err := tc.checkTypeParamOperands(expr, expr.Op, leftType, rightType, expr.Right); err != nil {
+			return "", err
+		}
+		return leftType, nil
+	}
+
+	switch expr.Op {
+	case "+", "-", "*", "/", "%", "&", "|", "^", "&^":
+		// A numeric literal on the left takes the type of the right
+		// operand, unless the right is one too that it cannot hold, as in
+		// 1 + 2.5.
+		if isUntypedNumeric(expr.Left, tc.underlying(rightType)) && !isUntypedNumeric(expr.Right, leftType) {
+			leftType = rightType
+		}
+		fallthrough
+	case "<<", ">>":
+		if err := tc.checkOperands(expr, expr.Op, leftType, rightType, expr.Right); err != nil {
+			return "", err
+		}
+		return leftType, nil
+	}
+
+	if expr.Op == "==" || expr.Op == "!=" || expr.Op == "<" || expr.Op == "<=" || expr. Op == ">" || expr.Op == ">=" {
+		// A nullable value compared with null is not dereferenced.
+		if _, ok := expr.Right.(*parser.LiteralNull); ok {
+			delete(tc.info.Deref, expr.Left)
+		}
+		if _, ok := expr.Left.(*parser.LiteralNull); ok {
+			delete(tc.info.Deref, expr.Right)
+		}
+		return "bool", nil
+	}
+
+	if expr.Op == "&&" || expr.Op == "||" {
+		if leftType != "bool" || rightType != "bool" {
+			return "", errorf(expr, "logical operator requires bool operands")
+		}
+		return "bool", nil
+	}
+
+	return "interface{}", nil
+}
+
+func (tc *TypeChecker) inferUnaryOpType(expr *parser.UnaryOp) (string, error) {
+	operandType, err := tc.inferExprType(expr.Right)
+	if err != nil {
+		return "", err
+	}
+
+	if expr.Op == "!" {
+		if operandType != "bool" {
+			return "", errorf(expr, "logical not requires bool operand")
+		}
+		return "bool", nil
+	}
+
+	if expr.Op == "-" || expr.Op == "+" {
+		if !isNumericType(operandType) {
+			return "", errorf(expr, "unary %s requires numeric operand", expr.Op)
+		}
+		return operandType, nil
+	}
+
+	if expr.Op == "^" {
+		if !isIntegerType(operandType) {
+			return "", errorf(expr, "unary ^ requires integer operand")
+		}
+		return operandType, nil
+	}
+
+	if expr.Op == "&" {
+		return "*" + operandType, nil
+	}
+
+	if expr.Op == "*" {
+		if operandType == "interface{}" {
+			return operandType, nil
+		}
+		ptr := tc.underlying(operandType)
+		if !strings.HasPrefix(ptr, "*") {
+			return "", errorf(expr, "unary * requires pointer operand, got %s", operandType)
+		}
+		return ptr[1:], nil
+	}
+
 	return operandType, nil
 }
 
+// typeName returns the string form of a type used throughout the checker,
+// or "" if no type was written.
+func typeName(t parser.TypeExpr) string {
+	if t == nil {
+		return ""
+	}
+	return t.String()
+}
+
+// checkConstantFits reports an error when a numeric literal initialiser
+// cannot be represented by the declared type, e.g. 0x100 for a byte.
+func (tc *TypeChecker) checkConstantFits(expr parser.ASTNode, typ string) error {
+	c, ok := tc.constEval(expr)
+	if !ok || !isNumericConst(c) || !isNumericType(typ) {
+		return nil
+	}
+	if !representable(c, typ) {
+		return errorf(expr, "constant %s overflows %s", c.ExactString(), typ)
+	}
+	return nil
+}
+
+// constValue returns the exact value of a numeric or rune literal,
+// optionally preceded by a sign.
+func constValue(expr parser.ASTNode) (constant.Value, bool) {
+	switch e := expr.(type) {
+	case *parser.LiteralInt:
+		return e.Const, e.Const != nil
+	case *parser.LiteralFloat:
+		return e.Const, e.Const != nil
+	case *parser.LiteralImag:
+		return e.Const, e.Const != nil
+	case *parser.LiteralChar:
+		return constant.MakeInt64(int64(e.Value)), true
+	case *parser.UnaryOp:
+		if e.Op != "-" && e.Op != "+" {
+			return nil, false
+		}
+		c, ok := constValue(e.Right)
+		if !ok {
+			return nil, false
+		}
+		if e.Op == "-" {
+			c = constant.UnaryOp(token.SUB, c, 0)
+		}
+		return c, true
+	}
+	return nil, false
+}
+
+var constOps = map[string]token.Token{
+	"+": token.ADD, "-": token.SUB, "*": token.MUL, "/": token.QUO, "%": token.REM,
+	"&": token.AND, "|": token.OR, "^": token.XOR, "&^": token.AND_NOT,
+	"<<": token.SHL, ">>": token.SHR, "&&": token.LAND, "||": token.LOR,
+	"==": token.EQL, "!=": token.NEQ, "<": token.LSS, "<=": token.LEQ, ">": token.GTR, ">=": token.GEQ,
+}
+
+// constEval evaluates a constant expression built from literals, iota and
+// untyped constants. It reports false for anything else, including
+// operations Go would reject, which are left to the type checks.
+func (tc *TypeChecker) constEval(expr parser.ASTNode) (constant.Value, bool) {
+	switch e := expr.(type) {
+	case *parser.LiteralString:
+		return constant.MakeString(e.Value), true
+	case *parser.LiteralBool:
+		return constant.MakeBool(e.Value), true
+	case *parser.Identifier:
+		if e.Name == "iota" && tc.iota >= 0 {
+			return constant.MakeInt64(int64(tc.iota)), true
+		}
+		c, ok := tc.consts[e.Name]
+		return c, ok
+	case *parser.UnaryOp:
+		x, ok := tc.constEval(e.Right)
+		if !ok {
+			return nil, false
+		}
+		switch {
+		case e.Op == "+" || e.Op == "-":
+			if !isNumericConst(x) {
+				return nil, false
+			}
+			return constant.UnaryOp(constOps[e.Op], x, 0), true
+		case e.Op == "^" && x.Kind() == constant.Int:
+			return constant.UnaryOp(token.XOR, x, 0), true
+		case e.Op == "!" && x.Kind() == constant.Bool:
+			return constant.UnaryOp(token.NOT, x, 0), true
+		}
+		return nil, false
+	case *parser.BinaryOp:
+		op, known := constOps[e.Op]
+		x, ok := tc.constEval(e.Left)
+		y, ok2 := tc.constEval(e.Right)
+		if !known || !ok || !ok2 {
+			return nil, false
+		}
+		return evalBinary(op, x, y)
+	}
+	return constValue(expr)
+}
+
+// evalBinary applies op to the constants x and y.
+func evalBinary(op token.Token, x, y constant.Value) (constant.Value, bool) {
+	numeric := isNumericConst(x) && isNumericConst(y)
+	if !numeric && x.Kind() != y.Kind() {
+		return nil, false
+	}
+	switch op {
+	case token.SHL, token.SHR:
+		s, exact := constant.Uint64Val(constant.ToInt(y))
+		if x.Kind() != constant.Int || !exact || s > 1<<10 {
+			return nil, false
+		}
+		return constant.Shift(x, op, uint(s)), true
+	case token.EQL, token.NEQ:
+		return constant.MakeBool(constant.Compare(x, op, y)), true
+	case token.LSS, token.LEQ, token.GTR, token.GEQ:
+		if x.Kind() == constant.Bool || x.Kind() == constant.Complex || y.Kind() == constant.Complex {
+			return nil, false
+		}
+		return constant.MakeBool(constant.Compare(x, op, y)), true
+	case token.REM, token.AND, token.OR, token.XOR, token.AND_NOT:
+		if x.Kind() != constant.Int || y.Kind() != constant.Int {
+			return nil, false
+		}
+	case token.QUO:
+		if !numeric || constant.Sign(y) == 0 {
+			return nil, false
+		}
+		if x.Kind() == constant.Int && y.Kind() == constant.Int {
+			op = token.QUO_ASSIGN // integer division
+		}
+	case token.ADD:
+		if !numeric && x.Kind() != constant.String {
+			return nil, false
+		}
+	case token.SUB, token.MUL:
+		if !numeric {
+			return nil, false
+		}
+	case token.LAND, token.LOR:
+		if x.Kind() != constant.Bool {
+			return nil, false
+		}
+	}
+	if op == token.REM && constant.Sign(y) == 0 {
+		return nil, false
+	}
+	return constant.BinaryOp(x, op, y), true
+}
+
+func isNumericConst(c constant.Value) bool {
+	switch c.Kind() {
+	case constant.Int, constant.Float, constant.Complex:
+		return true
+	}
+	return false
+}
+
+// isUntypedConst reports whether expr, of type exprType, is a numeric
+// constant expression that may be used as a value of the numeric type
+// typ. Its value is checked separately by checkConstantFits.
+func (tc *TypeChecker) isUntypedConst(expr parser.ASTNode, exprType, typ string) bool {
+	_, ok := tc.constEval(expr)
+	return ok && isNumericType(exprType) && isNumericType(typ)
+}
+
+// isUntypedNumeric reports whether expr is a numeric literal that may be
+// used as a value of the numeric type typ, as Go's untyped constants can.
+func isUntypedNumeric(expr parser.ASTNode, typ string) bool {
+	c, ok := constValue(expr)
+	return ok && isNumericType(typ) && representable(c, typ)
+}
+
+var intBits = map[string]uint{
+	"int": 64, "int8": 8, "int16": 16, "int32": 32, "int64": 64, "rune": 32,
+}
+
+var uintBits = map[string]uint{
+	"uint": 64, "uint8": 8, "uint16": 16, "uint32": 32, "uint64": 64, "byte": 8, "uintptr": 64,
+}
+
+// checkOperands checks the operands of a binary arithmetic or bitwise
+// operator, including the operator of a compound assignment. A numeric
+// literal on the right takes the type of the left operand. The operators
+// of a named type are those of its underlying type.
+func (tc *TypeChecker) checkOperands(node parser.ASTNode, op, leftType, rightType string, right parser.ASTNode) error {
+	left := tc.underlying(leftType)
+	if op == "<<" || op == ">>" {
+		if !isIntegerType(left) || !isIntegerType(tc.underlying(rightType)) {
+			return errorf(node, "shift %s requires integer operands, got %s and %s", op, leftType, rightType)
+		}
+		return nil
+	}
+
+	if leftType != rightType && !isUntypedNumeric(right, left) {
+		return errorf(node, "type mismatch in binary operation: %s %s %s", leftType, op, rightType)
+	}
+
+	switch op {
+	case "+":
+		if left != "string" && !isNumericType(left) {
+			return errorf(node, "operator + not defined on %s", leftType)
+		}
+	case "-", "*", "/":
+		if !isNumericType(left) {
+			return errorf(node, "operator %s not defined on %s", op, leftType)
+		}
+	case "%", "&", "|", "^", "&^":
+		if !isIntegerType(left) {
+			return errorf(node, "operator %s requires integer operands, got %s", op, leftType)
+		}
+	}
+	return nil
+}
+
+func isIntegerType(typ string) bool {
+	return intBits[typ] > 0 || uintBits[typ] > 0
+}
+
+func isNumericType(typ string) bool {
+	switch typ {
+	case "float32", "float64", "complex64", "complex128":
+		return true
+	}
+	return isIntegerType(typ)
+}
+
+func representable(c constant.Value, typ string) bool {
+	if bits, ok := intBits[typ]; ok {
+		c = constant.ToInt(c)
+		limit := constant.Shift(constant.MakeInt64(1), token.SHL, bits-1)
+		return c.Kind() == constant.Int &&
+			constant.Compare(c, token.GEQ, constant.UnaryOp(token.SUB, limit, 0)) &&
+			constant.Compare(c, token.LSS, limit)
+	}
+	if bits, ok := uintBits[typ]; ok {
+		c = constant.ToInt(c)
+		limit := constant.Shift(constant.MakeInt64(1), token.SHL, bits)
+		return c.Kind() == constant.Int &&
+			constant.Sign(c) >= 0 &&
+			constant.Compare(c, token.LSS, limit)
+	}
+	switch typ {
+	case "float32":
+		f, _ := constant.Float32Val(constant.ToFloat(c))
+		return constant.ToFloat(c).Kind() == constant.Float && !math.IsInf(float64(f), 0)
+	case "float64":
+		f, _ := constant.Float64Val(constant.ToFloat(c))
+		return constant.ToFloat(c).Kind() == constant.Float && !math.IsInf(f, 0)
+	case "complex64", "complex128":
+		return constant.ToComplex(c).Kind() == constant.Complex
+	}
+	return false
+}
+
 func (tc *TypeChecker) isCompatible(targetType, sourceType string) bool {
+	targetType, sourceType = expandAny(targetType), expandAny(sourceType)
 	if targetType == sourceType {
 		return true
 	}
 	if targetType == "interface{}" {
 		return true
 	}
+	if strings.HasPrefix(targetType, "?") {
+		return sourceType == "nil" || tc.isCompatible(targetType[1:], sourceType)
+	}
 	if sourceType == "nil" {
+		return tc.canBeNil(targetType)
+	}
+	// A bidirectional channel may be used as a send- or receive-only one.
+	if elem, dir := chanElem(sourceType); dir == "chan" && (targetType == "<-chan "+elem || targetType == "chan<- "+elem) {
+		return true
+	}
+	if tc.isInterface(targetType) {
+		name, _ := tc.missingMethod(sourceType, targetType)
+		return name == ""
+	}
+	return false
+}
+
+// canBeNil reports whether null may be used as a value of typ, which it
+// may if typ is a nullable named type or its values may be nil in Go.
+func (tc *TypeChecker) canBeNil(typ string) bool {
+	if tc.nullableVars[typ] {
+		return true
+	}
+	if _, ok := tc.typeParams[typ]; ok {
+		return false
+	}
+	return !tc.info.PointerNullable(tc.underlying(typ))
+}
+
+// anyName matches any as a whole type name within a type string.
+var anyName = regexp.MustCompile(`\bany\b`)
+
+// expandAny spells the alias any as interface{} throughout typ, so that
+// for example []any and []interface{} are the same type.
+func expandAny(typ string) string {
+	if !strings.Contains(typ, "any") {
+		return typ
+	}
+	return anyName.ReplaceAllString(typ, "interface{}")
+}
+
+// isNullable reports whether expr may hold null: a variable, field or
+// call result declared nullable, a value of a nullable type, or a safe
+// navigation.
+func (tc *TypeChecker) isNullable(expr parser.ASTNode, exprType string) bool {
+	switch e := expr.(type) {
+	case *parser.Identifier:
+		if nullable, ok := tc.narrowed[e.Name]; ok {
+			return nullable
+		}
+	case *parser.SafeNavExpr, *parser.LiteralNull:
 		return true
 	}
+	return tc.declaredNullable(expr) || tc.nullableVars[exprType] || exprType == "interface{}"
+}
+
+// declaredNullable reports whether expr is a variable or field declared
+// nullable, or a call to a function with a nullable result.
+func (tc *TypeChecker) declaredNullable(expr parser.ASTNode) bool {
+	switch e := expr.(type) {
+	case *parser.Identifier:
+		return strings.HasPrefix(tc.lookupScope(e.Name), "?")
+	case *parser.SelectorExpr:
+		f := tc.selectedField(e)
+		return f != nil && f.IsNullable
+	case *parser.CallExpr:
+		return tc.nullCalls[e]
+	}
 	return false
 }
 
+// storeNullable records how value is stored in a variable, field,
+// parameter or result of the nullable type ?elem. If that is a pointer,
+// null is nil, a nullable value is stored as it is, and a non-null value
+// is boxed.
+func (tc *TypeChecker) storeNullable(value parser.ASTNode, elem string) {
+	if !tc.info.PointerNullable(elem) {
+		return
+	}
+	if _, ok := value.(*parser.LiteralNull); ok {
+		return
+	}
+	if tc.info.Pointers[value] {
+		delete(tc.info.Deref, value)
+		return
+	}
+	tc.info.Boxed[value] = elem
+}
+
 func (tc *TypeChecker) defineVar(name, varType string) {
+	delete(tc.consts, name)
 	if len(tc.scopes) > 0 {
 		tc. scopes[len(tc.scopes)-1][name] = varType
 	}
 }
 
+// lookupVar returns the type of the values of a variable, or "" if it is
+// not defined.
 func (tc *TypeChecker) lookupVar(name string) string {
+	return strings.TrimPrefix(tc.lookupScope(name), "?")
+}
+
+// lookupScope returns the type a variable is defined with, which is ?T if
+// it is nullable.
+func (tc *TypeChecker) lookupScope(name string) string {
 	for i := len(tc.scopes) - 1; i >= 0; i-- {
 		if t, ok := tc.scopes[i][name]; ok {
 			return t
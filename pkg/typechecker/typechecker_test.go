@@ -0,0 +1,806 @@
+package typechecker
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/MistyPigeon/lingo/pkg/lexer"
+	"github.com/MistyPigeon/lingo/pkg/parser"
+)
+
+// checkTest is a program to type check. err is a substring of the
+// expected error, or "" if the program is valid.
+type checkTest struct {
+	src string
+	err string
+}
+
+func check(src string) error {
+	program, err := parser.New(lexer.New(src).Tokenize()).Parse()
+	if err != nil {
+		return err
+	}
+	return New().Check(program)
+}
+
+func mustParse(t *testing.T, src string) *parser.Program {
+	t.Helper()
+	program, err := parser.New(lexer.New(src).Tokenize()).Parse()
+	if err != nil {
+		t.Fatalf("%s\nparse error: %v", src, err)
+	}
+	return program
+}
+
+func runCheckTests(t *testing.T, tests []checkTest) {
+	t.Helper()
+	for _, tt := range tests {
+		err := check(tt.src)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s\nunexpected error: %v", tt.src, err)
+		case tt.err != "" && err == nil:
+			t.Errorf("%s\nno error, want %q", tt.src, tt.err)
+		case tt.err != "" && !strings.Contains(err.Error(), tt.err):
+			t.Errorf("%s\ngot error %q, want %q", tt.src, err, tt.err)
+		}
+	}
+}
+
+func TestUnaryOperators(t *testing.T) {
+	runCheckTests(t, []checkTest{
+		{`func f(x: int64) int64 { return -x }`, ""},
+		{`func f(x: uint8) uint8 { return +x }`, ""},
+		{`func f(x: float32) float32 { return -x }`, ""},
+		{`func f() complex128 { return -2i }`, ""},
+		{`func f(x: complex64) complex64 { return -x }`, ""},
+		{`func f(x: int) int { return ^x }`, ""},
+		{`func f(b: bool) bool { return !b }`, ""},
+		{`func f(s: string) string { return -s }`, "unary - requires numeric operand"},
+		{`func f(b: bool) bool { return +b }`, "unary + requires numeric operand"},
+		{`func f(x: float64) float64 { return ^x }`, "unary ^ requires integer operand"},
+		{`func f(x: int) bool { return !x }`, "logical not requires bool operand"},
+	})
+}
+
+func TestNumericConstants(t *testing.T) {
+	runCheckTests(t, []checkTest{
+		{`var mask: byte = 0xFF`, ""},
+		{`var big: int64 = 1_000_000_000_000`, ""},
+		{`var f: float64 = 0x1p-2`, ""},
+		{`var c: complex128 = 2i`, ""},
+		{`var i: int = 1e3`, ""},
+		{`var b: byte = 0x100`, "constant 256 overflows byte"},
+		{`var n: int8 = -0b1000_0001`, "constant -129 overflows int8"},
+		{`var u: uint = -1`, "constant -1 overflows uint"},
+		{`var i: int = 1.5`, "constant 3/2 overflows int"},
+		{`func f() float64 { return 1e3 }`, ""},
+		{`func f(x: int64) int64 { return x + 1 }`, ""},
+		{`func f(x: int64) int64 { return 1 - x }`, ""},
+		{`func f(f: float64) float64 { return f * 2 }`, ""},
+		{`func f(f: float64) float64 { return 2 / f + f * 1.5 }`, ""},
+		{`func f(i: int) int { return i * 1.5 }`, "type mismatch in binary operation: int * float64"},
+		{`func f(i: int8) int8 { return i + 300 }`, "type mismatch in binary operation: int8 + int"},
+		{`func f() float64 { return 1 + 2.5 }`, ""},
+		{`func f() float64 { return 2.5 * 2 }`, ""},
+		{`func f(x: int64, y: int) int64 { return x + y }`, "type mismatch in binary operation: int64 + int"},
+		{`type Celsius float64
+func f(c: Celsius) Celsius { return c * 9 / 5 + 32 }`, ""},
+		{`func f(u: uint) int { return 1 << u }`, ""},
+	})
+}
+
+func TestStringAndRuneLiterals(t *testing.T) {
+	runCheckTests(t, []checkTest{
+		{`var r: rune = 'a'`, ""},
+		{"var s: string = `raw\nstring`", ""},
+		{`func f() rune { return '\n' }`, ""},
+		{`var s: string = 'a'`, "expected string, got rune"},
+		{`var r: rune = "a"`, "expected rune, got string"},
+	})
+}
+
+func TestStatementTerminators(t *testing.T) {
+	runCheckTests(t, []checkTest{
+		{"func f(x: int, y: int, z: int) int {\n\treturn\n\tx + y + z\n}", "2:2: not enough return values: have 0, want 1"},
+		{"func f(x: int) {\n\tx + 1\n}", "2:2: expression of type int is not used"},
+		{"func f(x: int) {\n\tx\n}", "2:2: expression of type int is not used"},
+		{`func f(x: int, y: int) int { return x +
+	y }`, ""},
+		{`func f() { return 1 }`, "too many return values: have 1, want 0"},
+		{`func f() (int, string) { return 1 }`, "not enough return values: have 1, want 2"},
+		{`func f() int { return "a" }`, "cannot use string as int value in return statement"},
+		{`func f() int8 { return 300 }`, "constant 300 overflows int8"},
+		{`func f() float64 { return 1 }`, ""},
+		{`func f() ?int { return null }`, ""},
+		{`func f() int { return null }`, "cannot use nil as int value in return statement"},
+		{`func f() *int { return null }`, ""},
+		{`func g() (int, string) { return 1, "a" }
+func f() (int, string) { return g() }`, ""},
+		{`func g() (string, int) { return "a", 1 }
+func f() (int, string) { return g() }`, "cannot use string as int value in return statement"},
+		{`func g() (int, string, bool) { return 1, "a", true }
+func f() (int, string) { return g() }`, "too many return values: g() returns 3 values, want 2"},
+		{`func f() { g := func() { return 1 } }`, "too many return values: have 1, want 0"},
+	})
+}
+
+func TestAssignOperators(t *testing.T) {
+	runCheckTests(t, []checkTest{
+		{`func f() { total := 0; total += 2; total <<= 1; total &^= 1 }`, ""},
+		{`func f() { s := "a"; s += "b" }`, ""},
+		{`func f() { x := 1.5; x *= 2.0 }`, ""},
+		{`func f() { var x: int64 = 1; x += 1 }`, ""},
+		{`func f() { s := "a"; s -= "b" }`, "operator - not defined on string"},
+		{`func f() { x := 1.5; x %= 2.0 }`, "operator % requires integer operands, got float64"},
+		{`func f() { x := 1; x += "a" }`, "type mismatch in binary operation: int + string"},
+		{`func f() { x := 1; x <<= 1.5 }`, "shift << requires integer operands, got int and float64"},
+		{`func f() { i := 0; i++; i-- }`, ""},
+		{`func f() { s := "a"; s++ }`, "invalid operation ++ on non-numeric type string"},
+		{`func f() { x := 1 &^ 2; y := x & 3 }`, ""},
+	})
+}
+
+func TestChannelOperators(t *testing.T) {
+	runCheckTests(t, []checkTest{
+		{`func f(ch: chan int) int { ch <- 1; return <-ch }`, ""},
+		{`func f(ch: chan<- int) { ch <- 1 }`, ""},
+		{`func f(ch: <-chan int) int { return <-ch }`, ""},
+		{`func f(x: int) { x <- 1 }`, "cannot send to non-channel type int"},
+		{`func f(ch: <-chan int) { ch <- 1 }`, "cannot send to receive-only channel type <-chan int"},
+		{`func f(ch: chan int) { ch <- "a" }`, "cannot send string on chan int"},
+		{`func f(x: int) int { return <-x }`, "cannot receive from non-channel type int"},
+		{`func f(ch: chan<- int) int { return <-ch }`, "cannot receive from send-only channel type chan<- int"},
+	})
+}
+
+func TestVariadicCalls(t *testing.T) {
+	runCheckTests(t, []checkTest{
+		{`func sum(xs: ...int) int { return 0 }
+func f() { sum(); sum(1); sum(1, 2, 3) }`, ""},
+		{`func sum(xs: ...int) int { return 0 }
+func f(xs: []int) int { return sum(xs...) }`, ""},
+		{`func sum(xs: ...int) []int { return xs }`, ""},
+		{`func sum(xs: ...int) int { return 0 }
+func f() int { return sum(1, "a") }`, "cannot use"},
+		{`func g(x: int) int { return 0 }
+func f(xs: []int) int { return g(xs...) }`, "cannot use ... in call to non-variadic g"},
+	})
+}
+
+func TestNullSafety(t *testing.T) {
+	runCheckTests(t, []checkTest{
+		{`func f() string { var name: ?string = null; return name ?: "World" }`, ""},
+		{`func f() string { var name: ?string = "a"; return name ?? "World" }`, ""},
+		{`func f() int { var n: ?int = null; return n ?: 1 }`, ""},
+		{`func f() string { name := "a"; return name ?: "World" }`, "cannot use ?: on non-nullable type: string"},
+		{`func f() string { var name: ?string = null; return name ?: 1 }`, "mismatched types string and int in ?:"},
+		{`type P struct { name: string }
+func f(p: ?*P) { x := p?.name }`, ""},
+		{`func f(name: ?string) string { return name ?: "World" }`, ""},
+		{`func g() ?string { return null }
+func f() string { return g() ?: "none" }`, ""},
+		{`func g() string { return "a" }
+func f() string { return g() ?: "none" }`, "cannot use ?: on non-nullable type: string"},
+		{`func f() string { var a: ?string = null; b := a; return b ?: "none" }`, ""},
+		{`func f(a: ?string) string {
+	switch a {
+	case null:
+		return "none"
+	default:
+		b := a
+		return b ?: "none"
+	}
+}`, "cannot use ?: on non-nullable type: string"},
+		{`type U struct { email: ?string }
+func f() string { u := U{email: "a"}; u.email = null; return u.email ?: "none" }`, ""},
+		{`func f() { var n: ?int = 1; n += 1 }`, "invalid operation += on nullable type ?int"},
+		{`func f() { var n: ?int = 1; n++ }`, "invalid operation ++ on nullable type ?int"},
+	})
+}
+
+func TestNullNarrowing(t *testing.T) {
+	runCheckTests(t, []checkTest{
+		{`func f() { var t: ?string; fmt.Println(t) }`, "1:40: cannot use nullable ?string as string value without a null check"},
+		{`func f() { var t: ?int; var a: int = t }`, "cannot use nullable ?int as int value without a null check"},
+		{`func f() int { var t: ?int; return t + 1 }`, "cannot use nullable ?int as int value without a null check"},
+		{`var t: ?int
+var a: int = t`, "cannot use nullable ?int as int value without a null check"},
+		{`type P struct { x: int }
+func f(p: ?P) int { return p.x }`, "cannot use nullable ?P as P value without a null check"},
+		{`func f(t: ?int) { g := () -> t * 2 }`, "cannot use nullable ?int as int value without a null check"},
+		{`func f(t: ?int) int {
+	if t != null {
+		t = null
+		return t
+	}
+	return 0
+}`, "cannot use nullable ?int as int value without a null check"},
+		{`func f(t: ?int) int {
+	if t == null {
+		fmt.Println("none")
+	}
+	return t
+}`, "cannot use nullable ?int as int value without a null check"},
+		{`func f(t: ?int) int {
+	if t != null {
+		return t + 1
+	}
+	return 0
+}`, ""},
+		{`func f(t: ?int) int {
+	if t == null {
+		return 0
+	}
+	return t + 1
+}`, ""},
+		{`func f(t: ?int, u: ?int) int {
+	if t == null || u == null {
+		return 0
+	} else {
+		return t + u
+	}
+}`, ""},
+		{`func f(t: ?int) bool { return t != null && t > 1 }`, ""},
+		{`func f(t: ?int) bool { return t == null || t > 1 }`, ""},
+		{`func f(t: ?int) int {
+	switch t {
+	case null:
+		return 0
+	default:
+		return t
+	}
+}`, ""},
+		{`func f(t: ?int) int { return t ?? 0 }`, ""},
+		{`func f(t: ?int) { var u: ?int = t; g(t) }
+func g(n: ?int) {}`, ""},
+	})
+}
+
+func TestNullAssignment(t *testing.T) {
+	runCheckTests(t, []checkTest{
+		{`var x: int = null`, "type mismatch for var x: expected int, got nil"},
+		{`func f() { var s: string; s = null }`, "cannot assign nil to string"},
+		{`func g(n: int) {}
+func f() { g(null) }`, "cannot use nil as int in argument to g"},
+		{`type P struct { x: int }
+func f() { p := P{x: null} }`, "cannot use null as value of non-nullable field x"},
+		{`func f() { var x: ?int = null; x = null; x = 1 }`, ""},
+		{`type IDs []int
+type Shape interface { Area() int }
+func f() {
+	var p: *int = null
+	var s: []int = null
+	var m: map[string]int = null
+	var c: chan int = null
+	var fn: func() = null
+	var e: error = null
+	var sh: Shape = null
+	var ids: IDs = null
+}`, ""},
+	})
+}
+
+func TestPointerNullable(t *testing.T) {
+	tc := New()
+	if err := tc.Check(mustParse(t, `type Shape interface { Area() int }`)); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		elem string
+		want bool
+	}{
+		{"string", true},
+		{"int", true},
+		{"User", true},
+		{"[4]int", true},
+		{"T", true},
+		{"*User", false},
+		{"[]int", false},
+		{"map[string]int", false},
+		{"chan int", false},
+		{"<-chan int", false},
+		{"func(int) int", false},
+		{"interface{}", false},
+		{"any", false},
+		{"error", false},
+		{"Shape", false},
+	}
+	for _, tt := range tests {
+		if got := tc.Info().PointerNullable(tt.elem); got != tt.want {
+			t.Errorf("PointerNullable(%q) = %v, want %v", tt.elem, got, tt.want)
+		}
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	runCheckTests(t, []checkTest{
+		{"func f() {\n\tx := y\n}", "2:7: undefined variable: y"},
+		{"func f() int {\n\treturn 1 +\n\t\t\"a\"\n}", "2:9: type mismatch in binary operation: int + string"},
+		{"var x: int = \"a\"", "1:1: type mismatch for var x: expected int, got string"},
+		{"func f(x: int) {}\nfunc g() {\n\tf(\"s\")\n}", "3:4: cannot use string as int in argument to f"},
+	})
+
+	err := New().Check(mustParse(t, "func f() {\n\tx := y\n}"))
+	tcErr, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("got %T, want *Error", err)
+	}
+	if tcErr.Pos.Line != 2 || tcErr.Pos.Col != 7 || tcErr.Pos.Offset != 17 {
+		t.Errorf("got position %+v, want line 2, column 7, offset 17", tcErr.Pos)
+	}
+}
+
+func TestTypeExprs(t *testing.T) {
+	runCheckTests(t, []checkTest{
+		{`func f(grid: [][]int) []int { return grid[0] }`, ""},
+		{`func f(buf: [4]byte) byte { return buf[3] }`, ""},
+		{`func f(m: map[string][]int) []int { return m["a"] }`, ""},
+		{`func f(m: map[string][]int) { var x: int = m["a"] }`, "expected int, got []int"},
+		{`func f(p: *[]int) *[]int { return p }`, ""},
+		{`func f(g: func(int) error) error { return g(1) }`, ""},
+		{`func f(g: func(int) error) error { return g("a") }`, "cannot use string as int in argument to g"},
+		{`func f(ch: chan<- int) chan<- int { return ch }`, ""},
+		{`func f(ch: chan int) <-chan int { return ch }`, ""},
+		{`func f(ch: <-chan int) { var c: chan int = ch }`, "expected chan int, got <-chan int"},
+		{`func f(x: strings.Builder) strings.Builder { return x }`, ""},
+	})
+}
+
+func TestFuncValues(t *testing.T) {
+	runCheckTests(t, []checkTest{
+		{`func double(x: int) int { return x * 2 }
+func f() int { g := double; return g(1) }`, ""},
+		{`func double(x: int) int { return x * 2 }
+func f() { var g: func(int) int = double }`, ""},
+		{`func double(x: int) int { return x * 2 }
+func f() { var g: func(string) int = double }`, "expected func(string) int, got func(int) int"},
+		{`func double(x: int) int { return x * 2 }
+func Map[T any, U any](xs: []T, f: func(T) U) []U { return null }
+func f() []int { return Map([]int{1}, double) }`, ""},
+		{`func id[T any](x: T) T { return x }
+func f() { g := id }`, "cannot use generic function id without instantiation"},
+		{`func f() { g := nothing }`, "undefined variable: nothing"},
+	})
+}
+
+func TestFuncLits(t *testing.T) {
+	runCheckTests(t, []checkTest{
+		{`func f() int { n := 1; inc := func() int { n++; return n }; return inc() }`, ""},
+		{`func f() int { g := (x: int) -> x * 2; return g(1) }`, ""},
+		{`func f() { var g: func(int) int = (x: int) -> x * 2 }`, ""},
+		{`func f() { var g: func(int) string = (x: int) -> x * 2 }`, "expected func(int) string, got func(int) int"},
+		{`func f() { var g: func(int) int = (x: int) int -> x }`, ""},
+		{`func f() int { return ((x: int) -> x * 2)(3) + 1 }`, ""},
+		{`func f() { var s: string = ((x: int) -> x * 2)(3) }`, "expected string, got int"},
+		{`func f() string { g := () -> "a"; return g() + 1 }`, "type mismatch in binary operation: string + int"},
+		{`func f() { g := func(x: int) {}; y := x }`, "undefined variable: x"},
+		{`func f() { func() { y := 1 }(); z := y }`, "undefined variable: y"},
+		{`func f() { for { func() { break }() } }`, "break is not in a loop"},
+		{`func f() { defer func() { recover() }() }`, ""},
+		{`func f(ch: chan int) { go func(n: int) { ch <- n }(1) }`, ""},
+	})
+}
+
+// TestArrowResultNotStored checks that the inferred result type of an
+// arrow lambda is recorded in Info rather than written into the AST.
+func TestArrowResultNotStored(t *testing.T) {
+	program := mustParse(t, `func f() { g := (x: int) -> x > 1 }`)
+	tc := New()
+	if err := tc.Check(program); err != nil {
+		t.Fatal(err)
+	}
+	assign := program.Items[0].(*parser.FuncDecl).Body[0].(*parser.ShortAssignStmt)
+	lit := assign.Rhs[0].(*parser.FuncLit)
+	if len(lit.Type.Results) != 0 {
+		t.Errorf("arrow lambda results = %v, want none", lit.Type.Results)
+	}
+	if got := tc.Info().Types[lit]; got != "func(int) bool" {
+		t.Errorf("type of arrow lambda = %q, want %q", got, "func(int) bool")
+	}
+}
+
+func TestStructs(t *testing.T) {
+	runCheckTests(t, []checkTest{
+		{`type User struct { id: int; name: string; email: ?string }
+func f(u: User) string { return u.name }`, ""},
+		{`type User struct { id: int }
+func f(u: *User) int { return u.id }`, ""},
+		{`type User struct { id: int }
+func f(u: User) { var s: string = u.id }`, "expected string, got int"},
+		{`type User struct { id: int }
+func f(u: User) int { return u.age }`, "User has no field or method age"},
+		{`type Base struct { id: int }
+type User struct { Base; name: string }
+func f(u: User) int { return u.id }`, ""},
+		{`type Base struct { id: int }
+type User struct { *Base }
+func f(u: User) int { return u.Base.id }`, ""},
+		{`type P struct { x: int; x: string }`, "duplicate field x in struct P"},
+		{`type P struct { x: int }
+type P struct { y: int }`, "struct P redeclared"},
+		{`type P struct { x: int }
+func (p: P) x() int { return 0 }`, "field and method with the same name x"},
+		{`type User struct { name: string; email: ?string }
+func f() User { return User{name: "a", email: null} }`, ""},
+		{`type User struct { name: string }
+func f() User { return User{name: null} }`, "cannot use null as value of non-nullable field name"},
+		{`type User struct { name: string }
+func f() User { return User{age: 1} }`, "unknown field age in struct literal of type User"},
+	})
+}
+
+func TestInterfaces(t *testing.T) {
+	shapes := `type Shape interface { Area() int }
+type Named interface { Shape; Name() string }
+type Square struct { side: int }
+func (s: Square) Area() int { return s.side * s.side }
+type Circle struct { r: int }
+func (c: *Circle) Area() int { return 3 * c.r * c.r }
+`
+	runCheckTests(t, []checkTest{
+		{shapes + `func f() { var s: Shape = Square{2} }`, ""},
+		{shapes + `func f(c: *Circle) { var s: Shape = c }`, ""},
+		{shapes + `func f(c: Circle) { var s: Shape = c }`, "Circle does not implement Shape (missing method Area)"},
+		{shapes + `func f(s: Square) { var n: Named = s }`, "Square does not implement Named (missing method Name)"},
+		{shapes + `func area(s: Shape) int { return s.Area() }
+func f() int { return area(Square{1}) }`, ""},
+		{shapes + `func area(s: Shape) int { return s.Area() }
+func f() int { return area(1) }`, "int does not implement Shape (missing method Area)"},
+		{shapes + `func f(n: Named) string { return n.Name() }`, ""},
+		{shapes + `func f(s: Shape) int { return s.Perimeter() }`, "Shape has no field or method Perimeter"},
+		{`type Shape interface { Area() int }
+type Bad struct {}
+func (b: Bad) Area() string { return "" }
+func f() { var s: Shape = Bad{} }`, "Bad does not implement Shape (wrong type for method Area)"},
+		{`type E struct {}
+func (e: E) Error() string { return "e" }
+func f() error { var err: error = E{}; return err }`, ""},
+		{`type A interface { B }
+type B interface { A }`, "invalid recursive interface"},
+		{`type A interface { M(); M() }`, "duplicate method M in interface A"},
+		{`type A interface { int }`, "cannot embed non-interface type int in interface A"},
+		{`type A interface { M() }
+type A struct {}`, "redeclared"},
+		{`func f(x: interface{}) int { return x.(int) }`, ""},
+		{`func f(x: int) int { return x.(int) }`, "invalid operation: int is not an interface"},
+	})
+}
+
+func TestForLoops(t *testing.T) {
+	runCheckTests(t, []checkTest{
+		{`func f() int { n := 0; for i := 0; i < 10; i++ { n += i }; return n }`, ""},
+		{`func f() { for i := 0; i < 10; i++ {}; i++ }`, "undefined variable: i"},
+		{`func f() { for i := 0; i + 1; i++ {} }`, "non-boolean condition in for statement: int"},
+		{`func f(xs: []string) { for i, s := range xs { var n: int = i; var t: string = s } }`, ""},
+		{`func f(m: map[string]int) { for k, v := range m { var n: int = v; var s: string = k } }`, ""},
+		{`func f(s: string) { for i, r := range s { var c: rune = r } }`, ""},
+		{`func f() { for i := range 10 { var n: int = i } }`, ""},
+		{`func f(ch: <-chan int) { for v := range ch { var n: int = v } }`, ""},
+		{`func f(ch: chan<- int) { for v := range ch {} }`, "cannot range over send-only channel chan<- int"},
+		{`func f(ch: chan int) { for v, w := range ch {} }`, "range over chan int permits only one iteration variable"},
+		{`func f(x: bool) { for v := range x {} }`, "cannot range over bool"},
+		{`type IDs []int
+func f(ids: IDs) int { n := 0; for _, id := range ids { n += id }; return n }`, ""},
+		{`type Names map[string]bool
+func f(names: Names) { for name, ok := range names { var s: string = name; var b: bool = ok } }`, ""},
+		{`func f(xs: []int) { var i: int; for i = range xs {} }`, ""},
+		{`func f(xs: []int) { var s: string; for s = range xs {} }`, "cannot assign int to string in range"},
+		{`func f() { break }`, "break is not in a loop"},
+		{`func f() { continue }`, "continue is not in a loop"},
+	})
+}
+
+func TestSwitches(t *testing.T) {
+	runCheckTests(t, []checkTest{
+		{`func f(x: int) string { switch x { case 1, 2: return "small"; default: return "big" } }`, ""},
+		{`func f(x: int) { switch x { case "a": } }`, "invalid case in switch on int (mismatched types string and int)"},
+		{`func f(x: int) { switch { case x > 1: case x: } }`, "invalid case in switch (mismatched types int and bool)"},
+		{`func f(x: int) { switch y := x * 2; y { case 4: } }`, ""},
+		{`func f(x: int) { switch x { default: default: } }`, "multiple defaults in switch"},
+		{`func f(x: int) { switch x { case 1: fallthrough; case 2: } }`, ""},
+		{`func f(x: int) { switch x { case 1: fallthrough } }`, "cannot fallthrough final case in switch"},
+		{`func f(x: int) { for { switch x { case 1: break } } }`, ""},
+		{`func f(x: interface{}) int {
+	switch v := x.(type) {
+	case int:
+		return v
+	case string:
+		return len(v)
+	}
+	return 0
+}`, ""},
+		{`func f(x: int) { switch x.(type) { } }`, "cannot type switch on non-interface type int"},
+		{`type S interface { M() }
+func f(x: S) { switch x.(type) { case int: } }`, "impossible type switch case: S cannot have dynamic type int (missing method M)"},
+		{`func f(x: interface{}) { switch x.(type) { case int: fallthrough; default: } }`, "cannot fallthrough in type switch"},
+		{`func f(name: ?string) string {
+	switch name {
+	case null:
+		return name ?: "none"
+	default:
+		return name + "!"
+	}
+}`, ""},
+		{`func f(name: ?string) string {
+	switch name {
+	case null:
+		return "none"
+	default:
+		return name ?: "none"
+	}
+}`, "cannot use ?: on non-nullable type: string"},
+		{`func f(name: string) { switch name { case null: } }`, "invalid case null in switch on non-nullable string"},
+	})
+}
+
+func TestIfScopes(t *testing.T) {
+	runCheckTests(t, []checkTest{
+		{`func f(c: bool) int { if c { x := 1; return x }; x := 2; return x }`, ""},
+		{`func f(c: bool) int { if c { x := 1 } else { x := "a" }; x := 2; return x }`, ""},
+		{`func f(c: bool) int { if c { x := 1 }; return x }`, "undefined variable: x"},
+		{`func f(c: bool) int { x := 1; if c { x := "a"; var s: string = x }; return x }`, ""},
+		{`func f(c: bool, d: bool) { if c { } else if d { y := 1 } else { y := 2 } }`, ""},
+		{`func f(c: bool) { x := 1; if c { x = 2 } }`, ""},
+	})
+}
+
+func TestMultiAssign(t *testing.T) {
+	divmod := "func divmod(a: int, b: int) (int, int) { return a / b, a % b }\n"
+	runCheckTests(t, []checkTest{
+		{divmod + `func f() int { q, r := divmod(7, 2); return q + r }`, ""},
+		{divmod + `func f() { q := divmod(7, 2) }`, "multiple-value divmod() in single-value context"},
+		{divmod + `func f() { a, b, c := divmod(7, 2) }`, "assignment mismatch: 3 variables but divmod() returns 2 values"},
+		{divmod + `func f() { var s: string; var n: int; s, n = divmod(7, 2) }`, "cannot assign int to string"},
+		{divmod + `func f() int { return divmod(7, 2) + 1 }`, "multiple-value divmod() in single-value context"},
+		{`func f() { a, b := 1, "x"; a, b = 2, "y"; b, a = "z", 3 }`, ""},
+		{`func f() { a, b := 1, 2; a, b = b, a }`, ""},
+		{`func f() { a, b := 1, 2, 3 }`, "assignment mismatch: 2 variables but 3 values"},
+		{`func f() { a := 1; a := 2 }`, "no new variables on left side of :="},
+		{`func f() { a := 1; a, b := 2, 3 }`, ""},
+		{`func f() { a := 1; a, b := "x", 3 }`, "cannot assign string to int"},
+		{`func f() { a, a := 1, 2 }`, "a repeated on left side of :="},
+		{`func f(m: map[string]int) int { v, ok := m["a"]; if ok { return v }; return 0 }`, ""},
+		{`func f(x: interface{}) { s, ok := x.(string); var t: string = s; var b: bool = ok }`, ""},
+		{`func f(ch: chan int) { v, ok := <-ch; var b: bool = ok }`, ""},
+		{`func f(xs: []int) { v, ok := xs[0] }`, "assignment mismatch: 2 variables but 1 value"},
+		{`func f(xs: []int, p: *[]int) { _, xs[0] = 1, 2 }`, ""},
+	})
+}
+
+func TestCompositeLiterals(t *testing.T) {
+	user := "type User struct { name: string; email: ?string }\n"
+	runCheckTests(t, []checkTest{
+		{user + `func f() User { return User{name: "x", email: null} }`, ""},
+		{user + `func f() User { return User{"x", "y"} }`, ""},
+		{user + `func f() User { return User{name: 1} }`, "cannot use"},
+		{user + `func f() User { return User{age: 1} }`, "unknown field age"},
+		{`func f() []int { return []int{1, 2} }`, ""},
+		{`func f() []int { return []int{1, "a"} }`, "cannot use"},
+		{`func f() [2]int { return [2]int{1, 2, 3} }`, "array index 2 out of bounds [0:2]"},
+		{`func f() map[string]int { return map[string]int{"a": 1, "b": 2} }`, ""},
+		{`func f() map[string]int { return map[string]int{"a": 1, "a": 2} }`, "duplicate key \"a\" in map literal"},
+		{`func f() map[string]int { return map[string]int{1: 1} }`, "cannot use"},
+		{`func f() { var xs: []int = [1, 2] }`, ""},
+		{`func f() { var xs: []string = [1, 2] }`, "expected []string, got []int"},
+	})
+}
+
+func TestPointers(t *testing.T) {
+	runCheckTests(t, []checkTest{
+		{`func f(p: *int) int { *p = 2; *p++; return *p }`, ""},
+		{`func f(p: *int) { *p = "a" }`, "cannot assign string to int"},
+		{`func f(x: int) int { return *x }`, "unary * requires pointer operand, got int"},
+		{`func f(x: int) { *x = 1 }`, "unary * requires pointer operand, got int"},
+		{`func f(x: int) **int { p := &x; return &p }`, ""},
+		{`type P *int
+func f(p: P) int { return *p }`, ""},
+	})
+}
+
+// TestUntypedArrayNotStored checks that the element type of an untyped
+// [a, b] literal is recorded in Info rather than written into the AST.
+func TestUntypedArrayNotStored(t *testing.T) {
+	program := mustParse(t, `func f() { xs := [1, 2] }`)
+	tc := New()
+	if err := tc.Check(program); err != nil {
+		t.Fatal(err)
+	}
+	assign := program.Items[0].(*parser.FuncDecl).Body[0].(*parser.ShortAssignStmt)
+	lit := assign.Rhs[0].(*parser.ArrayLiteral)
+	if lit.Type != nil {
+		t.Errorf("untyped array literal type = %v, want none", lit.Type)
+	}
+	if got := tc.Info().Types[lit]; got != "[]int" {
+		t.Errorf("type of untyped array literal = %q, want %q", got, "[]int")
+	}
+}
+
+func TestGroupedDecls(t *testing.T) {
+	runCheckTests(t, []checkTest{
+		{"const (\n\tA = iota * 100\n\tB\n\tC\n)\nfunc f() { var x: int8 = B }", ""},
+		{"const (\n\tA = iota * 100\n\tB\n\tC\n)\nfunc f() { var x: int8 = C }", "constant 200 overflows int8"},
+		{"const (\n\tA: int8 = 1 << (iota * 4)\n\tB\n\tC\n)", "constant 256 overflows int8"},
+		{"const (\n\tA = \"a\"\n\tB\n)\nfunc f() string { return B + \"b\" }", ""},
+		{"const (\n\tA = \"a\"\n\tB\n)\nfunc f() int { return B + 1 }", "type mismatch in binary operation: string + int"},
+		{"var (\n\tx: int = 1\n\ty = \"a\"\n)\nfunc f() string { return y }", ""},
+		{"var (\n\tx: int = \"a\"\n)", "type mismatch for var x: expected int, got string"},
+		{"type (\n\tID int\n\tPair struct { a: int }\n)\nfunc f(p: Pair) ID { return ID(p.a) }", ""},
+		{"type (\n\tPair struct { a: int }\n)\nfunc f(p: Pair) int { return p.b }", "Pair has no field or method b"},
+		{`func f() int { return iota }`, "undefined variable: iota"},
+	})
+}
+
+func TestGenerics(t *testing.T) {
+	mapFn := "func Map[T, U any](xs: []T, f: func(T) U) []U { return null }\n"
+	sum := "type Number interface { ~int | ~float64 }\nfunc Sum[T Number](xs: []T) T { var s: T; return s }\n"
+	runCheckTests(t, []checkTest{
+		{mapFn + `func f(xs: []int, g: func(int) string) []string { return Map(xs, g) }`, ""},
+		{mapFn + `func f(xs: []int, g: func(int) string) { var ys: []int = Map(xs, g) }`, "expected []int, got []string"},
+		{mapFn + `func f(xs: []int, g: func(int) string) []string { return Map[int, string](xs, g) }`, ""},
+		{sum + `func f() int { return Sum([]int{1, 2}) }`, ""},
+		{sum + `type MyInt int
+func f(xs: []MyInt) MyInt { return Sum(xs) }`, ""},
+		{sum + `func f() string { return Sum([]string{"a"}) }`, "string does not satisfy Number"},
+		{`type Box[T any] struct { v: T }
+func f() int { b := Box[int]{v: 1}; return b.v }`, ""},
+		{`type Box[T any] struct { v: T }
+func f() { b := Box[int]{v: "a"} }`, "cannot use"},
+		{`func f(x: any) { var y: interface{} = x; var z: any = y }`, ""},
+		{`func f(xs: []any) { var ys: []interface{} = xs }`, ""},
+		{`func f(m: map[string]interface{}) { var n: map[string]any = m }`, ""},
+		{`func f(g: func(any) any) { var h: func(interface{}) interface{} = g }`, ""},
+		{`func f(xs: []any) { var ys: []int = xs }`, "expected []int, got []any"},
+		{"const N = 2\ntype A [N * 2]int\nfunc f(a: A) int { return len(a) }", ""},
+	})
+}
+
+func TestMakeAndSelect(t *testing.T) {
+	runCheckTests(t, []checkTest{
+		{`func f() chan int { return make(chan int, 1) }`, ""},
+		{`func f() { var ch: chan string = make(chan int) }`, "expected chan string, got chan int"},
+		{`func f() { var ch: <-chan int = make(chan int) }`, ""},
+		{`func f() { xs := make([]int) }`, "make([]int) expects 2 or 3 arguments; found 1"},
+		{`func f() { xs := make(int, 1) }`, "cannot make"},
+		{`func f(ch: chan int, done: chan bool) int {
+	select {
+	case v := <-ch:
+		return v
+	case v, ok := <-ch:
+		if ok { return v }
+	case ch <- 1:
+	case <-done:
+	default:
+	}
+	return 0
+}`, ""},
+		{`func f(ch: chan int) { select { case v := <-ch: var s: string = v } }`, "expected string, got int"},
+		{`func f(ch: chan int) { select { case ch <- "a": } }`, "cannot send string on chan int"},
+		{`func f(ch: <-chan int) { select { case ch <- 1: } }`, "cannot send to receive-only channel type <-chan int"},
+		{`func f(ch: chan int) { select { default: default: } }`, "multiple defaults in select"},
+		{`func f(ch: chan int) { select { case v := <-ch: }; x := v }`, "undefined variable: v"},
+	})
+}
+
+func TestAppend(t *testing.T) {
+	runCheckTests(t, []checkTest{
+		{`func f(xs: []int) []int { return append(xs, 1, 2) }`, ""},
+		{`func f(xs: []int) { var ys: []int = append(xs, 1) }`, ""},
+		{`func f(xs: []int) { var ys: []string = append(xs, 1) }`, "expected []string, got []int"},
+		{`func f(xs: []int) { xs = append(xs, "a") }`, "cannot use string as int value in argument to append"},
+		{`func f(xs: []int8) { xs = append(xs, 300) }`, "constant 300 overflows int8"},
+		{`func f(xs: []int, ys: []int) { xs = append(xs, ys...) }`, ""},
+		{`func f(xs: []int, ys: []string) { xs = append(xs, ys...) }`, "cannot use []string as []int value in argument to append"},
+		{`func f(b: []byte) { b = append(b, "abc"...) }`, ""},
+		{`func f(xs: []int) { xs = append(xs, 1, xs...) }`, "can only use ... with final argument"},
+		{`func f(x: int) { x = append(x, 1) }`, "first argument to append must be a slice, got int"},
+		{`func f() { xs := append() }`, "not enough arguments in call to append"},
+		{`type Ints []int
+func f(xs: Ints) Ints { xs = append(xs, 1); return xs }`, ""},
+		{`type S interface { String() string }
+func f(xs: []S) { xs = append(xs, 1) }`, "cannot use int as S value in argument to append"},
+		{`func f(xs: []interface{}) { xs = append(xs, 1, "a") }`, ""},
+	})
+}
+
+func TestLabels(t *testing.T) {
+	runCheckTests(t, []checkTest{
+		{`func f() { outer: for { for { continue outer } } }`, ""},
+		{`func f() { outer: for { for { break outer } } }`, ""},
+		{`func f(x: int) { L: switch x { case 1: break L } }`, ""},
+		{`func f(ch: chan int) { L: select { case <-ch: break L } }`, ""},
+		{`func f() { goto end; end: }`, ""},
+		{`func f() { for { continue missing } }`, "label missing not defined"},
+		{`func f() { L: for {}; L: for {} }`, "label L already defined"},
+		{`func f() { L: for {} }`, "label L defined and not used"},
+		{`func f(x: int) { L: switch x { case 1: continue L } }`, "invalid continue label L"},
+		{`func f() { L: x := 1; for { break L } }`, "invalid break label L"},
+		{`func f() { goto L; x := 1; L: }`, "goto L jumps over variable declaration"},
+		{`func f(b: bool) { goto L; if b { L: } }`, "goto L jumps into block"},
+		{`func f() { break }`, "break is not in a loop, switch, or select"},
+		{`func f() { continue }`, "continue is not in a loop"},
+		{`func f(x: int) { switch x { case 1: continue } }`, "continue is not in a loop"},
+		{`func f() { fallthrough }`, "fallthrough statement out of place"},
+		{`func f(x: int) { switch x { case 1: fallthrough } }`, "cannot fallthrough final case in switch"},
+		{`func f(x: int) { switch x { case 1: fallthrough; x++; case 2: } }`, "fallthrough statement out of place"},
+		{`func f(x: interface{}) { switch x.(type) { case int: fallthrough; case string: } }`, "cannot fallthrough in type switch"},
+	})
+}
+
+func TestSelectors(t *testing.T) {
+	node := "type Node struct { name: string; kids: []Node }\nfunc (n: Node) First() Node { return n.kids[0] }\n"
+	runCheckTests(t, []checkTest{
+		{node + `func f(n: Node) string { return n.First().kids[0].First().name }`, ""},
+		{node + `func f(n: Node) { var x: int = n.First().name }`, "expected int, got string"},
+		{node + `func f(n: Node) { n.First().Last() }`, "Node has no field or method Last"},
+		{`func f() { fmt.Println(1) }`, ""},
+		{"import \"strings\"\nfunc f() string { return strings.ToUpper(\"a\") }", ""},
+		{"import str \"strings\"\nfunc f() string { return str.ToUpper(\"a\") }", ""},
+		{"import (\n\t\"os\"\n\t\"math/rand/v2\"\n)\nfunc f() { os.Exit(rand.IntN(2)) }", ""},
+		{`func f() { strings.ToUpper("a") }`, "undefined variable: strings"},
+		{"import str \"strings\"\nfunc f() { strings.ToUpper(\"a\") }", "undefined variable: strings"},
+		{"import _ \"embed\"\nfunc f() { x := embed.FS }", "undefined variable: embed"},
+		{`func f() { x := nothing.field }`, "undefined variable: nothing"},
+		{node + `func f(fmt: Node) string { return fmt.name }`, ""},
+		{`func f(x: int) { y := x.foo }`, "int has no field or method foo"},
+		{`func f(s: []int) { s.Len() }`, "[]int has no field or method Len"},
+		{`func f(s: string) { n := s.length }`, "string has no field or method length"},
+		{`type ID int
+func f(id: ID) { id.Next() }`, "ID has no field or method Next"},
+		{`type ID int
+func (id: ID) Next() ID { return id + 1 }
+func f(id: ID) ID { return id.Next() }`, ""},
+		{node + `type Leaf Node
+func f(l: Leaf) string { return l.name }`, ""},
+		{node + `type Leaf Node
+func f(l: *Leaf) { x := l.size }`, "*Leaf has no field or method size"},
+		{"import \"strings\"\nfunc f(b: *strings.Builder) int { return b.Len() }", ""},
+		{"import \"strings\"\ntype Buf strings.Builder\nfunc f(b: Buf) { b.Grow(1) }", ""},
+		{`func f[T any](x: T) { x.Foo() }`, ""},
+		{`func f(p: struct { x: int }) int { return p.x }`, ""},
+		{`func f() { foo(1) }`, "undefined: foo"},
+		{`func f() { x := bar() }`, "undefined: bar"},
+		{`type P struct { x: int }
+type ID int
+func f(s: string) {
+	println(len(s), cap([]int{}), string(s), float64(1), P{}.x, ID(2), any(s), complex(1, 2))
+}`, ""},
+		{`func f(g: func(int) int) int { return g(1) }`, ""},
+	})
+}
+
+func TestSliceExprs(t *testing.T) {
+	runCheckTests(t, []checkTest{
+		{`func f(xs: []int) { var ys: []int = xs[1:] }`, ""},
+		{`func f(xs: []int, n: int) { var ys: []int = xs[:n:n] }`, ""},
+		{`func f(s: string) { var t: string = s[1:2] }`, ""},
+		{`func f(s: string) { t := s[0:1:2] }`, "invalid operation: 3-index slice of string"},
+		{`func f(a: [4]int) { var xs: []int = a[1:3] }`, ""},
+		{`func f(p: *[4]int) { var xs: []int = p[:] }`, ""},
+		{`func f(a: [4]int) { xs := a[:5] }`, "slice index 5 out of bounds [0:5]"},
+		{`func f(xs: []int) { ys := xs[2:1] }`, "invalid slice indices: 1 < 2"},
+		{`func f(xs: []int) { ys := xs[-1:] }`, "invalid slice index -1 (index must be non-negative)"},
+		{`func f(xs: []int) { ys := xs[1.5:] }`, "slice index 1.5 must be integer"},
+		{`func f(xs: []int, s: string) { ys := xs[s:] }`, "invalid slice index of type string"},
+		{`func f(x: int) { y := x[1:] }`, "cannot slice value of type int"},
+		{`func g() [4]int { var a: [4]int; return a }
+func f() { xs := g()[1:] }`, "cannot slice unaddressable value of type [4]int"},
+		{`type IDs []int
+func f(ids: IDs) { var rest: IDs = ids[1:] }`, ""},
+		{`type Name string
+func f(n: Name) { var s: Name = n[:1] }`, ""},
+		{`type Grid [3]int
+func f(g: Grid) { var xs: []int = g[1:] }`, ""},
+	})
+}
+
+func TestIndexNamedTypes(t *testing.T) {
+	runCheckTests(t, []checkTest{
+		{"type Ints []int\nfunc f(s: Ints) { var x: int = s[0]; var y: Ints = s[0:1] }", ""},
+		{"type Ints []int\nfunc f(s: Ints) { var x: string = s[0] }", "expected string, got int"},
+		{"type Ages map[string]int\nfunc f(m: Ages) { var x: int = m[\"a\"] }", ""},
+		{"type Name string\nfunc f(n: Name) { var b: byte = n[0] }", ""},
+		{"type Grid [3]int\nfunc f(g: Grid) { var x: string = g[0] }", "expected string, got int"},
+		{`func f(p: *[3]int) { var x: string = p[0] }`, "expected string, got int"},
+	})
+}
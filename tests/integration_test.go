@@ -2,6 +2,9 @@ package lingo
 
 import (
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/MistyPigeon/lingo/pkg/codegen"
@@ -10,21 +13,21 @@ import (
 	"github.com/MistyPigeon/lingo/pkg/typechecker"
 )
 
-func TestBasicLexing(t *testing. T) {
+func TestBasicLexing(t *testing.T) {
 	source := `package main
 func main() {
 	var x: int = 42
 }`
 
 	lex := lexer.New(source)
-	tokens := lex. Tokenize()
+	tokens := lex.Tokenize()
 
 	if len(tokens) == 0 {
-		t. Fatal("No tokens generated")
+		t.Fatal("No tokens generated")
 	}
 
-	if tokens[0]. Type != lexer.TOKEN_PACKAGE {
-		t. Errorf("Expected PACKAGE token, got %v", tokens[0].Type)
+	if tokens[0].Type != lexer.TOKEN_PACKAGE {
+		t.Errorf("Expected PACKAGE token, got %v", tokens[0].Type)
 	}
 }
 
@@ -34,10 +37,91 @@ func main() {
 	var x: int = 42
 }`
 
-	lex := lexer. New(source)
+	lex := lexer.New(source)
+	tokens := lex.Tokenize()
+
+	p := parser.New(tokens)
+	ast, err := p.Parse()
+
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+
+	if len(ast.Items) != 2 {
+		t.Fatalf("Expected 2 items, got %d", len(ast.Items))
+	}
+
+	fn, ok := ast.Items[1].(*parser.FuncDecl)
+	if !ok || fn.Name != "main" {
+		t.Fatalf("Expected func main, got %T", ast.Items[1])
+	}
+}
+
+func TestCompile(t *testing.T) {
+	source := `package main
+
+func add(a: int, b: int) int {
+	return a + b
+}
+
+func main() {
+	var x: int = add(1, 2)
+	fmt.Println(x)
+}`
+
+	lex := lexer.New(source)
 	tokens := lex.Tokenize()
 
 	p := parser.New(tokens)
 	ast, err := p.Parse()
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+
+	tc := typechecker.New()
+	if err := tc.Check(ast); err != nil {
+		t.Fatalf("Type error: %v", err)
+	}
+
+	gen := codegen.New()
+	gen.Info = tc.Info()
+	goCode, err := gen.Generate(ast)
+	if err != nil {
+		t.Fatalf("Codegen error: %v", err)
+	}
+
+	if !strings.Contains(goCode, "func add(a int, b int) int {") {
+		t.Errorf("Expected add in output, got:\n%s", goCode)
+	}
 
-	if err != nil
+	// The same source compiled by the lingo command must build and run.
+	if testing.Short() {
+		t.Skip("skipping go build in short mode")
+	}
+	goCmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+	dir := t.TempDir()
+	srcFile := filepath.Join(dir, "main.lingo")
+	if err := os.WriteFile(srcFile, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module prog\n\ngo 1.16\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	lingo := exec.Command(goCmd, "run", "../cmd/lingo", "-file", srcFile)
+	if out, err := lingo.CombinedOutput(); err != nil {
+		t.Fatalf("lingo: %v\n%s", err, out)
+	}
+	run := exec.Command(goCmd, "run", ".")
+	run.Dir = dir
+	out, err := run.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go run: %v\n%s", err, out)
+	}
+	if got := string(out); got != "3\n" {
+		t.Errorf("Program printed %q, want %q", got, "3\n")
+	}
+}